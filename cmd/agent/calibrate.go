@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+// usageEvent holds the api_usage fields calibration reads from events.jsonl.
+type usageEvent struct {
+	Event         string                  `json:"event"`
+	Model         string                  `json:"model"`
+	InputTokens   int64                   `json:"input_tokens"`
+	PreparedRunes *windowing.ContentRunes `json:"prepared_runes"`
+}
+
+// calibrate fits a calibration profile from the api_usage events recorded in
+// calibration mode and writes it for AGT_TOKEN_COUNTER=calibrated. Samples are
+// taken for model, or for the model of the most recent sample when model is "".
+func calibrate(model string, out io.Writer) error {
+	base := strings.TrimSpace(os.Getenv("AGT_ARTIFACTS_DIR"))
+	if base == "" {
+		base = ".agent"
+	}
+	path := filepath.Join(base, "events.jsonl")
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	type sample struct {
+		model string
+		windowing.CalibrationSample
+	}
+	var all []sample
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		var ev usageEvent
+		if json.Unmarshal(sc.Bytes(), &ev) != nil || ev.Event != "api_usage" || ev.PreparedRunes == nil || ev.InputTokens <= 0 {
+			continue
+		}
+		all = append(all, sample{ev.Model, windowing.CalibrationSample{Runes: *ev.PreparedRunes, InputTokens: ev.InputTokens}})
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	if model == "" && len(all) > 0 {
+		model = all[len(all)-1].model
+	}
+	var samples []windowing.CalibrationSample
+	for _, s := range all {
+		if s.model == model {
+			samples = append(samples, s.CalibrationSample)
+		}
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("no calibration samples in %s; chat with AGT_CALIBRATION_MODE=1 first", path)
+	}
+
+	prof, err := windowing.FitCalibration(samples)
+	if err != nil {
+		return err
+	}
+	prof.Model = model
+	dst := runner.CalibrationProfilePath()
+	if err := windowing.SaveCalibration(dst, prof); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Fitted %s from %d samples (mean error %.1f%%):\n", model, prof.Samples, 100*prof.MeanRelError)
+	for _, r := range []struct {
+		class    string
+		rate     float64
+		observed int
+	}{{"prose", prof.Prose, prof.Observed.Prose}, {"code", prof.Code, prof.Observed.Code}, {"json", prof.JSON, prof.Observed.JSON}} {
+		note := ""
+		if r.observed == 0 {
+			note = " (not observed; prior)"
+		}
+		fmt.Fprintf(out, "  %-5s %.3f tokens/rune%s\n", r.class, r.rate, note)
+	}
+	fmt.Fprintf(out, "  framing %.1f tokens/message, %.1f tokens/request\nWrote %s; use it with AGT_TOKEN_COUNTER=calibrated.\n", prof.PerMessage, prof.PerRequest, dst)
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/petasbytes/go-agent/internal/runner"
+)
+
+// systemFlags holds the --system and --system-file flags, which override
+// AGT_SYSTEM_PROMPT and AGENT.md for one run.
+type systemFlags struct {
+	text, file       string
+	hasText, hasFile bool
+}
+
+// parseFlags removes the --system[=]TEXT and --system-file[=]PATH flags from args,
+// wherever they appear, and returns the remaining command arguments.
+func parseFlags(args []string) (systemFlags, []string, error) {
+	var f systemFlags
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		name, value, inline := strings.Cut(args[i], "=")
+		if name != "--system" && name != "--system-file" {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !inline {
+			if i+1 == len(args) {
+				return f, nil, fmt.Errorf("flag %s needs a value\n\n%s", name, usageText)
+			}
+			i++
+			value = args[i]
+		}
+		if name == "--system" {
+			f.text, f.hasText = value, true
+		} else {
+			f.file, f.hasFile = value, true
+		}
+	}
+	if f.hasText && f.hasFile {
+		return f, nil, fmt.Errorf("use only one of --system and --system-file\n\n%s", usageText)
+	}
+	return f, rest, nil
+}
+
+// systemPrompt returns the prompt from --system or --system-file when given, else
+// from AGT_SYSTEM_PROMPT or AGENT.md. An empty --system sends no system prompt.
+func (f systemFlags) systemPrompt() (string, error) {
+	switch {
+	case f.hasText:
+		return strings.TrimSpace(f.text), nil
+	case f.hasFile:
+		s, err := runner.SystemPromptFromFile(f.file)
+		if err != nil {
+			return "", fmt.Errorf("--system-file: %w", err)
+		}
+		return s, nil
+	}
+	return runner.SystemPromptFromEnv()
+}
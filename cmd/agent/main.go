@@ -3,7 +3,6 @@ package main
 import (
 	"bufio"
 	"context"
-	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -21,37 +20,72 @@ import (
 )
 
 func main() {
-	// Basic env check (SDK also reads API key)
-	if os.Getenv("ANTHROPIC_API_KEY") == "" {
-		fmt.Println("Missing ANTHROPIC_API_KEY; export it before running.")
+	// Session store under .agent/sessions; the legacy single conversation is imported once
+	stateDir := ".agent"
+	store := memory.NewStore(filepath.Join(stateDir, "sessions"))
+	migrateLegacyConversation(store, stateDir)
+
+	// Global flags (--system, --system-file) may appear anywhere; the rest is the command
+	sysFlags, args, err := parseFlags(os.Args[1:])
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	// Load prior conversation if exists
-	persistDir := ".agent"
-	if err := os.MkdirAll(persistDir, 0o755); err != nil {
-		fmt.Fprintf(os.Stderr, "warning: failed to create state dir %s: %v\n", persistDir, err)
-	}
-	persistPath := filepath.Join(persistDir, "conversation.json")
-	persisted, err := memory.LoadConversation(persistPath)
+	// Session subcommands (list/rename/delete finish here; others pick the chat session)
+	name, err := sessionCommand(store, args, os.Stdout)
 	if err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			fmt.Fprintf(os.Stderr, "warning: failed to load persisted conversation: %v\n", err)
-		}
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if name == "" {
+		return
 	}
 
-	client := provider.NewAnthropicClient()
-	r := runner.New(client, tools.Registry())
-	model := provider.DefaultModel
+	// Select the model backend (AGT_PROVIDER); also checks its credentials
+	p, err := provider.FromEnv()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
-	// Build SDK conversation from persisted messages text
-	conv := make([]anthropic.MessageParam, 0, len(persisted))
-	for _, m := range persisted {
-		if m.Role == "user" {
-			conv = append(conv, anthropic.NewUserMessage(anthropic.NewTextBlock(m.Text)))
-		} else {
-			conv = append(conv, anthropic.NewAssistantMessage(anthropic.NewTextBlock(m.Text)))
+	// Full history (text, tool pairs, thinking) plus session metadata
+	sess, err := store.Open(name)
+	if err != nil {
+		if sess == nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	r := runner.New(p, tools.Registry())
+	// Model by id or alias (AGT_MODEL); its catalog limits default the budget and max_tokens
+	spec, err := provider.ModelFromEnv(p)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	r.Spec = spec
+	model := anthropic.Model(spec.ID)
+	// Window token counter (AGT_TOKEN_COUNTER) and optional summarising compaction of history beyond AGT_TOKEN_BUDGET
+	if r.Counter, err = runner.CounterFromEnv(p, model); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if r.Compactor, err = runner.CompactionFromEnv(p, model, r.Retry); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// Per-turn time limit (AGT_TURN_TIMEOUT); long enough for run_command's own limits by default
+	turnTimeout, err := runner.TurnTimeoutFromEnv()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// System prompt (--system/--system-file, else AGT_SYSTEM_PROMPT, else AGENT.md in the read root), always sent
+	if r.System, err = sysFlags.systemPrompt(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
 	// Set up graceful shutdown on Ctrl-C (SIGINT) / SIGTERM
@@ -67,7 +101,7 @@ func main() {
 	}()
 
 	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Println("Chat with Claude (Ctrl-C to quit)")
+	fmt.Printf("Chat with Claude in session %s (%d turns so far; Ctrl-C to quit)\n", sess.Meta.Name, sess.Meta.Turns)
 
 	// stdin reader goroutine -> lines into channel
 	inputCh := make(chan string)
@@ -93,40 +127,37 @@ outer:
 				break outer
 			}
 		}
-		conv = append(conv, anthropic.NewUserMessage(anthropic.NewTextBlock(user)))
-
-		// Per-turn context: derive from base ctx so Ctrl-C cancels; add a timeout and turn ID
+		// "/pin <message>" sends a message that is always kept in the window
+		pin := false
+		if rest, ok := strings.CutPrefix(user, "/pin "); ok {
+			user, pin = strings.TrimSpace(rest), true
+		}
+		// Per-turn context: derive from base ctx so Ctrl-C cancels; add the turn timeout and turn ID
 		turnID := fmt.Sprintf("turn-%d", time.Now().UnixNano())
-		ctxTurn, cancelTurn := context.WithTimeout(ctx, 60*time.Second)
+		// The persisted turn record carries the same id (see `agent turns`)
+		sess.BeginTurn(turnID)
+		sess.Messages = append(sess.Messages, anthropic.NewUserMessage(anthropic.NewTextBlock(user)))
+		if pin {
+			_ = sess.Pin(len(sess.Turns), true)
+		}
+		r.Pinned = sess.PinnedMessages()
+
+		var (
+			ctxTurn    context.Context
+			cancelTurn context.CancelFunc
+		)
+		if turnTimeout > 0 {
+			ctxTurn, cancelTurn = context.WithTimeout(ctx, turnTimeout)
+		} else {
+			ctxTurn, cancelTurn = context.WithCancel(ctx)
+		}
 		ctxTurn = telemetry.WithTurnID(ctxTurn, turnID)
 
-		// Track assistant visible text to persist after the turn
-		var lastAssistantText string
-		for {
-			// Prepare a pair-safe, budgeted input window before sending (handled in runner)
-			msg, toolResults, err := r.RunOneStep(ctxTurn, model, conv)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error: %v\n", err)
-				break
-			}
-			conv = append(conv, msg.ToParam())
-			// Collect assistant text blocks from this message
-			for _, b := range msg.Content {
-				if tb, ok := b.AsAny().(anthropic.TextBlock); ok {
-					if tb.Text != "" {
-						if lastAssistantText == "" {
-							lastAssistantText = tb.Text
-						} else {
-							lastAssistantText += "\n" + tb.Text
-						}
-					}
-				}
-			}
-			if len(toolResults) == 0 {
-				break // done with assistant turn
-			}
-			// Provide tool results as a user message back to the model
-			conv = append(conv, anthropic.NewUserMessage(toolResults...))
+		// Run tool steps until the assistant answers; keep whatever completed on error
+		var usage runner.Usage
+		sess.Messages, usage, err = r.RunTurn(ctxTurn, model, sess.Messages)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		}
 
 		// Emit local features for this user turn before we cancel ctxTurn
@@ -135,14 +166,10 @@ outer:
 		// Release resources/timers based on per-turn context.
 		cancelTurn()
 
-		// Persist minimal text-only transcript (user + assistant)
-		persisted = append(persisted, memory.Message{Role: "user", Text: user})
-		if strings.TrimSpace(lastAssistantText) != "" {
-			persisted = append(persisted, memory.Message{Role: "assistant", Text: lastAssistantText})
-		}
-		// Keeping tool blocks transient for now (simpler persistence)
-		if err := memory.SaveConversation(persistPath, persisted); err != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to save conversation: %v\n", err)
+		// Persist the full conversation and update session metadata
+		sess.AddUsage(string(model), usage.InputTokens, usage.OutputTokens)
+		if err := store.Save(sess); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to save session %s: %v\n", sess.Meta.Name, err)
 		}
 	}
 	if err := scanner.Err(); err != nil {
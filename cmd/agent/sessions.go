@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/memory"
+)
+
+// defaultSession is used when no session has been selected yet.
+const defaultSession = "default"
+
+const usageText = `usage: agent [flags] [command]
+
+flags:
+  --system TEXT        system prompt for this run (overrides AGT_SYSTEM_PROMPT and AGENT.md; "" sends none)
+  --system-file PATH   read the system prompt for this run from PATH (same precedence as --system)
+
+commands:
+
+  (no command)         resume the current session (or start "default")
+  new [name]           start a new session and make it current
+  resume <name>        resume a session and make it current
+  sessions             list sessions (* marks the current one)
+  rename <old> <new>   rename a session
+  delete <name>        delete a session
+  turns [name]         list the turns of a session (default: current; * marks pinned turns)
+  fork <name> <turn> [new]
+                       copy turns 1..turn of a session into a new session and resume it
+  rewind <name> <turn> keep only turns 1..turn (the full history is backed up first)
+  pin <name> <turn>    always send the turn's prompt, however old (also: /pin <message> in chat)
+  unpin <name> <turn>  let the turn's prompt be dropped from the window again
+  models               list known models with their limits and prices (pick one with AGT_MODEL)
+  calibrate [model]    fit a token calibration profile from calibration-mode events
+`
+
+// sessionCommand runs a session subcommand. It returns the name of the session to
+// chat in, or "" when the command finished without starting a chat.
+func sessionCommand(store *memory.Store, args []string, out io.Writer) (string, error) {
+	cmd := ""
+	if len(args) > 0 {
+		cmd = args[0]
+		args = args[1:]
+	}
+	switch cmd {
+	case "":
+		cur, err := store.Current()
+		if err != nil {
+			return "", err
+		}
+		if cur == "" || !store.Exists(cur) {
+			cur = defaultSession
+		}
+		return cur, useSession(store, cur, true)
+	case "new":
+		if len(args) > 1 {
+			break
+		}
+		name := "session-" + time.Now().Format("20060102-150405")
+		if len(args) == 1 {
+			name = args[0]
+		}
+		if _, err := store.Create(name); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(out, "Started session %s\n", name)
+		return name, store.SetCurrent(name)
+	case "resume":
+		if len(args) != 1 {
+			break
+		}
+		if !store.Exists(args[0]) {
+			return "", fmt.Errorf("%w: %s", memory.ErrSessionNotFound, args[0])
+		}
+		return args[0], useSession(store, args[0], false)
+	case "sessions":
+		if len(args) != 0 {
+			break
+		}
+		return "", listSessions(store, out)
+	case "rename":
+		if len(args) != 2 {
+			break
+		}
+		if err := store.Rename(args[0], args[1]); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(out, "Renamed %s to %s\n", args[0], args[1])
+		return "", nil
+	case "delete":
+		if len(args) != 1 {
+			break
+		}
+		if err := store.Delete(args[0]); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(out, "Deleted %s\n", args[0])
+		return "", nil
+	case "turns":
+		if len(args) > 1 {
+			break
+		}
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		} else if cur, err := store.Current(); err != nil {
+			return "", err
+		} else {
+			name = cur
+		}
+		if name == "" {
+			name = defaultSession
+		}
+		return "", listTurns(store, name, out)
+	case "fork":
+		if len(args) < 2 || len(args) > 3 {
+			break
+		}
+		turn, err := parseTurn(args[1])
+		if err != nil {
+			return "", err
+		}
+		dst := args[0] + "-fork-" + time.Now().Format("20060102-150405")
+		if len(args) == 3 {
+			dst = args[2]
+		}
+		if _, err := store.Fork(args[0], turn, dst); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(out, "Forked %s at turn %d into %s\n", args[0], turn, dst)
+		return dst, store.SetCurrent(dst)
+	case "rewind":
+		if len(args) != 2 {
+			break
+		}
+		turn, err := parseTurn(args[1])
+		if err != nil {
+			return "", err
+		}
+		backup, err := store.Rewind(args[0], turn)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(out, "Rewound %s to turn %d; previous history saved as %s\n", args[0], turn, backup)
+		return "", nil
+	case "pin", "unpin":
+		if len(args) != 2 {
+			break
+		}
+		turn, err := parseTurn(args[1])
+		if err != nil {
+			return "", err
+		}
+		if err := pinTurn(store, args[0], turn, cmd == "pin"); err != nil {
+			return "", err
+		}
+		verb := "Pinned"
+		if cmd == "unpin" {
+			verb = "Unpinned"
+		}
+		fmt.Fprintf(out, "%s turn %d of %s\n", verb, turn, args[0])
+		return "", nil
+	case "models":
+		if len(args) != 0 {
+			break
+		}
+		return "", listModels(out)
+	case "calibrate":
+		if len(args) > 1 {
+			break
+		}
+		model := ""
+		if len(args) == 1 {
+			model = args[0]
+		}
+		return "", calibrate(model, out)
+	case "help", "-h", "--help":
+		fmt.Fprint(out, usageText)
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown command or arguments: %q\n\n%s", append([]string{cmd}, args...), usageText)
+}
+
+// useSession makes name current, creating it when create is set and it does not exist.
+func useSession(store *memory.Store, name string, create bool) error {
+	if create && !store.Exists(name) {
+		if _, err := store.Create(name); err != nil {
+			return err
+		}
+	}
+	return store.SetCurrent(name)
+}
+
+func listSessions(store *memory.Store, out io.Writer) error {
+	metas, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(metas) == 0 {
+		fmt.Fprintln(out, "No sessions yet; run `agent new <name>` or just `agent`.")
+		return nil
+	}
+	cur, _ := store.Current()
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tNAME\tTURNS\tTOKENS IN/OUT\tMODEL\tUPDATED")
+	for _, m := range metas {
+		mark := ""
+		if m.Name == cur {
+			mark = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d/%d\t%s\t%s\n", mark, m.Name, m.Turns, m.InputTokens, m.OutputTokens, m.Model, m.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
+
+func listModels(out io.Writer) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tPROVIDER\tCONTEXT\tMAX OUT\t$/MTOK IN/OUT\tFEATURES\tALIASES")
+	for _, m := range provider.Catalog {
+		var features []string
+		for _, f := range []struct {
+			on   bool
+			name string
+		}{{m.Tools, "tools"}, {m.Thinking, "thinking"}, {m.Images, "images"}} {
+			if f.on {
+				features = append(features, f.name)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%g/%g\t%s\t%s\n", m.ID, m.Provider, m.ContextWindow, m.MaxOutputTokens, m.InputPrice, m.OutputPrice, strings.Join(features, ","), strings.Join(m.Aliases, ", "))
+	}
+	return tw.Flush()
+}
+
+func listTurns(store *memory.Store, name string, out io.Writer) error {
+	sess, err := store.Open(name)
+	if err != nil && sess == nil {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	if len(sess.Turns) == 0 {
+		fmt.Fprintf(out, "Session %s has no turns yet.\n", name)
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tTURN\tID\tTIME\tTOKENS IN/OUT\tPROMPT")
+	for i, t := range sess.Turns {
+		at := ""
+		if !t.At.IsZero() {
+			at = t.At.Local().Format("2006-01-02 15:04")
+		}
+		mark := ""
+		if t.Pinned {
+			mark = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d/%d\t%s\n", mark, i+1, t.ID, at, t.InputTokens, t.OutputTokens, preview(sess.Prompt(i), 60))
+	}
+	return tw.Flush()
+}
+
+// pinTurn pins or unpins turn n of a saved session.
+func pinTurn(store *memory.Store, name string, n int, pinned bool) error {
+	sess, err := store.Open(name)
+	if err != nil {
+		return err
+	}
+	if err := sess.Pin(n, pinned); err != nil {
+		return err
+	}
+	return store.Save(sess)
+}
+
+// parseTurn reads a 1-based turn number; 0 means "before the first turn".
+func parseTurn(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid turn %q: want a turn number from `agent turns`", s)
+	}
+	return n, nil
+}
+
+// preview returns the first line of s, shortened to max runes.
+func preview(s string, max int) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i] + " …"
+	}
+	if r := []rune(s); len(r) > max {
+		s = string(r[:max-1]) + "…"
+	}
+	return s
+}
+
+// migrateLegacyConversation imports .agent/conversation.json as the default session
+// the first time the session store is used. The legacy file is left in place.
+func migrateLegacyConversation(store *memory.Store, stateDir string) {
+	legacy := filepath.Join(stateDir, "conversation.json")
+	if _, err := os.Stat(legacy); err != nil {
+		return
+	}
+	if metas, err := store.List(); err != nil || len(metas) > 0 {
+		return
+	}
+	if _, err := store.Import(defaultSession, legacy); err != nil && !errors.Is(err, memory.ErrSessionExists) {
+		fmt.Fprintf(os.Stderr, "warning: failed to import %s: %v\n", legacy, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Imported %s as session %q\n", legacy, defaultSession)
+}
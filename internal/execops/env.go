@@ -0,0 +1,37 @@
+package execops
+
+import "strings"
+
+// secretPrefixes and secretMarkers identify variables ScrubEnv drops: provider and
+// agent settings, and anything that looks like a credential.
+var (
+	secretPrefixes = []string{"ANTHROPIC_", "OPENAI_", "AGT_"}
+	secretMarkers  = []string{"API_KEY", "TOKEN", "SECRET", "PASSWORD", "CREDENTIAL"}
+)
+
+// ScrubEnv returns environ without API keys, tokens and other secrets, and without
+// the agent's own AGT_* settings, so commands cannot read or reuse them.
+func ScrubEnv(environ []string) []string {
+	out := make([]string, 0, len(environ))
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if !secret(strings.ToUpper(name)) {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+func secret(name string) bool {
+	for _, p := range secretPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	for _, m := range secretMarkers {
+		if strings.Contains(name, m) {
+			return true
+		}
+	}
+	return false
+}
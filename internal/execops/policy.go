@@ -0,0 +1,68 @@
+package execops
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/petasbytes/go-agent/internal/safety"
+)
+
+// DefaultAllow are the executables run_command may start when AGT_RUN_ALLOW is unset:
+// the Go toolchain and common linters.
+var DefaultAllow = []string{"go", "gofmt", "goimports", "golangci-lint", "staticcheck"}
+
+// DefaultDeny are executables that never run, even when allowed: shells and wrappers
+// that would run arbitrary commands, privilege escalation and network clients.
+var DefaultDeny = []string{
+	"sh", "bash", "zsh", "dash", "ksh", "fish",
+	"env", "xargs", "nohup", "setsid", "timeout", "nice",
+	"sudo", "su", "doas",
+	"curl", "wget", "ssh", "scp", "nc",
+}
+
+// Policy decides which executables may run. Names are bare executable names as
+// looked up on PATH; Deny wins over Allow, and "*" in Allow allows any name.
+type Policy struct {
+	Allow []string
+	Deny  []string
+}
+
+// PolicyFromEnv builds the policy from AGT_RUN_ALLOW and AGT_RUN_DENY, comma-separated
+// executable names. AGT_RUN_ALLOW replaces DefaultAllow ("*" allows any name; set but
+// empty allows none); AGT_RUN_DENY adds to DefaultDeny.
+func PolicyFromEnv() Policy {
+	p := Policy{Allow: DefaultAllow, Deny: DefaultDeny}
+	if v, ok := os.LookupEnv("AGT_RUN_ALLOW"); ok {
+		p.Allow = splitList(v)
+	}
+	p.Deny = slices.Concat(p.Deny, splitList(os.Getenv("AGT_RUN_DENY")))
+	return p
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Check returns ERR_COMMAND_DENIED unless name is a bare executable name the policy
+// allows. Paths are refused so the policy cannot be sidestepped with /bin/sh or with
+// a script written into the workspace.
+func (p Policy) Check(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return safety.ToolError{Code: "ERR_COMMAND_DENIED", Message: fmt.Sprintf("%q: command must be a bare executable name found on PATH", name)}
+	}
+	if slices.Contains(p.Deny, name) {
+		return safety.ToolError{Code: "ERR_COMMAND_DENIED", Message: fmt.Sprintf("%s: denied by policy", name)}
+	}
+	if !slices.Contains(p.Allow, "*") && !slices.Contains(p.Allow, name) {
+		return safety.ToolError{Code: "ERR_COMMAND_DENIED", Message: fmt.Sprintf("%s: not in the allowed commands (%s)", name, strings.Join(p.Allow, ", "))}
+	}
+	return nil
+}
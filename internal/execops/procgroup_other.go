@@ -0,0 +1,13 @@
+//go:build !unix
+
+package execops
+
+import "os/exec"
+
+// setProcessGroup is a no-op where process groups are unavailable.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command's process only; descendants may outlive it.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
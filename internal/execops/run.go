@@ -0,0 +1,120 @@
+// Package execops runs external commands for tools, confined to a working directory
+// with an executable policy, a scrubbed environment and time and output limits.
+package execops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/petasbytes/go-agent/internal/safety"
+)
+
+// waitDelay bounds how long Run waits for output after the process exits or is
+// killed, in case a stray descendant still holds its pipes open.
+const waitDelay = 2 * time.Second
+
+// Command is one command to run: an executable name looked up on PATH and its
+// arguments, run directly rather than through a shell.
+type Command struct {
+	Name      string
+	Args      []string
+	Dir       string        // absolute working directory
+	Timeout   time.Duration // wall-clock limit; <= 0 means none
+	MaxOutput int           // bytes kept per stream; <= 0 means unlimited
+}
+
+// Result is the outcome of a command that started.
+type Result struct {
+	ExitCode        int // -1 when killed by a signal or timeout
+	Stdout, Stderr  string
+	StdoutTruncated bool // more than MaxOutput bytes were written to stdout
+	StderrTruncated bool
+	TimedOut        bool
+	Duration        time.Duration
+}
+
+// Run checks c.Name against the policy and runs the command in c.Dir with a scrubbed
+// environment (see ScrubEnv) and empty stdin. The command gets its own process group, and the whole
+// group is killed when the timeout expires or ctx is cancelled. A non-zero exit is
+// reported in Result, not as an error. Errors are ToolErrors for denied or missing
+// executables, ctx.Err() when ctx was cancelled, or the error starting the process.
+func Run(ctx context.Context, p Policy, c Command) (Result, error) {
+	if err := p.Check(c.Name); err != nil {
+		return Result{}, err
+	}
+	path, err := exec.LookPath(c.Name)
+	if err != nil {
+		return Result{}, safety.ToolError{Code: "ERR_COMMAND_NOT_FOUND", Message: fmt.Sprintf("%s: not found on PATH", c.Name)}
+	}
+
+	runCtx := ctx
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(runCtx, path, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Env = ScrubEnv(os.Environ())
+	stdout := &capWriter{max: c.MaxOutput}
+	stderr := &capWriter{max: c.MaxOutput}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	cmd.WaitDelay = waitDelay
+
+	start := time.Now()
+	err = cmd.Run()
+	res := Result{
+		ExitCode:        -1,
+		Stdout:          stdout.String(),
+		Stderr:          stderr.String(),
+		StdoutTruncated: stdout.dropped,
+		StderrTruncated: stderr.dropped,
+		Duration:        time.Since(start),
+	}
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+	if runCtx.Err() != nil {
+		res.TimedOut = true
+		return res, nil
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !errors.Is(err, exec.ErrWaitDelay) {
+		return res, err
+	}
+	return res, nil
+}
+
+// capWriter keeps the first max bytes written to it and records whether more came.
+type capWriter struct {
+	max     int
+	buf     strings.Builder
+	dropped bool
+}
+
+func (w *capWriter) Write(b []byte) (int, error) {
+	keep := b
+	if w.max > 0 {
+		room := max(w.max-w.buf.Len(), 0)
+		if len(keep) > room {
+			keep, w.dropped = keep[:room], true
+		}
+	}
+	w.buf.Write(keep)
+	return len(b), nil // report everything written so the command is not sent EPIPE
+}
+
+// String returns the kept output, dropping a rune split by the cap.
+func (w *capWriter) String() string {
+	return strings.ToValidUTF8(w.buf.String(), "")
+}
@@ -0,0 +1,124 @@
+package execops_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/petasbytes/go-agent/internal/execops"
+	"github.com/petasbytes/go-agent/internal/safety"
+)
+
+// shell allows sh, which the default policy denies, to script test commands.
+var shell = execops.Policy{Allow: []string{"sh"}}
+
+func runSh(t *testing.T, c execops.Command, script string) execops.Result {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh unavailable")
+	}
+	c.Name, c.Args = "sh", []string{"-c", script}
+	if c.Dir == "" {
+		c.Dir = t.TempDir()
+	}
+	res, err := execops.Run(context.Background(), shell, c)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return res
+}
+
+func TestRun_ExitCodeStreamsAndDir(t *testing.T) {
+	dir := t.TempDir()
+	res := runSh(t, execops.Command{Dir: dir}, "pwd; echo oops >&2; exit 3")
+	if res.ExitCode != 3 || res.TimedOut {
+		t.Fatalf("want exit 3, got %+v", res)
+	}
+	want, _ := filepath.EvalSymlinks(dir)
+	if got := strings.TrimSpace(res.Stdout); got != want && got != dir {
+		t.Fatalf("command should run in %s, ran in %s", dir, got)
+	}
+	if res.Stderr != "oops\n" {
+		t.Fatalf("stderr = %q", res.Stderr)
+	}
+}
+
+func TestRun_ScrubsSecretsFromEnv(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-test")
+	t.Setenv("GITHUB_TOKEN", "ghp-test")
+	t.Setenv("GOFLAGS", "-count=1")
+	res := runSh(t, execops.Command{}, `echo "${ANTHROPIC_API_KEY:-unset} ${GITHUB_TOKEN:-unset} $GOFLAGS"`)
+	if res.Stdout != "unset unset -count=1\n" {
+		t.Fatalf("secrets leaked or settings lost: %q", res.Stdout)
+	}
+}
+
+func TestRun_OutputCap(t *testing.T) {
+	res := runSh(t, execops.Command{MaxOutput: 100}, "i=0; while [ $i -lt 50 ]; do echo 0123456789; i=$((i+1)); done")
+	if len(res.Stdout) != 100 || !res.StdoutTruncated || res.ExitCode != 0 {
+		t.Fatalf("want 100 bytes kept and truncation flagged, got %d bytes %+v", len(res.Stdout), res.StdoutTruncated)
+	}
+}
+
+func TestRun_TimeoutKillsProcessGroup(t *testing.T) {
+	start := time.Now()
+	// The background sleep holds stdout open; only killing the group ends the run promptly.
+	res := runSh(t, execops.Command{Timeout: 200 * time.Millisecond}, "sleep 30 & sleep 30")
+	if !res.TimedOut || res.ExitCode != -1 {
+		t.Fatalf("want a timed-out result, got %+v", res)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("timeout took %v; process group not killed", d)
+	}
+}
+
+func TestRun_CancelReturnsContextError(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh unavailable")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := execops.Run(ctx, shell, execops.Command{Name: "sh", Args: []string{"-c", "sleep 30"}, Dir: t.TempDir()})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want the context error, got %v", err)
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	p := execops.Policy{Allow: []string{"go", "*"}, Deny: []string{"bash"}}
+	for name, wantOK := range map[string]bool{
+		"go":       true,
+		"make":     true, // "*" allows any name not denied
+		"bash":     false,
+		"/bin/sh":  false,
+		"./run.sh": false,
+		`..\x.exe`: false,
+		"":         false,
+	} {
+		err := p.Check(name)
+		var te safety.ToolError
+		if wantOK != (err == nil) || (err != nil && (!errors.As(err, &te) || te.Code != "ERR_COMMAND_DENIED")) {
+			t.Errorf("Check(%q) = %v, want ok=%v", name, err, wantOK)
+		}
+	}
+	if err := (execops.Policy{Allow: []string{"go"}}).Check("make"); err == nil {
+		t.Fatal("names outside the allowlist should be denied")
+	}
+}
+
+func TestPolicyFromEnv(t *testing.T) {
+	t.Setenv("AGT_RUN_ALLOW", "go, make")
+	t.Setenv("AGT_RUN_DENY", "make")
+	p := execops.PolicyFromEnv()
+	if p.Check("go") != nil || p.Check("make") == nil || p.Check("gofmt") == nil || p.Check("sh") == nil {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+	t.Setenv("AGT_RUN_ALLOW", "")
+	if execops.PolicyFromEnv().Check("go") == nil {
+		t.Fatal("an empty AGT_RUN_ALLOW should allow nothing")
+	}
+}
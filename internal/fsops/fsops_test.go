@@ -142,6 +142,33 @@ func TestWriteFile_HappyPathNested(t *testing.T) {
 	}
 }
 
+func TestRemoveFile_AndCheckWrite(t *testing.T) {
+	_ = setupSandbox(t)
+	if err := fsops.WriteFile(rel(t, "gone.txt"), "x"); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if err := fsops.RemoveFile(rel(t, "gone.txt")); err != nil {
+		t.Fatalf("RemoveFile: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(os.Getenv("AGT_WRITE_ROOT"), rel(t, "gone.txt"))); !os.IsNotExist(err) {
+		t.Fatalf("file should be gone, stat err = %v", err)
+	}
+	if err := fsops.RemoveFile(rel(t)); err == nil {
+		t.Fatal("expected directories to be refused")
+	}
+
+	if err := fsops.CheckWrite(rel(t, "ok.txt")); err != nil {
+		t.Fatalf("CheckWrite: %v", err)
+	}
+	var te safety.ToolError
+	if err := fsops.CheckWrite("go.mod"); !errors.As(err, &te) || te.Code != "ERR_DENIED_WRITE" {
+		t.Fatalf("want ERR_DENIED_WRITE for go.mod, got %v", err)
+	}
+	if err := fsops.RemoveFile("go.mod"); !errors.As(err, &te) || te.Code != "ERR_DENIED_WRITE" {
+		t.Fatalf("want ERR_DENIED_WRITE removing go.mod, got %v", err)
+	}
+}
+
 func TestErrorPropagation_ReadDenylist(t *testing.T) {
 	dir := setupSandbox(t)
 	if err := os.Mkdir(filepath.Join(dir, ".agent"), 0o755); err != nil {
@@ -207,3 +234,41 @@ func TestErrorPropagation_ReadTraversal(t *testing.T) {
 		t.Fatalf("unexpected code: %s", te.Code)
 	}
 }
+
+func TestWalk_SkipsDeniedAndEscapingEntries(t *testing.T) {
+	dir := setupSandbox(t)
+	for _, name := range []string{"b.txt", "a/c.txt", "sub/.git/HEAD", "sub/.agent/events.jsonl"} {
+		p := filepath.Join(dir, rel(t, name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+	}
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dir, rel(t, "escape"))); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, rel(t, "b.txt")), filepath.Join(dir, rel(t, "link.txt"))); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+
+	var got []string
+	if err := fsops.Walk(rel(t), func(p string) error {
+		got = append(got, p)
+		return nil
+	}); err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	base := filepath.ToSlash(rel(t))
+	want := []string{base + "/a/c.txt", base + "/b.txt", base + "/link.txt"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v want %v", got, want)
+		}
+	}
+}
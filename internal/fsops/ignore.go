@@ -0,0 +1,22 @@
+package fsops
+
+import (
+	"path/filepath"
+
+	"github.com/petasbytes/go-agent/internal/ignore"
+)
+
+// Ignores returns a matcher for the .gitignore and .agentignore files under the read
+// root, taking the same root-relative paths as Walk yields. Ignore files are read as
+// paths are checked, so use one matcher per tool call to pick up edits between calls.
+func Ignores() (*ignore.Matcher, error) {
+	readRoot, _, err := getRoots()
+	if err != nil {
+		return nil, err
+	}
+	root := readRoot
+	if r, err := filepath.EvalSymlinks(readRoot); err == nil {
+		root = r
+	}
+	return ignore.New(root), nil
+}
@@ -25,3 +25,9 @@ func getRoots() (string, string, error) {
 	rootsOnce.Do(initRoots)
 	return absReadRoot, absWriteRoot, initRootsErr
 }
+
+// WriteRoot returns the absolute sandbox write root, the working directory for commands.
+func WriteRoot() (string, error) {
+	_, writeRoot, err := getRoots()
+	return writeRoot, err
+}
@@ -0,0 +1,86 @@
+package fsops
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/petasbytes/go-agent/internal/safety"
+)
+
+// Walk calls fn with each regular file under the relative path relDir (or relDir
+// itself when it is a file), in lexical order. Paths passed to fn are relative to
+// the read root and slash-separated, ready for ReadFile.
+// Every entry is checked with safety.ValidateRelPath: denied directories (.git/,
+// .agent/) are skipped whole and symlinks resolving outside the sandbox are skipped.
+// Nested .git and .agent directories (submodules, other workspaces) are skipped too.
+// Symlinked directories are not followed. fn may return fs.SkipAll to stop early;
+// any other error stops the walk and is returned.
+func Walk(relDir string, fn func(relPath string) error) error {
+	return WalkDir(relDir, func(relPath string, isDir bool) error {
+		if isDir {
+			return nil
+		}
+		return fn(relPath)
+	})
+}
+
+// WalkDir is Walk that also calls fn, with isDir set, for each directory below
+// relDir before its contents; fn may return fs.SkipDir to skip a directory.
+func WalkDir(relDir string, fn func(relPath string, isDir bool) error) error {
+	readRoot, _, err := getRoots()
+	if err != nil {
+		return err
+	}
+	if relDir == "" {
+		relDir = "."
+	}
+	absDir, err := safety.ValidateRelPath(readRoot, relDir)
+	if err != nil {
+		return err
+	}
+	// Relative paths are taken against the resolved root, as ValidateRelPath does.
+	root := readRoot
+	if r, err := filepath.EvalSymlinks(readRoot); err == nil {
+		root = r
+	}
+
+	return filepath.WalkDir(absDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == absDir {
+				return err
+			}
+			return nil // unreadable entries are skipped
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if p != absDir {
+			if d.IsDir() && (d.Name() == ".git" || d.Name() == ".agent") {
+				return filepath.SkipDir
+			}
+			if _, err := safety.ValidateRelPath(readRoot, rel); err != nil {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		switch {
+		case d.IsDir():
+			if p == absDir {
+				return nil
+			}
+			return fn(rel, true)
+		case d.Type()&fs.ModeSymlink != 0:
+			if fi, err := os.Stat(p); err != nil || !fi.Mode().IsRegular() {
+				return nil
+			}
+		case !d.Type().IsRegular():
+			return nil
+		}
+		return fn(rel, false)
+	})
+}
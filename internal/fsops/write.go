@@ -27,3 +27,37 @@ func WriteFile(relPath, content string) error {
 
 	return os.WriteFile(absPath, []byte(content), 0o644)
 }
+
+// CheckWrite validates relPath against the write policy without writing, so a caller
+// making several writes can refuse them all up front rather than stop halfway.
+func CheckWrite(relPath string) error {
+	_, writeRoot, err := getRoots()
+	if err != nil {
+		return err
+	}
+	_, err = safety.ValidateWritePath(writeRoot, relPath)
+	return err
+}
+
+// RemoveFile deletes a file addressed by a relative path under the sandbox write root,
+// under the same policy as WriteFile. Directories are not removed.
+func RemoveFile(relPath string) error {
+	_, writeRoot, err := getRoots()
+	if err != nil {
+		return err
+	}
+
+	absPath, err := safety.ValidateWritePath(writeRoot, relPath)
+	if err != nil {
+		return err // propagate ToolError unchanged
+	}
+
+	fi, err := os.Lstat(absPath)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return safety.ToolError{Code: "ERR_NOT_A_FILE", Message: "path is a directory"}
+	}
+	return os.Remove(absPath)
+}
@@ -0,0 +1,201 @@
+// Package ignore matches paths against .gitignore and .agentignore files.
+package ignore
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// fileNames are the ignore files read in each directory, in precedence order: rules in
+// .agentignore come later and so override .gitignore in the same directory.
+var fileNames = []string{".gitignore", ".agentignore"}
+
+// Matcher reports whether slash-separated paths relative to a root directory are
+// ignored, with gitignore semantics: rules from ignore files in a directory apply to
+// paths below it, deeper files and later rules take precedence, "!" negates, and a
+// path inside an ignored directory stays ignored whatever its own rules say.
+// Ignore files are read lazily and cached; a Matcher is not safe for concurrent use.
+type Matcher struct {
+	root  string
+	rules map[string][]rule // by directory; "." is the root
+	dirs  map[string]bool   // memoised Ignored(dir, true) for ancestor checks
+}
+
+type rule struct {
+	base     string   // directory holding the ignore file; "." for the root
+	segs     []string // pattern split on "/"
+	anchored bool     // matched against the path below base rather than any trailing name
+	dirOnly  bool     // trailing "/": matches directories only
+	negate   bool     // leading "!": re-includes a previously ignored path
+}
+
+// New returns a Matcher for ignore files under the absolute directory root.
+func New(root string) *Matcher {
+	return &Matcher{root: root, rules: map[string][]rule{}, dirs: map[string]bool{}}
+}
+
+// Ignored reports whether relPath, relative to the root, is ignored. isDir says
+// whether it names a directory, for patterns ending in "/". The root is never ignored.
+func (m *Matcher) Ignored(relPath string, isDir bool) bool {
+	p := path.Clean(strings.TrimPrefix(relPath, "/"))
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return false
+	}
+	if dir := path.Dir(p); dir != "." && m.ignoredDir(dir) {
+		return true
+	}
+	return m.match(p, isDir)
+}
+
+// ignoredDir is Ignored for a directory, memoised as walks test the same ancestors.
+func (m *Matcher) ignoredDir(dir string) bool {
+	if v, ok := m.dirs[dir]; ok {
+		return v
+	}
+	v := m.Ignored(dir, true)
+	m.dirs[dir] = v
+	return v
+}
+
+// match applies the rules of every ignore file from the root down to p's directory;
+// the last matching rule decides.
+func (m *Matcher) match(p string, isDir bool) bool {
+	ignored := false
+	for _, dir := range ancestors(path.Dir(p)) {
+		for _, r := range m.load(dir) {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			if r.matches(p) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// ancestors returns "." followed by each directory from the top down to dir.
+func ancestors(dir string) []string {
+	out := []string{"."}
+	if dir == "." {
+		return out
+	}
+	segs := strings.Split(dir, "/")
+	for i := range segs {
+		out = append(out, strings.Join(segs[:i+1], "/"))
+	}
+	return out
+}
+
+// load returns the rules of the ignore files in dir, reading them on first use.
+// Missing, unreadable and non-regular files (such as symlinks) contribute no rules.
+func (m *Matcher) load(dir string) []rule {
+	if rules, ok := m.rules[dir]; ok {
+		return rules
+	}
+	var rules []rule
+	for _, name := range fileNames {
+		abs := filepath.Join(m.root, filepath.FromSlash(dir), name)
+		if fi, err := os.Lstat(abs); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		b, err := os.ReadFile(abs)
+		if err != nil {
+			continue
+		}
+		rules = append(rules, parse(dir, string(b))...)
+	}
+	m.rules[dir] = rules
+	return rules
+}
+
+// parse parses the content of an ignore file found in base (a slash-separated
+// directory relative to the root, "." for the root). Blank lines and "#" comments
+// are skipped; "\#" and "\!" escape a leading "#" or "!", and trailing spaces are
+// dropped unless escaped with "\".
+func parse(base, content string) []rule {
+	var rules []rule
+	for _, line := range strings.Split(content, "\n") {
+		line = trimTrailingSpace(strings.TrimSuffix(line, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r := rule{base: base}
+		if strings.HasPrefix(line, "!") {
+			r.negate, line = true, line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly, line = true, strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		// A slash at the start or middle anchors the pattern to base; otherwise it
+		// matches a name at any depth, as if prefixed with "**/".
+		r.anchored = strings.Contains(line, "/")
+		r.segs = strings.Split(strings.TrimPrefix(line, "/"), "/")
+		for i, s := range r.segs {
+			r.segs[i] = strings.ReplaceAll(s, "[!", "[^") // fnmatch negated class
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// trimTrailingSpace drops trailing spaces that are not escaped with a backslash.
+func trimTrailingSpace(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-1]
+	}
+	if strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-2] + " "
+	}
+	return s
+}
+
+// matches reports whether p, relative to the root, matches the rule's pattern.
+func (r rule) matches(p string) bool {
+	if r.base != "." {
+		var ok bool
+		if p, ok = strings.CutPrefix(p, r.base+"/"); !ok {
+			return false
+		}
+	}
+	segs := strings.Split(p, "/")
+	if !r.anchored {
+		ok, _ := path.Match(r.segs[0], segs[len(segs)-1])
+		return ok
+	}
+	return matchSegments(r.segs, segs)
+}
+
+// matchSegments matches path segments against pattern segments, where "**" matches
+// any number of segments. A trailing "**" matches everything inside a directory but
+// not the directory itself.
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			if len(pat) == 1 {
+				return len(segs) > 0
+			}
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
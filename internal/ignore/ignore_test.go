@@ -0,0 +1,73 @@
+package ignore_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/petasbytes/go-agent/internal/ignore"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+	}
+}
+
+func TestMatcher_GitignoreSemantics(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".gitignore":     "# comment\n*.log\n!keep.log\n/bin/\nbuild/\ndocs/**/*.md\nnode_modules/\n\\#hash\ntrailing   \n",
+		".agentignore":   ".env\n!trace.log\n",
+		"sub/.gitignore": "*.tmp\n!debug.log\n/local\n",
+	})
+	m := ignore.New(root)
+
+	cases := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"a/b/app.log", false, true},       // unanchored name matches at any depth
+		{"keep.log", false, false},         // negated
+		{"trace.log", false, false},        // .agentignore overrides .gitignore
+		{".env", false, true},              // .agentignore rule
+		{"bin", true, true},                // anchored directory
+		{"bin", false, false},              // dir-only pattern skips files
+		{"src/bin", true, false},           // anchored to the root only
+		{"src/build", true, true},          // unanchored directory at any depth
+		{"src/build/out.o", false, true},   // inside an ignored directory
+		{"docs/a/b/guide.md", false, true}, // ** spans directories
+		{"docs/guide.md", false, true},     // ** matches zero directories
+		{"docs/guide.txt", false, false},
+		{"#hash", false, true},          // escaped comment character
+		{"trailing", false, true},       // trailing spaces dropped
+		{"sub/x.tmp", false, true},      // nested file applies below its directory
+		{"x.tmp", false, false},         // ...and not above it
+		{"sub/debug.log", false, false}, // deeper negation wins
+		{"sub/local", false, true},      // anchored to the nested directory
+		{"sub/deeper/local", false, false},
+		{"node_modules/pkg/keep.log", false, true}, // no re-including inside an ignored directory
+		{".", true, false},
+	}
+	for _, c := range cases {
+		if got := m.Ignored(c.path, c.isDir); got != c.want {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", c.path, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestMatcher_NoIgnoreFiles(t *testing.T) {
+	m := ignore.New(t.TempDir())
+	if m.Ignored("anything/at/all.log", false) {
+		t.Fatal("nothing should be ignored without ignore files")
+	}
+}
@@ -0,0 +1,159 @@
+package patch
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MaxFuzz is how many context lines a hunk may ignore at each end when it does not
+// match with its full context, like patch(1)'s default fuzz factor.
+const MaxFuzz = 2
+
+// HunkResult reports where a hunk applied or why it did not.
+type HunkResult struct {
+	Path   string `json:"path"`
+	Hunk   int    `json:"hunk"`             // 1-based within the file
+	Status string `json:"status"`           // "applied" or "failed"
+	Line   int    `json:"line,omitempty"`   // 1-based line of the original file where the hunk starts
+	Offset int    `json:"offset,omitempty"` // lines away from the position in the hunk header
+	Fuzz   int    `json:"fuzz,omitempty"`   // context lines ignored at each end to match
+	Error  string `json:"error,omitempty"`
+	Want   string `json:"want,omitempty"` // failed: first hunk line that differs at the expected position
+	Got    string `json:"got,omitempty"`  // failed: the file's line there
+}
+
+// Apply applies f's hunks in order to content ("" for a new file). Each hunk is
+// matched at the line in its header first, then at the nearest offset, then with
+// up to MaxFuzz context lines ignored at each end; hunks may not overlap. Every hunk
+// gets a result, so a failed patch reports all hunks. ok is false when any hunk
+// failed, and the returned content must then be ignored. CRLF line endings and a
+// missing final newline in content are preserved unless the patch changes them.
+func (f File) Apply(content string) (string, []HunkResult, bool) {
+	crlf := strings.Contains(content, "\r\n")
+	if crlf {
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	var lines []string
+	finalNewline := true
+	if content != "" {
+		finalNewline = strings.HasSuffix(content, "\n")
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	results := make([]HunkResult, 0, len(f.Hunks))
+	ok := true
+	floor, delta := 0, 0 // end of the last applied hunk; lines added so far
+	for n, h := range f.Hunks {
+		res := HunkResult{Path: f.Path(), Hunk: n + 1}
+		old, repl, lead, trail := h.sides()
+		expected := h.OldStart - 1 // index of the hunk's first line
+		if len(old) == 0 {
+			expected = h.OldStart // pure insertion after line OldStart
+		}
+		expected += delta
+
+		pos, fuzz, found := locate(lines, old, lead, trail, expected, floor)
+		if !found {
+			ok = false
+			res.Status, res.Line = "failed", h.OldStart
+			res.Error = fmt.Sprintf("context and removed lines not found near line %d (tried offsets and fuzz up to %d)", h.OldStart, MaxFuzz)
+			res.Want, res.Got = firstMismatch(lines, old, expected)
+			results = append(results, res)
+			continue
+		}
+		cutLead, cutTrail := min(fuzz, lead), min(fuzz, trail)
+		old, repl = old[cutLead:len(old)-cutTrail], repl[cutLead:len(repl)-cutTrail]
+		lines = slices.Replace(lines, pos, pos+len(old), repl...)
+		if pos+len(repl) == len(lines) {
+			// The hunk reaches the end of the file, so its markers decide the final newline.
+			if h.NoNewlineNew {
+				finalNewline = false
+			} else if h.NoNewlineOld {
+				finalNewline = true
+			}
+		}
+
+		start := pos - cutLead // where the full hunk would start
+		res.Status = "applied"
+		res.Line = start - delta + 1
+		res.Offset = start - expected
+		res.Fuzz = fuzz
+		results = append(results, res)
+		floor = pos + len(repl)
+		delta += len(repl) - len(old)
+	}
+
+	out := strings.Join(lines, "\n")
+	if finalNewline && len(lines) > 0 {
+		out += "\n"
+	}
+	if crlf {
+		out = strings.ReplaceAll(out, "\n", "\r\n")
+	}
+	return out, results, ok
+}
+
+// sides returns the hunk's old lines (context and removed) and new lines (context
+// and added), and how many context lines lead and trail it.
+func (h Hunk) sides() (old, repl []string, lead, trail int) {
+	for _, l := range h.Lines {
+		if l.Op != '+' {
+			old = append(old, l.Text)
+		}
+		if l.Op != '-' {
+			repl = append(repl, l.Text)
+		}
+	}
+	for lead < len(h.Lines) && h.Lines[lead].Op == ' ' {
+		lead++
+	}
+	for trail < len(h.Lines)-lead && h.Lines[len(h.Lines)-1-trail].Op == ' ' {
+		trail++
+	}
+	return old, repl, lead, trail
+}
+
+// locate finds where old matches lines at or after floor, trying fuzz 0..MaxFuzz and,
+// for each, positions nearest to expected first. It returns the index of the first
+// line matched after dropping fuzz context lines.
+func locate(lines, old []string, lead, trail, expected, floor int) (pos, fuzz int, found bool) {
+	if len(old) == 0 {
+		return min(max(expected, floor), len(lines)), 0, true
+	}
+	for fuzz = 0; fuzz <= MaxFuzz; fuzz++ {
+		cutLead, cutTrail := min(fuzz, lead), min(fuzz, trail)
+		if fuzz > 0 && cutLead == min(fuzz-1, lead) && cutTrail == min(fuzz-1, trail) {
+			break // no more context to drop
+		}
+		want := old[cutLead : len(old)-cutTrail]
+		if len(want) == 0 {
+			break // a context-only hunk cannot be matched without context
+		}
+		at := expected + cutLead
+		last := len(lines) - len(want)
+		for d := 0; at-d >= floor || at+d <= last; d++ {
+			for _, p := range []int{at + d, at - d} {
+				if p >= floor && p <= last && slices.Equal(lines[p:p+len(want)], want) {
+					return p, fuzz, true
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// firstMismatch returns the first old line that differs from lines at index at,
+// and the line found there, for the failure report.
+func firstMismatch(lines, old []string, at int) (want, got string) {
+	at = min(max(at, 0), len(lines))
+	for i, w := range old {
+		if at+i >= len(lines) {
+			return w, "(end of file)"
+		}
+		if lines[at+i] != w {
+			return w, lines[at+i]
+		}
+	}
+	return "", ""
+}
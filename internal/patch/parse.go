@@ -0,0 +1,187 @@
+// Package patch parses unified diffs and applies their hunks to file contents,
+// locating each hunk with offset and fuzz the way patch(1) does.
+package patch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/petasbytes/go-agent/internal/safety"
+)
+
+// DevNull is the path a diff uses for the missing side of a created or deleted file.
+const DevNull = "/dev/null"
+
+// File is the part of a diff for one file.
+type File struct {
+	OldPath, NewPath string // DevNull for a created or deleted file
+	Hunks            []Hunk
+}
+
+// Hunk is one "@@ -a,b +c,d @@" section.
+type Hunk struct {
+	OldStart, NewStart int // 1-based line numbers from the header
+	Lines              []Line
+	NoNewlineOld       bool // "\ No newline at end of file" after the old side's last line
+	NoNewlineNew       bool // ...after the new side's last line
+}
+
+// Line is one hunk line: Op is ' ' for context, '-' for removed or '+' for added.
+type Line struct {
+	Op   byte
+	Text string
+}
+
+// Parse parses a unified diff, as produced by diff -u or git diff, into files.
+// Text before the first "---" header and git extended headers are ignored. Hunk
+// line counts in "@@" headers are not trusted: a hunk runs until the next hunk or
+// file header, so hand-written diffs with miscounted headers still parse. A blank
+// line inside a hunk is taken as an empty context line. Errors are ToolErrors with
+// code ERR_INVALID_PATCH.
+func Parse(diff string) ([]File, error) {
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	var files []File
+	var file *File
+	var hunk *Hunk
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		switch {
+		case isFileHeader(lines, i):
+			files = append(files, File{
+				OldPath: headerPath(strings.TrimPrefix(l, "--- ")),
+				NewPath: headerPath(strings.TrimPrefix(lines[i+1], "+++ ")),
+			})
+			file, hunk = &files[len(files)-1], nil
+			i++
+		case strings.HasPrefix(l, "@@"):
+			if file == nil {
+				return nil, invalid(i, "hunk before any ---/+++ file header")
+			}
+			h, err := parseHunkHeader(l)
+			if err != nil {
+				return nil, invalid(i, err.Error())
+			}
+			file.Hunks = append(file.Hunks, h)
+			hunk = &file.Hunks[len(file.Hunks)-1]
+		case hunk == nil:
+			// Preamble, "diff --git" and "index" lines, or text between files.
+		case strings.HasPrefix(l, `\`):
+			if len(hunk.Lines) == 0 {
+				return nil, invalid(i, `"\ No newline" marker before any hunk line`)
+			}
+			switch hunk.Lines[len(hunk.Lines)-1].Op {
+			case '-':
+				hunk.NoNewlineOld = true
+			case '+':
+				hunk.NoNewlineNew = true
+			default:
+				hunk.NoNewlineOld, hunk.NoNewlineNew = true, true
+			}
+		case l == "":
+			if moreHunkLines(lines, i+1) {
+				hunk.Lines = append(hunk.Lines, Line{Op: ' '})
+			}
+		case l[0] == ' ' || l[0] == '-' || l[0] == '+':
+			hunk.Lines = append(hunk.Lines, Line{Op: l[0], Text: l[1:]})
+		case strings.HasPrefix(l, "diff "):
+			hunk = nil // next file's extended header
+		default:
+			return nil, invalid(i, fmt.Sprintf("unexpected line in hunk: %q (hunk lines start with ' ', '-' or '+')", l))
+		}
+	}
+	if len(files) == 0 {
+		return nil, safety.ToolError{Code: "ERR_INVALID_PATCH", Message: "no ---/+++ file headers found; expected a unified diff"}
+	}
+	for _, f := range files {
+		if f.OldPath == DevNull && f.NewPath == DevNull {
+			return nil, safety.ToolError{Code: "ERR_INVALID_PATCH", Message: "both sides of a file header are /dev/null"}
+		}
+		if len(f.Hunks) == 0 {
+			return nil, safety.ToolError{Code: "ERR_INVALID_PATCH", Message: fmt.Sprintf("%s: no hunks", f.Path())}
+		}
+		for n, h := range f.Hunks {
+			if len(h.Lines) == 0 {
+				return nil, safety.ToolError{Code: "ERR_INVALID_PATCH", Message: fmt.Sprintf("%s: hunk %d is empty", f.Path(), n+1)}
+			}
+		}
+	}
+	return files, nil
+}
+
+// Path is the file's path in the result, or its old path when it is deleted.
+func (f File) Path() string {
+	if f.NewPath == DevNull {
+		return f.OldPath
+	}
+	return f.NewPath
+}
+
+// isFileHeader reports whether lines[i] starts a "---"/"+++" header pair. A removed
+// line that happens to start with "-- " is told apart by the "+++ " line after it.
+func isFileHeader(lines []string, i int) bool {
+	return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+}
+
+// headerPath returns the path from a "---"/"+++" header, without a trailing
+// timestamp and without git's a/ or b/ prefix.
+func headerPath(s string) string {
+	if tab := strings.IndexByte(s, '\t'); tab >= 0 {
+		s = s[:tab]
+	}
+	s = strings.TrimSpace(s)
+	if s == DevNull {
+		return s
+	}
+	if len(s) > 2 && (s[:2] == "a/" || s[:2] == "b/") {
+		s = s[2:]
+	}
+	return s
+}
+
+// parseHunkHeader parses "@@ -a[,b] +c[,d] @@ ...", keeping the start lines.
+func parseHunkHeader(l string) (Hunk, error) {
+	fields := strings.Fields(l)
+	if len(fields) < 3 || fields[0] != "@@" || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return Hunk{}, fmt.Errorf("malformed hunk header %q; want @@ -a,b +c,d @@", l)
+	}
+	oldStart, err := rangeStart(fields[1][1:])
+	if err != nil {
+		return Hunk{}, fmt.Errorf("malformed hunk header %q: %v", l, err)
+	}
+	newStart, err := rangeStart(fields[2][1:])
+	if err != nil {
+		return Hunk{}, fmt.Errorf("malformed hunk header %q: %v", l, err)
+	}
+	return Hunk{OldStart: oldStart, NewStart: newStart}, nil
+}
+
+func rangeStart(r string) (int, error) {
+	start, _, _ := strings.Cut(r, ",")
+	n, err := strconv.Atoi(start)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad line number %q", start)
+	}
+	return n, nil
+}
+
+// moreHunkLines reports whether a hunk line follows lines[from:] before the next
+// header or the end of the diff. Blank lines at the end of a hunk are the diff's own
+// trailing newlines, not empty context lines.
+func moreHunkLines(lines []string, from int) bool {
+	for i := from; i < len(lines); i++ {
+		l := lines[i]
+		switch {
+		case l == "":
+			continue
+		case strings.HasPrefix(l, "@@"), strings.HasPrefix(l, "diff "), isFileHeader(lines, i):
+			return false
+		}
+		return strings.ContainsRune(" -+\\", rune(l[0]))
+	}
+	return false
+}
+
+func invalid(i int, msg string) error {
+	return safety.ToolError{Code: "ERR_INVALID_PATCH", Message: fmt.Sprintf("line %d: %s", i+1, msg)}
+}
@@ -0,0 +1,160 @@
+package patch_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/petasbytes/go-agent/internal/patch"
+	"github.com/petasbytes/go-agent/internal/safety"
+)
+
+// numbered returns "line 1\n" ... "line n\n".
+func numbered(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		b.WriteString("line " + strconv.Itoa(i) + "\n")
+	}
+	return b.String()
+}
+
+func mustParse(t *testing.T, diff string) []patch.File {
+	t.Helper()
+	files, err := patch.Parse(diff)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return files
+}
+
+func TestParse_GitDiffSeveralFiles(t *testing.T) {
+	diff := `Some explanation before the diff.
+diff --git a/main.go b/main.go
+index 83db48f..bf269f4 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@ package main
+ package main
+--- removed comment line
++-- added line
+
+diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++hello
++world
+\ No newline at end of file
+--- old.txt	2024-01-01 00:00:00
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+	files := mustParse(t, diff)
+	if len(files) != 3 {
+		t.Fatalf("want 3 files, got %d: %+v", len(files), files)
+	}
+	if files[0].OldPath != "main.go" || files[0].NewPath != "main.go" || len(files[0].Hunks[0].Lines) != 3 {
+		t.Fatalf("main.go parsed wrong: %+v", files[0])
+	}
+	if l := files[0].Hunks[0].Lines[1]; l.Op != '-' || l.Text != "-- removed comment line" {
+		t.Fatalf("removed line starting with -- parsed as %+v", l)
+	}
+	if f := files[1]; f.OldPath != patch.DevNull || f.Path() != "new.txt" || !f.Hunks[0].NoNewlineNew {
+		t.Fatalf("new file parsed wrong: %+v", f)
+	}
+	if f := files[2]; f.NewPath != patch.DevNull || f.Path() != "old.txt" || f.Hunks[0].OldStart != 1 {
+		t.Fatalf("deletion parsed wrong: %+v", f)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for name, diff := range map[string]string{
+		"no headers": "just some text\n",
+		"bad header": "--- a/x\n+++ b/x\n@@ -x +1 @@\n-a\n",
+		"stray line": "--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n*b\n",
+		"no hunks":   "--- a/x\n+++ b/x\n",
+		"hunk first": "@@ -1 +1 @@\n-a\n+b\n",
+	} {
+		_, err := patch.Parse(diff)
+		var te safety.ToolError
+		if !errors.As(err, &te) || te.Code != "ERR_INVALID_PATCH" {
+			t.Errorf("%s: want ERR_INVALID_PATCH, got %v", name, err)
+		}
+	}
+}
+
+func TestApply_OffsetAndFuzzReported(t *testing.T) {
+	content := "inserted\n" + numbered(20)
+	diff := `--- a/f
++++ b/f
+@@ -2,3 +2,3 @@
+ line 2
+-line 3
++LINE 3
+ line 4
+@@ -10,5 +10,5 @@
+ line 10
+ stale context
+-line 12
++LINE 12
+ line 13
+ line 14
+`
+	f := mustParse(t, diff)[0]
+	// The second hunk's leading context is wrong twice over, so it needs fuzz 2.
+	f.Hunks[1].Lines[0].Text = "changed"
+	out, results, ok := f.Apply(content)
+	if !ok {
+		t.Fatalf("patch should apply: %+v", results)
+	}
+	if !strings.Contains(out, "line 2\nLINE 3\nline 4") || !strings.Contains(out, "line 11\nLINE 12\nline 13") {
+		t.Fatalf("unexpected result:\n%s", out)
+	}
+	if r := results[0]; r.Status != "applied" || r.Offset != 1 || r.Fuzz != 0 || r.Line != 3 {
+		t.Fatalf("hunk 1: want offset 1 at line 3, got %+v", r)
+	}
+	if r := results[1]; r.Status != "applied" || r.Offset != 1 || r.Fuzz != 2 {
+		t.Fatalf("hunk 2: want offset 1 with fuzz 2, got %+v", r)
+	}
+}
+
+func TestApply_FailureReportsEveryHunk(t *testing.T) {
+	diff := `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+-line 1
++LINE 1
+ line 2
+@@ -5,1 +5,1 @@
+-line five
++LINE 5
+`
+	_, results, ok := mustParse(t, diff)[0].Apply(numbered(6))
+	if ok || len(results) != 2 {
+		t.Fatalf("want a failed patch with 2 results, got ok=%v %+v", ok, results)
+	}
+	if results[0].Status != "applied" {
+		t.Fatalf("hunk 1 should still be checked and reported applied: %+v", results[0])
+	}
+	if r := results[1]; r.Status != "failed" || r.Line != 5 || r.Want != "line five" || r.Got != "line 5" || r.Error == "" {
+		t.Fatalf("hunk 2: unexpected report %+v", r)
+	}
+}
+
+func TestApply_NewlinesAndLineEndings(t *testing.T) {
+	create := mustParse(t, "--- /dev/null\n+++ b/n\n@@ -0,0 +1,2 @@\n+a\n+b\n\\ No newline at end of file\n")[0]
+	if out, _, ok := create.Apply(""); !ok || out != "a\nb" {
+		t.Fatalf("create: got %q ok=%v", out, ok)
+	}
+	addNewline := mustParse(t, "--- a/n\n+++ b/n\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n")[0]
+	if out, _, ok := addNewline.Apply("a\nb"); !ok || out != "a\nb\n" {
+		t.Fatalf("add final newline: got %q ok=%v", out, ok)
+	}
+	crlf := mustParse(t, "--- a/w\n+++ b/w\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n")[0]
+	if out, _, ok := crlf.Apply("a\r\nb\r\n"); !ok || out != "a\r\nc\r\n" {
+		t.Fatalf("crlf: got %q ok=%v", out, ok)
+	}
+}
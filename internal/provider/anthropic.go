@@ -1,7 +1,17 @@
 package provider
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
 	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
 )
 
 // NewAnthropicClient returns a client using API key from the env.
@@ -12,3 +22,161 @@ func NewAnthropicClient() *anthropic.Client {
 
 const DefaultModel = anthropic.ModelClaude3_7SonnetLatest
 const APIVersion = "2023-06-01"
+
+// Anthropic is the Provider backed by the Anthropic Messages API.
+type Anthropic struct {
+	Client *anthropic.Client
+}
+
+// NewAnthropic wraps an SDK client as a Provider.
+func NewAnthropic(client *anthropic.Client) *Anthropic {
+	return &Anthropic{Client: client}
+}
+
+func (a *Anthropic) Name() string          { return "anthropic" }
+func (a *Anthropic) APIVersion() string    { return APIVersion }
+func (a *Anthropic) SupportsPrefill() bool { return true }
+
+// SendMessage calls Messages.New, or Messages.NewStreaming when req.Stream is set.
+// SDK-level retries are disabled; the caller owns the retry policy.
+func (a *Anthropic) SendMessage(ctx context.Context, req Request) (*Response, error) {
+	if req.Stream {
+		return a.stream(ctx, req)
+	}
+
+	var raw bytes.Buffer
+	msg, err := a.Client.Messages.New(ctx, req.Params, requestOptions(req, &raw)...)
+	if err != nil {
+		return nil, wrapAnthropicError(err)
+	}
+	resp := &Response{Message: msg}
+	if req.CaptureRaw {
+		resp.RawBody = raw.Bytes()
+	}
+	return resp, nil
+}
+
+// requestOptions disables SDK retries and, when raw capture is requested, tees the
+// response body into raw so the exact wire bytes survive SDK decoding.
+func requestOptions(req Request, raw *bytes.Buffer) []option.RequestOption {
+	opts := []option.RequestOption{option.WithMaxRetries(0)}
+	if req.CaptureRaw {
+		opts = append(opts, option.WithMiddleware(func(r *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+			resp, err := next(r)
+			if err == nil && resp != nil && resp.Body != nil {
+				resp.Body = teeReadCloser{Reader: io.TeeReader(resp.Body, raw), Closer: resp.Body}
+			}
+			return resp, err
+		}))
+	}
+	return opts
+}
+
+// stream accumulates every event into a single Message so callers see the same shape
+// as a non-streaming response; tool_use inputs are reassembled from partial JSON deltas.
+func (a *Anthropic) stream(ctx context.Context, req Request) (*Response, error) {
+	var raw bytes.Buffer
+	stream := a.Client.Messages.NewStreaming(ctx, req.Params, requestOptions(req, &raw)...)
+	defer stream.Close()
+
+	msg := &anthropic.Message{}
+	started := false // whether any content block began; later failures are not retryable
+	for stream.Next() {
+		event := stream.Current()
+		if err := msg.Accumulate(event); err != nil {
+			return nil, fmt.Errorf("stream: accumulate: %w", err)
+		}
+		switch ev := event.AsAny().(type) {
+		case anthropic.ContentBlockStartEvent:
+			started = true
+			if ev.ContentBlock.Type == "text" && req.OnText != nil {
+				req.OnText(int(ev.Index), ev.ContentBlock.Text)
+			}
+		case anthropic.ContentBlockDeltaEvent:
+			if d, ok := ev.Delta.AsAny().(anthropic.TextDelta); ok && req.OnText != nil {
+				req.OnText(int(ev.Index), d.Text)
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		err = wrapAnthropicError(err)
+		if started {
+			return nil, fmt.Errorf("%w: %w", ErrPartialStream, err)
+		}
+		return nil, err
+	}
+
+	resp := &Response{Message: msg}
+	if req.CaptureRaw {
+		resp.RawStream = raw.Bytes()
+		if b, err := json.Marshal(msg); err == nil {
+			resp.RawBody = b
+		}
+	}
+	return resp, nil
+}
+
+// ListModels pages through the Models API.
+func (a *Anthropic) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var out []ModelInfo
+	pager := a.Client.Models.ListAutoPaging(ctx, anthropic.ModelListParams{})
+	for pager.Next() {
+		m := pager.Current()
+		out = append(out, ModelInfo{ID: m.ID, DisplayName: m.DisplayName, CreatedAt: m.CreatedAt})
+	}
+	if err := pager.Err(); err != nil {
+		return nil, wrapAnthropicError(err)
+	}
+	return out, nil
+}
+
+// CountTokens calls the Messages CountTokens endpoint with the countable subset of params.
+func (a *Anthropic) CountTokens(ctx context.Context, params anthropic.MessageNewParams) (int64, error) {
+	cp := anthropic.MessageCountTokensParams{
+		Model:      params.Model,
+		Messages:   params.Messages,
+		Thinking:   params.Thinking,
+		ToolChoice: params.ToolChoice,
+	}
+	if len(params.System) > 0 {
+		cp.System = anthropic.MessageCountTokensParamsSystemUnion{OfTextBlockArray: params.System}
+	}
+	for _, t := range params.Tools {
+		if t.OfTool != nil {
+			cp.Tools = append(cp.Tools, anthropic.MessageCountTokensToolUnionParam{OfTool: t.OfTool})
+		}
+	}
+	res, err := a.Client.Messages.CountTokens(ctx, cp, option.WithMaxRetries(0))
+	if err != nil {
+		return 0, wrapAnthropicError(err)
+	}
+	return res.InputTokens, nil
+}
+
+// wrapAnthropicError maps SDK errors to HTTPError. SSE error events carry no status,
+// so overloaded/api errors are mapped to 529/500 to keep them retryable.
+func wrapAnthropicError(err error) error {
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		he := &HTTPError{StatusCode: apiErr.StatusCode, Err: err}
+		if apiErr.Response != nil {
+			he.Header = apiErr.Response.Header
+		}
+		return he
+	}
+	if msg := err.Error(); strings.HasPrefix(msg, "received error while streaming") {
+		switch {
+		case strings.Contains(msg, "overloaded_error"):
+			return &HTTPError{StatusCode: 529, Err: err}
+		case strings.Contains(msg, "api_error"):
+			return &HTTPError{StatusCode: 500, Err: err}
+		}
+	}
+	return err
+}
+
+// teeReadCloser pairs a tee'd reader with the original body's Closer.
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
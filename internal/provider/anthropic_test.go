@@ -0,0 +1,167 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/petasbytes/go-agent/internal/provider"
+)
+
+// anthropicServer serves handler and returns a provider pointed at it.
+func anthropicServer(t *testing.T, handler http.HandlerFunc) *provider.Anthropic {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c := anthropic.NewClient(option.WithBaseURL(srv.URL), option.WithAPIKey("test-key"))
+	return provider.NewAnthropic(&c)
+}
+
+func userParams(text string) anthropic.MessageNewParams {
+	return anthropic.MessageNewParams{
+		Model:     provider.DefaultModel,
+		MaxTokens: 64,
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(text))},
+	}
+}
+
+const helloMessage = `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"hello"}],"usage":{"input_tokens":3,"output_tokens":1}}`
+
+func TestAnthropic_SendMessage_CapturesRawBody(t *testing.T) {
+	p := anthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, helloMessage)
+	})
+
+	resp, err := p.SendMessage(context.Background(), provider.Request{Params: userParams("hi"), CaptureRaw: true})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if resp.Message.ID != "msg_1" || len(resp.Message.Content) != 1 || resp.Message.Content[0].Text != "hello" {
+		t.Fatalf("unexpected message: %+v", resp.Message)
+	}
+	if string(resp.RawBody) != helloMessage {
+		t.Fatalf("raw body mismatch: %s", resp.RawBody)
+	}
+	if resp.RawStream != nil {
+		t.Fatalf("non-streaming call should not set RawStream")
+	}
+}
+
+func TestAnthropic_SendMessage_StreamCallsOnText(t *testing.T) {
+	body := "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_s\",\"type\":\"message\",\"role\":\"assistant\",\"content\":[],\"usage\":{\"input_tokens\":2,\"output_tokens\":1}}}\n\n" +
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n" +
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"he\"}}\n\n" +
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"llo\"}}\n\n" +
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n" +
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":5}}\n\n" +
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"
+	p := anthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, body)
+	})
+
+	var got strings.Builder
+	resp, err := p.SendMessage(context.Background(), provider.Request{
+		Params:     userParams("hi"),
+		Stream:     true,
+		CaptureRaw: true,
+		OnText:     func(_ int, d string) { got.WriteString(d) },
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got.String() != "hello" {
+		t.Fatalf("OnText got %q", got.String())
+	}
+	if resp.Message.Content[0].Text != "hello" || resp.Message.StopReason != anthropic.StopReasonEndTurn || resp.Message.Usage.OutputTokens != 5 {
+		t.Fatalf("unexpected accumulated message: %+v", resp.Message)
+	}
+	if string(resp.RawStream) != body {
+		t.Fatalf("raw stream mismatch")
+	}
+	if !strings.Contains(string(resp.RawBody), `"msg_s"`) {
+		t.Fatalf("raw body should be the accumulated message: %s", resp.RawBody)
+	}
+}
+
+func TestAnthropic_SendMessage_WrapsHTTPError(t *testing.T) {
+	p := anthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("retry-after", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = io.WriteString(w, `{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`)
+	})
+
+	_, err := p.SendMessage(context.Background(), provider.Request{Params: userParams("hi")})
+	var he *provider.HTTPError
+	if !errors.As(err, &he) {
+		t.Fatalf("expected *provider.HTTPError, got %T: %v", err, err)
+	}
+	if he.StatusCode != http.StatusTooManyRequests || he.Header.Get("retry-after") != "2" {
+		t.Fatalf("unexpected HTTPError: status=%d header=%v", he.StatusCode, he.Header)
+	}
+	var apiErr *anthropic.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("HTTPError should unwrap to the SDK error")
+	}
+}
+
+func TestAnthropic_CountTokens(t *testing.T) {
+	p := anthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages/count_tokens" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"input_tokens":42}`)
+	})
+
+	n, err := p.CountTokens(context.Background(), userParams("hi"))
+	if err != nil || n != 42 {
+		t.Fatalf("CountTokens = %d, %v; want 42", n, err)
+	}
+}
+
+func TestAnthropic_ListModels(t *testing.T) {
+	p := anthropicServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"data":[{"id":"claude-a","display_name":"A","created_at":"2025-01-01T00:00:00Z","type":"model"},{"id":"claude-b","display_name":"B","created_at":"2025-02-01T00:00:00Z","type":"model"}],"has_more":false,"first_id":"claude-a","last_id":"claude-b"}`)
+	})
+
+	models, err := p.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(models) != 2 || models[0].ID != "claude-a" || models[1].DisplayName != "B" {
+		t.Fatalf("unexpected models: %+v", models)
+	}
+}
+
+func TestFromEnv_SelectsProvider(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+
+	t.Setenv("AGT_PROVIDER", "")
+	p, err := provider.FromEnv()
+	if err != nil || p.Name() != "anthropic" {
+		t.Fatalf("default provider: got %v, %v", p, err)
+	}
+
+	t.Setenv("AGT_PROVIDER", "nope")
+	if _, err := provider.FromEnv(); err == nil || !strings.Contains(err.Error(), "unknown provider") {
+		t.Fatalf("expected unknown provider error, got %v", err)
+	}
+
+	t.Setenv("AGT_PROVIDER", "anthropic")
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	if _, err := provider.FromEnv(); err == nil || !strings.Contains(err.Error(), "ANTHROPIC_API_KEY") {
+		t.Fatalf("expected missing key error, got %v", err)
+	}
+}
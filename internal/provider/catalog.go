@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// DefaultMaxOutputTokens caps the default MaxTokens of a request. Larger values make
+// the Anthropic SDK require streaming, and most replies are far shorter.
+const DefaultMaxOutputTokens = 8192
+
+// ModelSpec describes a model's limits, pricing and capabilities.
+type ModelSpec struct {
+	ID       string   // canonical model id sent to the API
+	Aliases  []string // other names accepted by AGT_MODEL
+	Provider string   // backend that serves the model ("anthropic", "openai")
+
+	ContextWindow   int // input plus output tokens
+	MaxOutputTokens int
+
+	// USD per million tokens.
+	InputPrice  float64
+	OutputPrice float64
+
+	Tools    bool // tool use
+	Thinking bool // extended thinking
+	Images   bool // image input
+}
+
+// Catalog lists the models the agent knows the limits of. Models outside it can be
+// described with AGT_CONTEXT_WINDOW (see ModelFromEnv).
+var Catalog = []ModelSpec{
+	{ID: "claude-opus-4-1-20250805", Aliases: []string{"claude-opus-4-1", "opus"}, Provider: "anthropic",
+		ContextWindow: 200_000, MaxOutputTokens: 32_000, InputPrice: 15, OutputPrice: 75, Tools: true, Thinking: true, Images: true},
+	{ID: "claude-opus-4-20250514", Aliases: []string{"claude-opus-4-0", "claude-4-opus-20250514"}, Provider: "anthropic",
+		ContextWindow: 200_000, MaxOutputTokens: 32_000, InputPrice: 15, OutputPrice: 75, Tools: true, Thinking: true, Images: true},
+	{ID: "claude-sonnet-4-20250514", Aliases: []string{"claude-sonnet-4-0", "claude-4-sonnet-20250514", "sonnet"}, Provider: "anthropic",
+		ContextWindow: 200_000, MaxOutputTokens: 64_000, InputPrice: 3, OutputPrice: 15, Tools: true, Thinking: true, Images: true},
+	{ID: "claude-3-7-sonnet-20250219", Aliases: []string{"claude-3-7-sonnet-latest"}, Provider: "anthropic",
+		ContextWindow: 200_000, MaxOutputTokens: 64_000, InputPrice: 3, OutputPrice: 15, Tools: true, Thinking: true, Images: true},
+	{ID: "claude-3-5-sonnet-20241022", Aliases: []string{"claude-3-5-sonnet-latest"}, Provider: "anthropic",
+		ContextWindow: 200_000, MaxOutputTokens: 8192, InputPrice: 3, OutputPrice: 15, Tools: true, Images: true},
+	{ID: "claude-3-5-sonnet-20240620", Provider: "anthropic",
+		ContextWindow: 200_000, MaxOutputTokens: 8192, InputPrice: 3, OutputPrice: 15, Tools: true, Images: true},
+	{ID: "claude-3-5-haiku-20241022", Aliases: []string{"claude-3-5-haiku-latest", "haiku"}, Provider: "anthropic",
+		ContextWindow: 200_000, MaxOutputTokens: 8192, InputPrice: 0.8, OutputPrice: 4, Tools: true},
+	{ID: "claude-3-opus-20240229", Aliases: []string{"claude-3-opus-latest"}, Provider: "anthropic",
+		ContextWindow: 200_000, MaxOutputTokens: 4096, InputPrice: 15, OutputPrice: 75, Tools: true, Images: true},
+	{ID: "claude-3-haiku-20240307", Provider: "anthropic",
+		ContextWindow: 200_000, MaxOutputTokens: 4096, InputPrice: 0.25, OutputPrice: 1.25, Tools: true, Images: true},
+	{ID: "gpt-4.1", Provider: "openai",
+		ContextWindow: 1_047_576, MaxOutputTokens: 32_768, InputPrice: 2, OutputPrice: 8, Tools: true, Images: true},
+	{ID: "gpt-4.1-mini", Provider: "openai",
+		ContextWindow: 1_047_576, MaxOutputTokens: 32_768, InputPrice: 0.4, OutputPrice: 1.6, Tools: true, Images: true},
+	{ID: "gpt-4o", Provider: "openai",
+		ContextWindow: 128_000, MaxOutputTokens: 16_384, InputPrice: 2.5, OutputPrice: 10, Tools: true, Images: true},
+	{ID: "gpt-4o-mini", Provider: "openai",
+		ContextWindow: 128_000, MaxOutputTokens: 16_384, InputPrice: 0.15, OutputPrice: 0.6, Tools: true, Images: true},
+}
+
+// LookupModel finds a catalog model by id or alias (case-insensitive).
+func LookupModel(name string) (ModelSpec, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, m := range Catalog {
+		if m.ID == name || slices.Contains(m.Aliases, name) {
+			return m, true
+		}
+	}
+	return ModelSpec{}, false
+}
+
+// DefaultMaxTokens is the MaxTokens used when AGT_MAX_TOKENS is unset.
+func (m ModelSpec) DefaultMaxTokens() int64 {
+	return int64(min(m.MaxOutputTokens, DefaultMaxOutputTokens))
+}
+
+// InputBudget is the room left for input once maxTokens of output are reserved.
+func (m ModelSpec) InputBudget(maxTokens int64) int {
+	return m.ContextWindow - int(maxTokens)
+}
+
+// Cost returns the USD price of the given usage.
+func (m ModelSpec) Cost(inputTokens, outputTokens int64) float64 {
+	return (float64(inputTokens)*m.InputPrice + float64(outputTokens)*m.OutputPrice) / 1e6
+}
+
+// Validate reports requests the model cannot serve: MaxTokens beyond its output
+// limit, or tools, thinking or images it does not support.
+func (m ModelSpec) Validate(params anthropic.MessageNewParams) error {
+	if params.MaxTokens <= 0 || params.MaxTokens > int64(m.MaxOutputTokens) {
+		return fmt.Errorf("model %s: max_tokens %d out of range (1-%d)", m.ID, params.MaxTokens, m.MaxOutputTokens)
+	}
+	if len(params.Tools) > 0 && !m.Tools {
+		return fmt.Errorf("model %s does not support tool use", m.ID)
+	}
+	if params.Thinking.OfEnabled != nil && !m.Thinking {
+		return fmt.Errorf("model %s does not support extended thinking", m.ID)
+	}
+	if !m.Images {
+		for _, msg := range params.Messages {
+			for _, b := range msg.Content {
+				if b.OfImage != nil {
+					return fmt.Errorf("model %s does not accept image input", m.ID)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ModelFromEnv resolves AGT_MODEL (an id or alias from Catalog) for provider p,
+// defaulting to DefaultModel for the default provider. A model outside the catalog
+// is rejected unless AGT_CONTEXT_WINDOW gives its context window; its output limit
+// is then AGT_MAX_TOKENS (default DefaultMaxOutputTokens) and tool use is assumed.
+func ModelFromEnv(p Provider) (ModelSpec, error) {
+	name := strings.TrimSpace(os.Getenv("AGT_MODEL"))
+	if name == "" {
+		if p.Name() != DefaultProvider {
+			return ModelSpec{}, fmt.Errorf("missing AGT_MODEL; required with AGT_PROVIDER=%s", p.Name())
+		}
+		name = string(DefaultModel)
+	}
+	if m, ok := LookupModel(name); ok {
+		return m, nil
+	}
+	v := strings.TrimSpace(os.Getenv("AGT_CONTEXT_WINDOW"))
+	if v == "" {
+		return ModelSpec{}, fmt.Errorf("unknown model %q: pick one of `agent models` or set AGT_CONTEXT_WINDOW to describe it", name)
+	}
+	window, err := strconv.Atoi(v)
+	if err != nil || window <= 0 {
+		return ModelSpec{}, fmt.Errorf("invalid AGT_CONTEXT_WINDOW %q: want a positive number of tokens", v)
+	}
+	out := DefaultMaxOutputTokens
+	if v := strings.TrimSpace(os.Getenv("AGT_MAX_TOKENS")); v != "" {
+		if out, err = strconv.Atoi(v); err != nil || out <= 0 || out >= window {
+			return ModelSpec{}, fmt.Errorf("invalid AGT_MAX_TOKENS %q: want a positive number below AGT_CONTEXT_WINDOW", v)
+		}
+	}
+	return ModelSpec{ID: name, Provider: p.Name(), ContextWindow: window, MaxOutputTokens: out, Tools: true}, nil
+}
@@ -0,0 +1,110 @@
+package provider_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+)
+
+func TestLookupModel_ByIDAndAlias(t *testing.T) {
+	def, ok := provider.LookupModel(string(provider.DefaultModel))
+	if !ok || def.ContextWindow == 0 || def.MaxOutputTokens == 0 || !def.Tools {
+		t.Fatalf("DefaultModel must be in the catalog: %+v", def)
+	}
+	if m, ok := provider.LookupModel(" Sonnet "); !ok || m.ID != "claude-sonnet-4-20250514" {
+		t.Fatalf("alias lookup = %+v, %v", m, ok)
+	}
+	if _, ok := provider.LookupModel("claude-test"); ok {
+		t.Fatal("unexpected catalog hit")
+	}
+	seen := map[string]bool{}
+	for _, m := range provider.Catalog {
+		for _, name := range append([]string{m.ID}, m.Aliases...) {
+			if seen[name] {
+				t.Errorf("duplicate catalog name %q", name)
+			}
+			seen[name] = true
+		}
+		if m.MaxOutputTokens >= m.ContextWindow || m.Provider == "" {
+			t.Errorf("implausible spec %+v", m)
+		}
+	}
+}
+
+func TestModelSpec_DefaultsAndCost(t *testing.T) {
+	m, _ := provider.LookupModel("claude-3-haiku-20240307")
+	if m.DefaultMaxTokens() != 4096 || m.InputBudget(4096) != 200_000-4096 {
+		t.Fatalf("unexpected defaults: %d, %d", m.DefaultMaxTokens(), m.InputBudget(4096))
+	}
+	if s, _ := provider.LookupModel("sonnet"); s.DefaultMaxTokens() != provider.DefaultMaxOutputTokens {
+		t.Fatalf("default max tokens should be capped at %d", provider.DefaultMaxOutputTokens)
+	}
+	if got := m.Cost(1_000_000, 2_000_000); got != 0.25+2.5 {
+		t.Fatalf("Cost = %v", got)
+	}
+}
+
+func TestModelSpec_Validate(t *testing.T) {
+	haiku, _ := provider.LookupModel("haiku") // no image input
+	ok := anthropic.MessageNewParams{MaxTokens: 1024, Messages: []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("hi"))}}
+	if err := haiku.Validate(ok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tooLong := ok
+	tooLong.MaxTokens = 9000
+	if err := haiku.Validate(tooLong); err == nil || !strings.Contains(err.Error(), "max_tokens") {
+		t.Fatalf("want max_tokens error, got %v", err)
+	}
+	image := ok
+	image.Messages = []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewImageBlockBase64("image/png", "AAAA"))}
+	if err := haiku.Validate(image); err == nil {
+		t.Fatal("want image error")
+	}
+	thinking := ok
+	thinking.Thinking = anthropic.ThinkingConfigParamOfEnabled(1024)
+	if err := haiku.Validate(thinking); err == nil {
+		t.Fatal("want thinking error")
+	}
+	noTools := provider.ModelSpec{ID: "local", MaxOutputTokens: 2048}
+	withTools := ok
+	withTools.Tools = []anthropic.ToolUnionParam{{OfTool: &anthropic.ToolParam{Name: "read_file"}}}
+	if err := noTools.Validate(withTools); err == nil {
+		t.Fatal("want tools error")
+	}
+}
+
+func TestModelFromEnv(t *testing.T) {
+	anth := provider.NewAnthropic(provider.NewAnthropicClient())
+	openai := provider.NewOpenAI("http://localhost:1", "")
+
+	t.Setenv("AGT_MODEL", "")
+	if m, err := provider.ModelFromEnv(anth); err != nil || m.ID != "claude-3-7-sonnet-20250219" {
+		t.Fatalf("default model = %+v, %v", m, err)
+	}
+	if _, err := provider.ModelFromEnv(openai); err == nil {
+		t.Fatal("openai requires AGT_MODEL")
+	}
+
+	t.Setenv("AGT_MODEL", "opus")
+	if m, err := provider.ModelFromEnv(anth); err != nil || m.ID != "claude-opus-4-1-20250805" {
+		t.Fatalf("alias = %+v, %v", m, err)
+	}
+
+	t.Setenv("AGT_MODEL", "llama3")
+	t.Setenv("AGT_CONTEXT_WINDOW", "")
+	if _, err := provider.ModelFromEnv(openai); err == nil || !strings.Contains(err.Error(), "unknown model") {
+		t.Fatalf("want unknown model error, got %v", err)
+	}
+	t.Setenv("AGT_CONTEXT_WINDOW", "8192")
+	t.Setenv("AGT_MAX_TOKENS", "1024")
+	m, err := provider.ModelFromEnv(openai)
+	if err != nil || m.ID != "llama3" || m.ContextWindow != 8192 || m.MaxOutputTokens != 1024 || m.Provider != "openai" {
+		t.Fatalf("custom model = %+v, %v", m, err)
+	}
+	t.Setenv("AGT_MAX_TOKENS", "9000")
+	if _, err := provider.ModelFromEnv(openai); err == nil {
+		t.Fatal("want error for max tokens beyond the context window")
+	}
+}
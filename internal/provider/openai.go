@@ -0,0 +1,557 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// DefaultOpenAIBaseURL is used when OPENAI_BASE_URL is unset.
+const DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAI is the Provider for OpenAI-compatible Chat Completions endpoints (OpenAI,
+// vLLM, llama.cpp server, LM Studio). Conversations, tool definitions and
+// tool_use/tool_result pairs are translated to and from the tools/tool_calls format.
+type OpenAI struct {
+	BaseURL    string // e.g. http://localhost:8000/v1; /chat/completions is appended
+	APIKey     string // sent as a bearer token when non-empty; local servers often need none
+	HTTPClient *http.Client
+}
+
+// NewOpenAI returns a provider for the Chat Completions API at baseURL.
+func NewOpenAI(baseURL, apiKey string) *OpenAI {
+	return &OpenAI{BaseURL: strings.TrimRight(baseURL, "/"), APIKey: apiKey, HTTPClient: http.DefaultClient}
+}
+
+func (o *OpenAI) Name() string       { return "openai" }
+func (o *OpenAI) APIVersion() string { return "v1" }
+
+// SupportsPrefill is false: Chat Completions answers a trailing assistant message
+// with a new reply instead of continuing it.
+func (o *OpenAI) SupportsPrefill() bool { return false }
+
+// SendMessage performs one Chat Completions call and converts the reply to an
+// Anthropic-shaped Message.
+func (o *OpenAI) SendMessage(ctx context.Context, req Request) (*Response, error) {
+	body, err := json.Marshal(toChatRequest(req.Params, req.Stream))
+	if err != nil {
+		return nil, fmt.Errorf("openai: encode request: %w", err)
+	}
+	httpResp, err := o.do(ctx, http.MethodPost, "/chat/completions", body)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if req.Stream {
+		return o.stream(httpResp.Body, req)
+	}
+
+	raw, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("openai: read response: %w", err)
+	}
+	var cr chatResponse
+	if err := json.Unmarshal(raw, &cr); err != nil {
+		return nil, fmt.Errorf("openai: decode response: %w", err)
+	}
+	if len(cr.Choices) == 0 {
+		return nil, fmt.Errorf("openai: response has no choices")
+	}
+	ch := cr.Choices[0]
+	msg, err := toAnthropicMessage(cr.ID, cr.Model, ch.Message.Content, ch.Message.ToolCalls, ch.FinishReason, cr.Usage)
+	if err != nil {
+		return nil, err
+	}
+	resp := &Response{Message: msg}
+	if req.CaptureRaw {
+		resp.RawBody = raw
+	}
+	return resp, nil
+}
+
+// stream reads server-sent chat.completion.chunk events until [DONE], forwarding
+// content deltas to OnText and stitching tool_call argument fragments by index.
+func (o *OpenAI) stream(body io.Reader, req Request) (*Response, error) {
+	var raw bytes.Buffer
+	if req.CaptureRaw {
+		body = io.TeeReader(body, &raw)
+	}
+
+	var (
+		id, model, finish string
+		text              strings.Builder
+		calls             = map[int]*chatToolCall{}
+		usage             chatUsage
+		started           bool // whether any content was delivered; later failures are not retryable
+	)
+	fail := func(err error) (*Response, error) {
+		if started {
+			return nil, fmt.Errorf("%w: %w", ErrPartialStream, err)
+		}
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	done := false
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue // blank separators, comments, event: lines
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk chatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fail(fmt.Errorf("openai: decode stream chunk: %w", err))
+		}
+		if chunk.Error != nil {
+			return fail(chunk.Error.asHTTPError())
+		}
+		if chunk.ID != "" {
+			id = chunk.ID
+		}
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		}
+		for _, ch := range chunk.Choices {
+			if ch.Delta.Content != "" {
+				started = true
+				text.WriteString(ch.Delta.Content)
+				if req.OnText != nil {
+					req.OnText(0, ch.Delta.Content)
+				}
+			}
+			for _, tc := range ch.Delta.ToolCalls {
+				started = true
+				c, ok := calls[tc.Index]
+				if !ok {
+					c = &chatToolCall{Type: "function"}
+					calls[tc.Index] = c
+				}
+				if tc.ID != "" {
+					c.ID = tc.ID
+				}
+				c.Function.Name += tc.Function.Name
+				c.Function.Arguments += tc.Function.Arguments
+			}
+			if ch.FinishReason != "" {
+				finish = ch.FinishReason
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fail(fmt.Errorf("openai: read stream: %w", err))
+	}
+	if !done && finish == "" {
+		return fail(fmt.Errorf("openai: read stream: %w", io.ErrUnexpectedEOF))
+	}
+
+	idx := make([]int, 0, len(calls))
+	for i := range calls {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	toolCalls := make([]chatToolCall, 0, len(idx))
+	for _, i := range idx {
+		toolCalls = append(toolCalls, *calls[i])
+	}
+
+	msg, err := toAnthropicMessage(id, model, text.String(), toolCalls, finish, usage)
+	if err != nil {
+		return nil, err
+	}
+	resp := &Response{Message: msg}
+	if req.CaptureRaw {
+		resp.RawStream = raw.Bytes()
+		if b, err := json.Marshal(msg); err == nil {
+			resp.RawBody = b
+		}
+	}
+	return resp, nil
+}
+
+// ListModels calls GET /models.
+func (o *OpenAI) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	httpResp, err := o.do(ctx, http.MethodGet, "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	var out struct {
+		Data []struct {
+			ID      string `json:"id"`
+			Created int64  `json:"created"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(httpResp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("openai: decode models: %w", err)
+	}
+	models := make([]ModelInfo, 0, len(out.Data))
+	for _, m := range out.Data {
+		mi := ModelInfo{ID: m.ID, DisplayName: m.ID}
+		if m.Created > 0 {
+			mi.CreatedAt = time.Unix(m.Created, 0).UTC()
+		}
+		models = append(models, mi)
+	}
+	return models, nil
+}
+
+// CountTokens is not part of the Chat Completions API.
+func (o *OpenAI) CountTokens(ctx context.Context, params anthropic.MessageNewParams) (int64, error) {
+	return 0, fmt.Errorf("openai: count tokens: %w", ErrUnsupported)
+}
+
+// do sends a request and converts non-2xx responses to *HTTPError.
+func (o *OpenAI) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, o.BaseURL+path, rd)
+	if err != nil {
+		return nil, fmt.Errorf("openai: build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+	hc := o.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("openai: %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &HTTPError{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Err:        fmt.Errorf("openai: %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(b))),
+		}
+	}
+	return resp, nil
+}
+
+// Chat Completions wire types (the subset used here).
+
+type chatRequest struct {
+	Model         string         `json:"model"`
+	Messages      []chatMessage  `json:"messages"`
+	MaxTokens     int64          `json:"max_tokens,omitempty"`
+	Temperature   *float64       `json:"temperature,omitempty"`
+	Stop          []string       `json:"stop,omitempty"`
+	Tools         []chatTool     `json:"tools,omitempty"`
+	ToolChoice    any            `json:"tool_choice,omitempty"` // "none", "auto", "required" or a chatToolChoice
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    *string        `json:"content"` // null for assistant messages with only tool_calls
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type chatTool struct {
+	Type     string       `json:"type"`
+	Function chatFunction `json:"function"`
+}
+
+// chatToolChoice forces a call to one named function.
+type chatToolChoice struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+	} `json:"function"`
+}
+
+type chatFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type chatToolCall struct {
+	Index    int    `json:"index,omitempty"` // streaming deltas only
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+type chatResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content   string         `json:"content"`
+			ToolCalls []chatToolCall `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage chatUsage `json:"usage"`
+}
+
+type chatChunk struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content   string         `json:"content"`
+			ToolCalls []chatToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatUsage `json:"usage"`
+	Error *chatError `json:"error"`
+}
+
+// chatError is an error object delivered inside a stream.
+type chatError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    any    `json:"code"`
+}
+
+func (e *chatError) asHTTPError() error {
+	status := http.StatusInternalServerError
+	if n, ok := e.Code.(float64); ok && n >= 400 {
+		status = int(n)
+	}
+	return &HTTPError{StatusCode: status, Err: fmt.Errorf("openai: stream error: %s %s", e.Type, e.Message)}
+}
+
+// toChatRequest translates Anthropic params: system blocks become a system message,
+// tool_use blocks become assistant tool_calls, and each tool_result becomes a
+// role "tool" message placed before any text in the same user turn.
+func toChatRequest(p anthropic.MessageNewParams, stream bool) chatRequest {
+	cr := chatRequest{Model: string(p.Model), MaxTokens: p.MaxTokens, Stop: p.StopSequences, Stream: stream}
+	if stream {
+		cr.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	if p.Temperature.Valid() {
+		t := p.Temperature.Value
+		cr.Temperature = &t
+	}
+
+	if len(p.System) > 0 {
+		parts := make([]string, 0, len(p.System))
+		for _, b := range p.System {
+			parts = append(parts, b.Text)
+		}
+		cr.Messages = append(cr.Messages, textMessage("system", strings.Join(parts, "\n\n")))
+	}
+
+	for _, m := range p.Messages {
+		var (
+			texts []string
+			calls []chatToolCall
+			tools []chatMessage
+		)
+		for _, b := range m.Content {
+			switch {
+			case b.OfText != nil:
+				texts = append(texts, b.OfText.Text)
+			case b.OfToolUse != nil:
+				args, err := json.Marshal(b.OfToolUse.Input)
+				if err != nil || string(args) == "null" {
+					args = []byte("{}")
+				}
+				c := chatToolCall{ID: b.OfToolUse.ID, Type: "function"}
+				c.Function.Name = b.OfToolUse.Name
+				c.Function.Arguments = string(args)
+				calls = append(calls, c)
+			case b.OfToolResult != nil:
+				tm := textMessage("tool", toolResultText(b.OfToolResult))
+				tm.ToolCallID = b.OfToolResult.ToolUseID
+				tools = append(tools, tm)
+			}
+		}
+
+		if m.Role == anthropic.MessageParamRoleAssistant {
+			am := chatMessage{Role: "assistant", ToolCalls: calls}
+			if len(texts) > 0 {
+				s := strings.Join(texts, "\n")
+				am.Content = &s
+			}
+			cr.Messages = append(cr.Messages, am)
+			continue
+		}
+		cr.Messages = append(cr.Messages, tools...)
+		if len(texts) > 0 {
+			cr.Messages = append(cr.Messages, textMessage("user", strings.Join(texts, "\n")))
+		}
+	}
+
+	for _, t := range p.Tools {
+		if t.OfTool == nil {
+			continue
+		}
+		schema, err := json.Marshal(t.OfTool.InputSchema)
+		if err != nil {
+			schema = nil
+		}
+		cr.Tools = append(cr.Tools, chatTool{
+			Type: "function",
+			Function: chatFunction{
+				Name:        t.OfTool.Name,
+				Description: t.OfTool.Description.Value,
+				Parameters:  schema,
+			},
+		})
+	}
+	if len(cr.Tools) > 0 {
+		cr.ToolChoice = toChatToolChoice(p.ToolChoice)
+	}
+	return cr
+}
+
+// toChatToolChoice maps tool_choice: none and auto carry over, any becomes
+// "required" and a named tool a function choice. Unset leaves the server default.
+func toChatToolChoice(tc anthropic.ToolChoiceUnionParam) any {
+	switch {
+	case tc.OfNone != nil:
+		return "none"
+	case tc.OfAuto != nil:
+		return "auto"
+	case tc.OfAny != nil:
+		return "required"
+	case tc.OfTool != nil:
+		c := chatToolChoice{Type: "function"}
+		c.Function.Name = tc.OfTool.Name
+		return c
+	}
+	return nil
+}
+
+func textMessage(role, text string) chatMessage {
+	return chatMessage{Role: role, Content: &text}
+}
+
+// toolResultText flattens a tool_result's text blocks; errors are marked so the
+// model can tell them apart without the is_error flag.
+func toolResultText(tr *anthropic.ToolResultBlockParam) string {
+	var parts []string
+	for _, c := range tr.Content {
+		if c.OfText != nil {
+			parts = append(parts, c.OfText.Text)
+		}
+	}
+	s := strings.Join(parts, "\n")
+	if tr.IsError.Valid() && tr.IsError.Value {
+		s = "error: " + s
+	}
+	return s
+}
+
+// toAnthropicMessage builds the Anthropic JSON shape and decodes it, so union
+// accessors (AsAny, ToParam) behave as for a native response.
+func toAnthropicMessage(id, model, text string, calls []chatToolCall, finish string, usage chatUsage) (*anthropic.Message, error) {
+	type block struct {
+		Type  string          `json:"type"`
+		Text  *string         `json:"text,omitempty"`
+		ID    string          `json:"id,omitempty"`
+		Name  string          `json:"name,omitempty"`
+		Input json.RawMessage `json:"input,omitempty"`
+	}
+	content := []block{}
+	if text != "" {
+		content = append(content, block{Type: "text", Text: &text})
+	}
+	prefix := "" // for calls without ids, which some local servers omit
+	for i, c := range calls {
+		callID := c.ID
+		if callID == "" {
+			if prefix == "" {
+				// Random, so ids stay unique across the turns of a conversation.
+				prefix = "call_" + rand.Text()[:12]
+			}
+			callID = fmt.Sprintf("%s_%d", prefix, i)
+		}
+		content = append(content, block{Type: "tool_use", ID: callID, Name: c.Function.Name, Input: toolInput(c.Function.Arguments)})
+	}
+
+	stop := "end_turn"
+	switch finish {
+	case "tool_calls", "function_call":
+		stop = "tool_use"
+	case "length":
+		stop = "max_tokens"
+	}
+	if len(calls) > 0 && finish != "length" {
+		// Some servers report "stop" alongside tool_calls; a "length" stop keeps
+		// max_tokens so the runner sees the last call's arguments were cut off.
+		stop = "tool_use"
+	}
+
+	b, err := json.Marshal(map[string]any{
+		"id":          id,
+		"type":        "message",
+		"role":        "assistant",
+		"model":       model,
+		"content":     content,
+		"stop_reason": stop,
+		"usage": map[string]int64{
+			"input_tokens":  usage.PromptTokens,
+			"output_tokens": usage.CompletionTokens,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("openai: encode message: %w", err)
+	}
+	var msg anthropic.Message
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return nil, fmt.Errorf("openai: decode message: %w", err)
+	}
+	return &msg, nil
+}
+
+// toolInput returns arguments as a JSON object. Malformed arguments (common with
+// small local models) are passed through as a JSON string so the tool reports the error.
+func toolInput(args string) json.RawMessage {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return json.RawMessage("{}")
+	}
+	if json.Valid([]byte(args)) {
+		return json.RawMessage(args)
+	}
+	b, _ := json.Marshal(args)
+	return b
+}
@@ -0,0 +1,311 @@
+package provider_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+// chatStub records the last request body and serves reply for /chat/completions.
+func chatStub(t *testing.T, reply func(w http.ResponseWriter)) (*provider.OpenAI, *[]byte) {
+	t.Helper()
+	var last []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		last, _ = io.ReadAll(r.Body)
+		reply(w)
+	}))
+	t.Cleanup(srv.Close)
+	return provider.NewOpenAI(srv.URL+"/v1", "sk-test"), &last
+}
+
+// toolPairConversation is user text, assistant text+tool_use, user tool_result.
+func toolPairConversation() anthropic.MessageNewParams {
+	return anthropic.MessageNewParams{
+		Model:     "local-model",
+		MaxTokens: 256,
+		System:    []anthropic.TextBlockParam{{Text: "be brief"}},
+		Messages: []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock("list files")),
+			anthropic.NewAssistantMessage(
+				anthropic.NewTextBlock("Looking."),
+				anthropic.NewToolUseBlock("call_1", json.RawMessage(`{"path":"."}`), "list_files"),
+			),
+			anthropic.NewUserMessage(anthropic.NewToolResultBlock("call_1", `["a.go"]`, false)),
+		},
+		Tools: []anthropic.ToolUnionParam{{OfTool: &anthropic.ToolParam{
+			Name:        tools.ListFilesDefinition.Name,
+			Description: anthropic.String(tools.ListFilesDefinition.Description),
+			InputSchema: tools.ListFilesDefinition.InputSchema,
+		}}},
+	}
+}
+
+func TestOpenAI_TranslatesRequest(t *testing.T) {
+	p, last := chatStub(t, func(w http.ResponseWriter) {
+		_, _ = io.WriteString(w, `{"id":"c1","model":"local-model","choices":[{"message":{"role":"assistant","content":"done"},"finish_reason":"stop"}],"usage":{"prompt_tokens":9,"completion_tokens":2}}`)
+	})
+	if _, err := p.SendMessage(context.Background(), provider.Request{Params: toolPairConversation()}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	var req struct {
+		Model     string `json:"model"`
+		MaxTokens int    `json:"max_tokens"`
+		Messages  []struct {
+			Role       string  `json:"role"`
+			Content    *string `json:"content"`
+			ToolCallID string  `json:"tool_call_id"`
+			ToolCalls  []struct {
+				ID       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"messages"`
+		Tools []struct {
+			Type     string `json:"type"`
+			Function struct {
+				Name       string         `json:"name"`
+				Parameters map[string]any `json:"parameters"`
+			} `json:"function"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal(*last, &req); err != nil {
+		t.Fatalf("invalid request json: %v\n%s", err, *last)
+	}
+	if req.Model != "local-model" || req.MaxTokens != 256 {
+		t.Fatalf("model/max_tokens not forwarded: %s", *last)
+	}
+
+	roles := []string{}
+	for _, m := range req.Messages {
+		roles = append(roles, m.Role)
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,tool" {
+		t.Fatalf("unexpected roles %v", roles)
+	}
+	if *req.Messages[0].Content != "be brief" {
+		t.Errorf("system content = %q", *req.Messages[0].Content)
+	}
+	asst := req.Messages[2]
+	if asst.Content == nil || *asst.Content != "Looking." || len(asst.ToolCalls) != 1 {
+		t.Fatalf("unexpected assistant message: %+v", asst)
+	}
+	tc := asst.ToolCalls[0]
+	if tc.ID != "call_1" || tc.Type != "function" || tc.Function.Name != "list_files" || tc.Function.Arguments != `{"path":"."}` {
+		t.Errorf("unexpected tool_call: %+v", tc)
+	}
+	if tool := req.Messages[3]; tool.ToolCallID != "call_1" || *tool.Content != `["a.go"]` {
+		t.Errorf("unexpected tool message: %+v", tool)
+	}
+
+	if len(req.Tools) != 1 || req.Tools[0].Type != "function" || req.Tools[0].Function.Name != "list_files" {
+		t.Fatalf("unexpected tools: %+v", req.Tools)
+	}
+	if props, ok := req.Tools[0].Function.Parameters["properties"].(map[string]any); !ok || props["path"] == nil {
+		t.Errorf("tool parameters should carry the input schema: %v", req.Tools[0].Function.Parameters)
+	}
+}
+
+func TestOpenAI_MapsToolChoice(t *testing.T) {
+	p, last := chatStub(t, func(w http.ResponseWriter) {
+		_, _ = io.WriteString(w, `{"id":"c1","model":"local-model","choices":[{"message":{"role":"assistant","content":"done"},"finish_reason":"stop"}]}`)
+	})
+	for _, tc := range []struct {
+		choice anthropic.ToolChoiceUnionParam
+		want   string
+	}{
+		{anthropic.ToolChoiceUnionParam{}, ``}, // omitted: server default
+		{anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}, `"none"`},
+		{anthropic.ToolChoiceUnionParam{OfAuto: &anthropic.ToolChoiceAutoParam{}}, `"auto"`},
+		{anthropic.ToolChoiceUnionParam{OfAny: &anthropic.ToolChoiceAnyParam{}}, `"required"`},
+		{anthropic.ToolChoiceUnionParam{OfTool: &anthropic.ToolChoiceToolParam{Name: "list_files"}}, `{"type":"function","function":{"name":"list_files"}}`},
+	} {
+		params := toolPairConversation()
+		params.ToolChoice = tc.choice
+		if _, err := p.SendMessage(context.Background(), provider.Request{Params: params}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		var body struct {
+			ToolChoice json.RawMessage `json:"tool_choice"`
+		}
+		_ = json.Unmarshal(*last, &body)
+		if got := string(body.ToolChoice); got != tc.want {
+			t.Errorf("tool_choice = %s, want %s", got, tc.want)
+		}
+	}
+}
+
+func TestOpenAI_ToolCallsBecomeToolUse(t *testing.T) {
+	p, _ := chatStub(t, func(w http.ResponseWriter) {
+		_, _ = io.WriteString(w, `{"id":"c2","model":"local-model","choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_9","type":"function","function":{"name":"read_file","arguments":"{\"path\":\"a.go\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":30,"completion_tokens":12}}`)
+	})
+	resp, err := p.SendMessage(context.Background(), provider.Request{Params: toolPairConversation()})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	msg := resp.Message
+	if msg.StopReason != anthropic.StopReasonToolUse || msg.Usage.InputTokens != 30 || msg.Usage.OutputTokens != 12 {
+		t.Fatalf("unexpected message metadata: %+v", msg)
+	}
+	if len(msg.Content) != 1 {
+		t.Fatalf("want 1 block, got %d", len(msg.Content))
+	}
+	tu, ok := msg.Content[0].AsAny().(anthropic.ToolUseBlock)
+	if !ok || tu.ID != "call_9" || tu.Name != "read_file" || string(tu.Input) != `{"path":"a.go"}` {
+		t.Fatalf("unexpected tool_use block: %+v", msg.Content[0])
+	}
+	// Round-trips back into a conversation param.
+	if p := msg.ToParam(); len(p.Content) != 1 || p.Content[0].OfToolUse == nil {
+		t.Fatalf("ToParam lost the tool_use block: %+v", p)
+	}
+}
+
+func TestOpenAI_MissingToolCallIDsAreUniqueAcrossTurns(t *testing.T) {
+	p, _ := chatStub(t, func(w http.ResponseWriter) {
+		_, _ = io.WriteString(w, `{"model":"local-model","choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"type":"function","function":{"name":"read_file","arguments":"{}"}},{"type":"function","function":{"name":"list_files","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`)
+	})
+	seen := map[string]bool{}
+	for turn := 1; turn <= 2; turn++ {
+		resp, err := p.SendMessage(context.Background(), provider.Request{Params: toolPairConversation()})
+		if err != nil {
+			t.Fatalf("turn %d: unexpected err: %v", turn, err)
+		}
+		for _, blk := range resp.Message.Content {
+			tu, ok := blk.AsAny().(anthropic.ToolUseBlock)
+			if !ok || tu.ID == "" || seen[tu.ID] {
+				t.Fatalf("turn %d: missing or reused tool_use id in %+v", turn, blk)
+			}
+			seen[tu.ID] = true
+		}
+	}
+	if len(seen) != 4 {
+		t.Fatalf("want 4 distinct ids, got %v", seen)
+	}
+}
+
+func TestOpenAI_TruncatedToolCallKeepsMaxTokens(t *testing.T) {
+	p, _ := chatStub(t, func(w http.ResponseWriter) {
+		_, _ = io.WriteString(w, `{"id":"c3","model":"local-model","choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_9","type":"function","function":{"name":"edit_file","arguments":"{\"path\":\"a.go\",\"new_str"}}]},"finish_reason":"length"}],"usage":{"prompt_tokens":30,"completion_tokens":256}}`)
+	})
+	resp, err := p.SendMessage(context.Background(), provider.Request{Params: toolPairConversation()})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	msg := resp.Message
+	if msg.StopReason != anthropic.StopReasonMaxTokens {
+		t.Fatalf("StopReason = %q, want max_tokens", msg.StopReason)
+	}
+	if n := len(msg.Content); n != 1 || msg.Content[n-1].Type != "tool_use" {
+		t.Fatalf("want the cut-off call as the last block, got %+v", msg.Content)
+	}
+}
+
+func TestOpenAI_StreamReassemblesToolCalls(t *testing.T) {
+	chunks := []string{
+		`{"id":"s1","model":"local-model","choices":[{"index":0,"delta":{"role":"assistant","content":"Let me "}}]}`,
+		`{"id":"s1","choices":[{"index":0,"delta":{"content":"check."}}]}`,
+		`{"id":"s1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"list_files","arguments":"{\"pa"}}]}}]}`,
+		`{"id":"s1","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":\".\"}"}}]}}]}`,
+		`{"id":"s1","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"id":"s1","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7}}`,
+	}
+	var body strings.Builder
+	for _, c := range chunks {
+		body.WriteString("data: " + c + "\n\n")
+	}
+	body.WriteString("data: [DONE]\n\n")
+
+	p, last := chatStub(t, func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, body.String())
+	})
+	var printed strings.Builder
+	resp, err := p.SendMessage(context.Background(), provider.Request{
+		Params:     toolPairConversation(),
+		Stream:     true,
+		CaptureRaw: true,
+		OnText:     func(_ int, d string) { printed.WriteString(d) },
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !strings.Contains(string(*last), `"stream":true`) || !strings.Contains(string(*last), `"include_usage":true`) {
+		t.Errorf("stream flags missing from request: %s", *last)
+	}
+	if printed.String() != "Let me check." {
+		t.Errorf("OnText got %q", printed.String())
+	}
+	msg := resp.Message
+	if len(msg.Content) != 2 || msg.Content[0].Text != "Let me check." {
+		t.Fatalf("unexpected content: %+v", msg.Content)
+	}
+	tu, ok := msg.Content[1].AsAny().(anthropic.ToolUseBlock)
+	if !ok || tu.ID != "call_a" || string(tu.Input) != `{"path":"."}` {
+		t.Fatalf("tool call not reassembled: %+v", msg.Content[1])
+	}
+	if msg.StopReason != anthropic.StopReasonToolUse || msg.Usage.OutputTokens != 7 {
+		t.Errorf("unexpected stop/usage: %s %+v", msg.StopReason, msg.Usage)
+	}
+	if string(resp.RawStream) != body.String() {
+		t.Errorf("raw stream mismatch")
+	}
+}
+
+func TestOpenAI_HTTPErrorCarriesStatusAndHeaders(t *testing.T) {
+	p, _ := chatStub(t, func(w http.ResponseWriter) {
+		w.Header().Set("retry-after", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, `{"error":{"message":"loading model"}}`)
+	})
+	_, err := p.SendMessage(context.Background(), provider.Request{Params: toolPairConversation()})
+	var he *provider.HTTPError
+	if !errors.As(err, &he) || he.StatusCode != http.StatusServiceUnavailable || he.Header.Get("retry-after") != "1" {
+		t.Fatalf("expected HTTPError 503 with headers, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "loading model") {
+		t.Errorf("error should include the body: %v", err)
+	}
+}
+
+func TestOpenAI_CountTokensUnsupported(t *testing.T) {
+	p := provider.NewOpenAI("http://127.0.0.1:0/v1", "")
+	if _, err := p.CountTokens(context.Background(), toolPairConversation()); !errors.Is(err, provider.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestFromEnv_OpenAI(t *testing.T) {
+	t.Setenv("AGT_PROVIDER", "openai")
+	t.Setenv("OPENAI_BASE_URL", "http://localhost:8000/v1/")
+	t.Setenv("OPENAI_API_KEY", "")
+	p, err := provider.FromEnv()
+	if err != nil {
+		t.Fatalf("local base URL should not need a key: %v", err)
+	}
+	if o, ok := p.(*provider.OpenAI); !ok || o.BaseURL != "http://localhost:8000/v1" {
+		t.Fatalf("unexpected provider %#v", p)
+	}
+
+	t.Setenv("OPENAI_BASE_URL", "")
+	if _, err := provider.FromEnv(); err == nil || !strings.Contains(err.Error(), "OPENAI_API_KEY") {
+		t.Fatalf("hosted API without key should fail, got %v", err)
+	}
+}
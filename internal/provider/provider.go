@@ -0,0 +1,124 @@
+// Package provider abstracts the model backend used by the runner.
+//
+// Requests and responses use the Anthropic Messages types as the common shape,
+// since windowing, tools and persistence are built on them; backends with a
+// different wire format translate at the edge.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Provider sends messages to a model backend.
+type Provider interface {
+	// Name identifies the backend in telemetry (e.g. "anthropic").
+	Name() string
+	// APIVersion is the wire API version reported in telemetry.
+	APIVersion() string
+	// SupportsPrefill reports whether a trailing assistant message is continued by
+	// the model rather than answered afresh, so a cut-off reply can be resumed.
+	SupportsPrefill() bool
+	// SendMessage performs one model call. It does not retry; callers own the retry policy.
+	SendMessage(ctx context.Context, req Request) (*Response, error)
+	// ListModels returns the models available to the configured credentials.
+	ListModels(ctx context.Context) ([]ModelInfo, error)
+	// CountTokens returns the input tokens params would consume (MaxTokens is ignored).
+	CountTokens(ctx context.Context, params anthropic.MessageNewParams) (int64, error)
+}
+
+// Request is a single model call.
+type Request struct {
+	Params anthropic.MessageNewParams
+	// Stream requests incremental delivery; OnText then receives text fragments in order.
+	Stream bool
+	// OnText is called with each streamed text fragment; index identifies the content block.
+	OnText func(index int, delta string)
+	// CaptureRaw asks the provider to return the wire payloads in Response.
+	CaptureRaw bool
+}
+
+// Response is the result of a successful model call.
+type Response struct {
+	Message *anthropic.Message
+	// RawBody is the response body as received (non-streaming) or the accumulated
+	// message JSON (streaming). Only set when Request.CaptureRaw is true.
+	RawBody []byte
+	// RawStream is the raw event stream as received. Only set when streaming with CaptureRaw.
+	RawStream []byte
+}
+
+// ModelInfo describes a model offered by a provider.
+type ModelInfo struct {
+	ID          string
+	DisplayName string
+	CreatedAt   time.Time
+}
+
+// HTTPError is a non-2xx API response. Providers wrap their native errors in it so
+// retry classification does not depend on a particular SDK.
+type HTTPError struct {
+	StatusCode int
+	Header     http.Header
+	Err        error
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("http status %d", e.StatusCode)
+}
+
+func (e *HTTPError) Unwrap() error { return e.Err }
+
+// ErrPartialStream marks a streaming failure after content was already delivered
+// through OnText; retrying would duplicate output.
+var ErrPartialStream = errors.New("stream interrupted after content was delivered")
+
+// ErrUnsupported is returned by operations a backend does not offer
+// (e.g. CountTokens on Chat Completions).
+var ErrUnsupported = errors.New("not supported by this provider")
+
+// DefaultProvider is used when AGT_PROVIDER is unset.
+const DefaultProvider = "anthropic"
+
+// New returns the provider registered under name, configured from the environment.
+func New(name string) (Provider, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "anthropic":
+		if os.Getenv("ANTHROPIC_API_KEY") == "" {
+			return nil, fmt.Errorf("missing ANTHROPIC_API_KEY; export it before running")
+		}
+		return NewAnthropic(NewAnthropicClient()), nil
+	case "openai":
+		base := strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
+		if base == "" {
+			base = DefaultOpenAIBaseURL
+		}
+		key := os.Getenv("OPENAI_API_KEY")
+		// Local OpenAI-compatible servers usually accept any key; the hosted API does not.
+		if key == "" && base == DefaultOpenAIBaseURL {
+			return nil, fmt.Errorf("missing OPENAI_API_KEY; export it or set OPENAI_BASE_URL to a local server")
+		}
+		return NewOpenAI(base, key), nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q", name)
+	}
+}
+
+// FromEnv selects the provider named by AGT_PROVIDER (default: anthropic).
+func FromEnv() (Provider, error) {
+	name := os.Getenv("AGT_PROVIDER")
+	if strings.TrimSpace(name) == "" {
+		name = DefaultProvider
+	}
+	return New(name)
+}
@@ -0,0 +1,106 @@
+package providertest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Expectation helpers for Turn.Expect. Each inspects the window sent to the model.
+
+// All combines expectations; every one runs.
+func All(expects ...func(testing.TB, anthropic.MessageNewParams)) func(testing.TB, anthropic.MessageNewParams) {
+	return func(t testing.TB, p anthropic.MessageNewParams) {
+		t.Helper()
+		for _, e := range expects {
+			e(t, p)
+		}
+	}
+}
+
+// MessageCount expects the window to hold exactly n messages.
+func MessageCount(n int) func(testing.TB, anthropic.MessageNewParams) {
+	return func(t testing.TB, p anthropic.MessageNewParams) {
+		t.Helper()
+		if len(p.Messages) != n {
+			t.Errorf("providertest: window has %d messages, want %d", len(p.Messages), n)
+		}
+	}
+}
+
+// LastUserTextContains expects the newest message to be a user message whose text contains substr.
+func LastUserTextContains(substr string) func(testing.TB, anthropic.MessageNewParams) {
+	return func(t testing.TB, p anthropic.MessageNewParams) {
+		t.Helper()
+		last, ok := lastMessage(t, p)
+		if !ok {
+			return
+		}
+		if last.Role != anthropic.MessageParamRoleUser || !strings.Contains(Text(last), substr) {
+			t.Errorf("providertest: last message (%s) text %q does not contain %q", last.Role, Text(last), substr)
+		}
+	}
+}
+
+// LastToolResultContains expects the newest message to carry a tool_result whose text
+// contains substr.
+func LastToolResultContains(substr string) func(testing.TB, anthropic.MessageNewParams) {
+	return func(t testing.TB, p anthropic.MessageNewParams) {
+		t.Helper()
+		last, ok := lastMessage(t, p)
+		if !ok {
+			return
+		}
+		for _, b := range last.Content {
+			if b.OfToolResult != nil && strings.Contains(ToolResultText(b.OfToolResult), substr) {
+				return
+			}
+		}
+		t.Errorf("providertest: no tool_result in the last message contains %q", substr)
+	}
+}
+
+// ToolOffered expects a tool named name in the request.
+func ToolOffered(name string) func(testing.TB, anthropic.MessageNewParams) {
+	return func(t testing.TB, p anthropic.MessageNewParams) {
+		t.Helper()
+		for _, tool := range p.Tools {
+			if tool.OfTool != nil && tool.OfTool.Name == name {
+				return
+			}
+		}
+		t.Errorf("providertest: tool %q not offered", name)
+	}
+}
+
+// Text joins the text blocks of m.
+func Text(m anthropic.MessageParam) string {
+	var parts []string
+	for _, b := range m.Content {
+		if b.OfText != nil {
+			parts = append(parts, b.OfText.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ToolResultText joins the text content of a tool_result block.
+func ToolResultText(tr *anthropic.ToolResultBlockParam) string {
+	var parts []string
+	for _, c := range tr.Content {
+		if c.OfText != nil {
+			parts = append(parts, c.OfText.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func lastMessage(t testing.TB, p anthropic.MessageNewParams) (anthropic.MessageParam, bool) {
+	t.Helper()
+	if len(p.Messages) == 0 {
+		t.Errorf("providertest: empty window")
+		return anthropic.MessageParam{}, false
+	}
+	return p.Messages[len(p.Messages)-1], true
+}
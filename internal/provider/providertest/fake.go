@@ -0,0 +1,203 @@
+// Package providertest provides a scripted provider.Provider for deterministic
+// end-to-end tests of the agent loop, with no network access or API key.
+//
+// A Fake replays a script of assistant turns in order. Each Turn may assert on
+// the request (window) it was sent before its reply is returned:
+//
+//	fake := providertest.New(t,
+//		providertest.Turn{ToolUses: []providertest.ToolUse{{Name: "list_files", Input: map[string]any{"path": "."}}}},
+//		providertest.Turn{Expect: providertest.LastToolResultContains("notes.txt"), Text: "Found notes.txt."},
+//	)
+//	r := runner.New(fake, tools.Registry())
+package providertest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+)
+
+// ErrScriptExhausted is returned when the model is called more times than scripted.
+var ErrScriptExhausted = errors.New("providertest: script exhausted")
+
+// Turn is one scripted assistant reply.
+type Turn struct {
+	// Expect, when set, is called with the request before replying; use t.Errorf/Fatalf to fail.
+	Expect func(t testing.TB, params anthropic.MessageNewParams)
+	// Text is the assistant text block; omitted when empty.
+	Text string
+	// ToolUses follow the text block in order.
+	ToolUses []ToolUse
+	// StopReason defaults to tool_use when ToolUses is non-empty, else end_turn.
+	StopReason anthropic.StopReason
+	// Usage reported for the reply; zero values are reported as-is.
+	InputTokens, OutputTokens int64
+	// Err, when set, is returned instead of a reply (e.g. a *provider.HTTPError).
+	Err error
+}
+
+// ToolUse is a scripted tool call. Input is marshalled to JSON; ID defaults to toolu_<turn>_<n>.
+type ToolUse struct {
+	ID    string
+	Name  string
+	Input any
+}
+
+// Fake is a scripted provider. It is safe for concurrent use.
+type Fake struct {
+	t     testing.TB
+	mu    sync.Mutex
+	turns []Turn
+	next  int
+	reqs  []anthropic.MessageNewParams
+}
+
+var _ provider.Provider = (*Fake)(nil)
+
+// New returns a Fake that replays turns in order. When the test ends it fails if
+// any scripted turn was not consumed.
+func New(t testing.TB, turns ...Turn) *Fake {
+	t.Helper()
+	f := &Fake{t: t, turns: turns}
+	t.Cleanup(func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.next < len(f.turns) {
+			t.Errorf("providertest: %d of %d scripted turns not used", len(f.turns)-f.next, len(f.turns))
+		}
+	})
+	return f
+}
+
+func (f *Fake) Name() string          { return "fake" }
+func (f *Fake) APIVersion() string    { return "scripted" }
+func (f *Fake) SupportsPrefill() bool { return true }
+
+// SendMessage records the request, runs the turn's Expect and returns its reply.
+// Streaming requests deliver Text through OnText in a few fragments.
+func (f *Fake) SendMessage(ctx context.Context, req provider.Request) (*provider.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.reqs = append(f.reqs, req.Params)
+	i := f.next
+	if i >= len(f.turns) {
+		f.mu.Unlock()
+		f.t.Errorf("providertest: unexpected model call %d; only %d turns scripted", i+1, len(f.turns))
+		return nil, ErrScriptExhausted
+	}
+	f.next++
+	turn := f.turns[i]
+	f.mu.Unlock()
+
+	if turn.Expect != nil {
+		turn.Expect(f.t, req.Params)
+	}
+	if turn.Err != nil {
+		return nil, turn.Err
+	}
+
+	msg, raw, err := turn.message(i)
+	if err != nil {
+		f.t.Errorf("providertest: turn %d: %v", i+1, err)
+		return nil, err
+	}
+	if req.Stream && req.OnText != nil && turn.Text != "" {
+		for _, frag := range fragments(turn.Text) {
+			req.OnText(0, frag)
+		}
+	}
+	resp := &provider.Response{Message: msg}
+	if req.CaptureRaw {
+		resp.RawBody = raw
+	}
+	return resp, nil
+}
+
+// ListModels reports a single scripted model.
+func (f *Fake) ListModels(ctx context.Context) ([]provider.ModelInfo, error) {
+	return []provider.ModelInfo{{ID: "fake-model", DisplayName: "Fake"}}, nil
+}
+
+// CountTokens is not scripted.
+func (f *Fake) CountTokens(ctx context.Context, params anthropic.MessageNewParams) (int64, error) {
+	return 0, fmt.Errorf("providertest: count tokens: %w", provider.ErrUnsupported)
+}
+
+// Requests returns the params of every call so far, in order.
+func (f *Fake) Requests() []anthropic.MessageNewParams {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]anthropic.MessageNewParams(nil), f.reqs...)
+}
+
+// Remaining reports how many scripted turns have not been used.
+func (f *Fake) Remaining() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.turns) - f.next
+}
+
+// message builds the reply through JSON so union accessors and raw fields
+// (AsAny, ToParam, JSON.Input) behave as for a real response.
+func (turn Turn) message(i int) (*anthropic.Message, []byte, error) {
+	content := []map[string]any{}
+	if turn.Text != "" {
+		content = append(content, map[string]any{"type": "text", "text": turn.Text})
+	}
+	for n, tu := range turn.ToolUses {
+		id := tu.ID
+		if id == "" {
+			id = fmt.Sprintf("toolu_%d_%d", i+1, n+1)
+		}
+		input := tu.Input
+		if input == nil {
+			input = map[string]any{}
+		}
+		content = append(content, map[string]any{"type": "tool_use", "id": id, "name": tu.Name, "input": input})
+	}
+	stop := turn.StopReason
+	if stop == "" {
+		stop = anthropic.StopReasonEndTurn
+		if len(turn.ToolUses) > 0 {
+			stop = anthropic.StopReasonToolUse
+		}
+	}
+	raw, err := json.Marshal(map[string]any{
+		"id":          fmt.Sprintf("msg_fake_%d", i+1),
+		"type":        "message",
+		"role":        "assistant",
+		"model":       "fake-model",
+		"content":     content,
+		"stop_reason": stop,
+		"usage":       map[string]int64{"input_tokens": turn.InputTokens, "output_tokens": turn.OutputTokens},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode reply: %w", err)
+	}
+	var msg anthropic.Message
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, nil, fmt.Errorf("decode reply: %w", err)
+	}
+	return &msg, raw, nil
+}
+
+// fragments splits s at word boundaries to mimic streamed deltas.
+func fragments(s string) []string {
+	words := strings.SplitAfter(s, " ")
+	out := words[:0]
+	for _, w := range words {
+		if w != "" {
+			out = append(out, w)
+		}
+	}
+	return out
+}
@@ -0,0 +1,215 @@
+package providertest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/provider/providertest"
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+var sharedDir string
+
+// File tools resolve sandbox roots once per process, so every scenario shares one
+// root and works in a subdirectory named after the test.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "providertest-")
+	if err != nil {
+		panic(err)
+	}
+	_ = os.Setenv("AGT_READ_ROOT", dir)
+	_ = os.Setenv("AGT_WRITE_ROOT", dir)
+	_ = os.Setenv("AGT_TOKEN_BUDGET", "20000")
+	sharedDir = dir
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func rel(t *testing.T, elems ...string) string {
+	return filepath.Join(append([]string{t.Name()}, elems...)...)
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	p := filepath.Join(sharedDir, rel(t, name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func userTurn(text string) []anthropic.MessageParam {
+	return []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(text))}
+}
+
+func TestScriptedConversations(t *testing.T) {
+	cases := []struct {
+		name   string
+		files  map[string]string
+		prompt string
+		script func(t *testing.T) []providertest.Turn
+		check  func(t *testing.T, conv []anthropic.MessageParam)
+	}{
+		{
+			name:   "ListReadEditAnswer",
+			files:  map[string]string{"notes.txt": "status: draft\n"},
+			prompt: "mark the notes as final",
+			script: func(t *testing.T) []providertest.Turn {
+				return []providertest.Turn{
+					{
+						Expect:   providertest.All(providertest.MessageCount(1), providertest.LastUserTextContains("final"), providertest.ToolOffered("edit_file")),
+						Text:     "Let me look around.",
+						ToolUses: []providertest.ToolUse{{Name: "list_files", Input: map[string]any{"path": rel(t)}}},
+					},
+					{
+						Expect:   providertest.All(providertest.MessageCount(3), providertest.LastToolResultContains("notes.txt")),
+						ToolUses: []providertest.ToolUse{{Name: "read_file", Input: map[string]any{"path": rel(t, "notes.txt")}}},
+					},
+					{
+						Expect: providertest.LastToolResultContains("status: draft"),
+						ToolUses: []providertest.ToolUse{{Name: "edit_file", Input: map[string]any{
+							"path": rel(t, "notes.txt"), "old_str": "draft", "new_str": "final",
+						}}},
+					},
+					{
+						Expect: providertest.All(providertest.MessageCount(7), providertest.LastToolResultContains("OK")),
+						Text:   "The notes are now final.",
+					},
+				}
+			},
+			check: func(t *testing.T, conv []anthropic.MessageParam) {
+				b, err := os.ReadFile(filepath.Join(sharedDir, rel(t, "notes.txt")))
+				if err != nil || string(b) != "status: final\n" {
+					t.Fatalf("edit not applied: %q, %v", b, err)
+				}
+				if got := providertest.Text(conv[len(conv)-1]); got != "The notes are now final." {
+					t.Errorf("final answer = %q", got)
+				}
+			},
+		},
+		{
+			name:   "ToolErrorIsReportedBack",
+			prompt: "read the missing file",
+			script: func(t *testing.T) []providertest.Turn {
+				return []providertest.Turn{
+					{ToolUses: []providertest.ToolUse{{ID: "r1", Name: "read_file", Input: map[string]any{"path": rel(t, "missing.txt")}}}},
+					{
+						Expect: func(tb testing.TB, p anthropic.MessageNewParams) {
+							tr := p.Messages[len(p.Messages)-1].Content[0].OfToolResult
+							if tr == nil || tr.ToolUseID != "r1" || !tr.IsError.Value {
+								tb.Errorf("expected an error tool_result for r1, got %+v", tr)
+							}
+						},
+						Text: "That file does not exist.",
+					},
+				}
+			},
+		},
+		{
+			name:   "ParallelToolUsesInOneStep",
+			files:  map[string]string{"a.txt": "alpha\n", "b.txt": "beta\n"},
+			prompt: "read both files",
+			script: func(t *testing.T) []providertest.Turn {
+				return []providertest.Turn{
+					{ToolUses: []providertest.ToolUse{
+						{Name: "read_file", Input: map[string]any{"path": rel(t, "a.txt")}},
+						{Name: "read_file", Input: map[string]any{"path": rel(t, "b.txt")}},
+					}},
+					{
+						Expect: providertest.All(providertest.LastToolResultContains("alpha"), providertest.LastToolResultContains("beta")),
+						Text:   "alpha and beta",
+					},
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, content := range tc.files {
+				writeFile(t, name, content)
+			}
+			fake := providertest.New(t, tc.script(t)...)
+			r := runner.New(fake, tools.Registry())
+
+			conv, _, err := r.RunTurn(context.Background(), provider.DefaultModel, userTurn(tc.prompt))
+			if err != nil {
+				t.Fatalf("RunTurn: %v", err)
+			}
+			if fake.Remaining() != 0 {
+				t.Fatalf("%d scripted turns unused", fake.Remaining())
+			}
+			if last := conv[len(conv)-1]; last.Role != anthropic.MessageParamRoleAssistant {
+				t.Fatalf("turn should end on an assistant message, got %s", last.Role)
+			}
+			if tc.check != nil {
+				tc.check(t, conv)
+			}
+		})
+	}
+}
+
+func TestFake_StreamsTextThroughOnText(t *testing.T) {
+	fake := providertest.New(t, providertest.Turn{Text: "hello there friend"})
+	var got strings.Builder
+	resp, err := fake.SendMessage(context.Background(), provider.Request{
+		Stream: true,
+		OnText: func(_ int, d string) { got.WriteString(d) },
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got.String() != "hello there friend" || resp.Message.Content[0].Text != "hello there friend" {
+		t.Fatalf("streamed %q, message %+v", got.String(), resp.Message.Content)
+	}
+}
+
+func TestFake_ScriptedErrorIsRetriedByRunner(t *testing.T) {
+	fake := providertest.New(t,
+		providertest.Turn{Err: &provider.HTTPError{StatusCode: 529, Header: http.Header{"Retry-After": {"0"}}}},
+		providertest.Turn{Text: "recovered", InputTokens: 7, OutputTokens: 2},
+	)
+	r := runner.New(fake, nil)
+	conv, usage, err := r.RunTurn(context.Background(), provider.DefaultModel, userTurn("hi"))
+	if err != nil {
+		t.Fatalf("RunTurn: %v", err)
+	}
+	if usage != (runner.Usage{Steps: 1, InputTokens: 7, OutputTokens: 2}) {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+	if providertest.Text(conv[len(conv)-1]) != "recovered" || len(fake.Requests()) != 2 {
+		t.Fatalf("expected one retry then the scripted reply; requests=%d", len(fake.Requests()))
+	}
+}
+
+func TestFake_ExhaustedScriptFails(t *testing.T) {
+	rec := &recorder{TB: t}
+	fake := providertest.New(rec)
+	if _, err := fake.SendMessage(context.Background(), provider.Request{}); !errors.Is(err, providertest.ErrScriptExhausted) {
+		t.Fatalf("expected ErrScriptExhausted, got %v", err)
+	}
+	if !rec.failed {
+		t.Fatal("an unscripted call should fail the test")
+	}
+}
+
+// recorder captures Errorf so failure paths of the fake can be asserted.
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Errorf(format string, args ...any) { r.failed = true }
+func (r *recorder) Helper()                           {}
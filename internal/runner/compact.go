@@ -0,0 +1,123 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+// summaryPrompt instructs the model when condensing dropped conversation history.
+const summaryPrompt = `You condense the early part of a conversation between a user and a coding agent so the agent can continue without it.
+Keep: the user's goals and constraints, decisions made, files read or changed and what was learned from them, tool errors that matter, and open questions.
+Drop: pleasantries, repeated content and raw tool output that is no longer needed.
+Write plain prose or short bullet points, at most about 300 words. Reply with the summary only.`
+
+// maxToolTextInSummary bounds each tool input/result quoted into a summary request.
+const maxToolTextInSummary = 2000
+
+// CompactionFromEnv selects the compaction strategy from AGT_COMPACTION:
+//   - "" or "off": nil; the oldest groups are dropped once the budget is hit.
+//   - "summarize": a Compactor that asks model to summarise dropped groups,
+//     retrying transient failures per retry (normally the runner's Retry).
+func CompactionFromEnv(p provider.Provider, model anthropic.Model, retry RetryPolicy) (*windowing.Compactor, error) {
+	switch v := strings.TrimSpace(os.Getenv("AGT_COMPACTION")); v {
+	case "", "off":
+		return nil, nil
+	case "summarize", "summarise":
+		return windowing.NewCompactor(ModelSummarizer{Provider: p, Model: model, Retry: retry}), nil
+	default:
+		return nil, fmt.Errorf("invalid AGT_COMPACTION %q (want off or summarize)", v)
+	}
+}
+
+// ModelSummarizer is a windowing.Summarizer that asks a provider's model to condense
+// the messages dropped from the send window.
+type ModelSummarizer struct {
+	Provider  provider.Provider
+	Model     anthropic.Model
+	MaxTokens int64       // reply cap; 1024 when zero
+	Retry     RetryPolicy // transient API failure handling; zero means a single attempt
+}
+
+// Summarize implements windowing.Summarizer.
+func (s ModelSummarizer) Summarize(ctx context.Context, previous string, msgs []anthropic.MessageParam) (string, error) {
+	maxTokens := s.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = 1024
+	}
+	var b strings.Builder
+	if previous != "" {
+		b.WriteString("Summary of the conversation before the messages below:\n")
+		b.WriteString(previous)
+		b.WriteString("\n\nUpdate that summary with these later messages:\n\n")
+	} else {
+		b.WriteString("Summarise these messages:\n\n")
+	}
+	b.WriteString(transcript(msgs))
+
+	req := provider.Request{Params: anthropic.MessageNewParams{
+		Model:     s.Model,
+		MaxTokens: maxTokens,
+		System:    []anthropic.TextBlockParam{{Text: summaryPrompt}},
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(b.String()))},
+	}}
+	resp, err := sendWithRetry(ctx, s.Provider, s.Retry, s.Model, func(ctx context.Context) (*provider.Response, error) {
+		return s.Provider.SendMessage(ctx, req)
+	})
+	if err != nil {
+		return "", err
+	}
+	var out []string
+	for _, block := range resp.Message.Content {
+		if v, ok := block.AsAny().(anthropic.TextBlock); ok {
+			out = append(out, v.Text)
+		}
+	}
+	summary := strings.TrimSpace(strings.Join(out, "\n"))
+	if summary == "" {
+		return "", fmt.Errorf("summariser: empty reply (stop_reason %s)", resp.Message.StopReason)
+	}
+	return summary, nil
+}
+
+// transcript renders messages as plain text for a summary request.
+func transcript(msgs []anthropic.MessageParam) string {
+	var b strings.Builder
+	for _, m := range msgs {
+		for _, blk := range m.Content {
+			switch {
+			case blk.OfText != nil:
+				fmt.Fprintf(&b, "%s: %s\n", m.Role, blk.OfText.Text)
+			case blk.OfToolUse != nil:
+				in, _ := json.Marshal(blk.OfToolUse.Input)
+				fmt.Fprintf(&b, "%s called %s(%s)\n", m.Role, blk.OfToolUse.Name, clip(string(in)))
+			case blk.OfToolResult != nil:
+				var parts []string
+				for _, c := range blk.OfToolResult.Content {
+					if c.OfText != nil {
+						parts = append(parts, c.OfText.Text)
+					}
+				}
+				label := "tool result"
+				if blk.OfToolResult.IsError.Value {
+					label = "tool error"
+				}
+				fmt.Fprintf(&b, "%s: %s\n", label, clip(strings.Join(parts, "\n")))
+			}
+		}
+	}
+	return b.String()
+}
+
+func clip(s string) string {
+	if r := []rune(s); len(r) > maxToolTextInSummary {
+		return string(r[:maxToolTextInSummary]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,88 @@
+package runner_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider/providertest"
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+// Dropped groups are summarised by the model and the summary heads the next window.
+func TestRunner_CompactionSummarisesDroppedHistory(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "400")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	t.Setenv("AGT_COMPACTION", "summarize")
+	_ = chdirTemp(t)
+
+	var conv []anthropic.MessageParam
+	for i := range 20 {
+		text := fmt.Sprintf("%02d: %s", i, strings.Repeat("x", 16))
+		if i%2 == 0 {
+			conv = append(conv, anthropic.NewUserMessage(anthropic.NewTextBlock(text)))
+		} else {
+			conv = append(conv, anthropic.NewAssistantMessage(anthropic.NewTextBlock(text)))
+		}
+	}
+
+	fake := providertest.New(t,
+		providertest.Turn{
+			Expect: func(t testing.TB, p anthropic.MessageNewParams) {
+				if len(p.Tools) != 0 || !strings.Contains(providertest.Text(p.Messages[0]), "00: xxx") {
+					t.Errorf("unexpected summary request: %s", providertest.Text(p.Messages[0]))
+				}
+			},
+			Text: "The user sent numbered messages.",
+		},
+		providertest.Turn{
+			Expect: func(t testing.TB, p anthropic.MessageNewParams) {
+				head := providertest.Text(p.Messages[0])
+				if !strings.HasPrefix(head, windowing.SummaryHeader) || !strings.Contains(head, "numbered messages") {
+					t.Errorf("window should start with the summary, got %q", head)
+				}
+				if last := providertest.Text(p.Messages[len(p.Messages)-1]); !strings.HasPrefix(last, "19:") {
+					t.Errorf("newest message missing: %q", last)
+				}
+			},
+			Text: "ok",
+		},
+	)
+	r := runner.New(fake, nil)
+	var err error
+	if r.Compactor, err = runner.CompactionFromEnv(fake, "claude-test", r.Retry); err != nil || r.Compactor == nil {
+		t.Fatalf("CompactionFromEnv: %v", err)
+	}
+
+	if _, _, err := r.RunOneStep(context.Background(), "claude-test", conv); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	evs := filterEventsByName(readEventLines(t), "window_prepared")
+	if len(evs) != 1 {
+		t.Fatalf("want 1 window_prepared event, got %d", len(evs))
+	}
+	var m map[string]any
+	_ = json.Unmarshal(evs[0], &m)
+	if m["compacted_groups"].(float64) == 0 || m["summary_tokens"].(float64) == 0 || m["summary_cached"] != false {
+		t.Fatalf("compaction not reported: %v", m)
+	}
+	if m["total_estimated"].(float64) > 400 {
+		t.Fatalf("window exceeds budget: %v", m)
+	}
+}
+
+func TestRunner_CompactionFromEnv(t *testing.T) {
+	t.Setenv("AGT_COMPACTION", "")
+	if c, err := runner.CompactionFromEnv(nil, "m", runner.DefaultRetryPolicy()); c != nil || err != nil {
+		t.Fatalf("unset: got %v, %v", c, err)
+	}
+	t.Setenv("AGT_COMPACTION", "squash")
+	if _, err := runner.CompactionFromEnv(nil, "m", runner.DefaultRetryPolicy()); err == nil {
+		t.Fatal("expected error for unknown strategy")
+	}
+}
@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/safety"
+	"github.com/petasbytes/go-agent/internal/telemetry"
+)
+
+// DefaultMaxContinuations is how many times a reply cut off at max_tokens is
+// continued when AGT_MAX_CONTINUATIONS is unset.
+const DefaultMaxContinuations = 3
+
+// maxContinuationsFromEnv reads AGT_MAX_CONTINUATIONS (0 disables continuation).
+func maxContinuationsFromEnv() (int, error) {
+	v := strings.TrimSpace(os.Getenv("AGT_MAX_CONTINUATIONS"))
+	if v == "" {
+		return DefaultMaxContinuations, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid AGT_MAX_CONTINUATIONS %q: want a number ≥ 0", v)
+	}
+	return n, nil
+}
+
+// truncatedToolUse reports whether msg stopped at max_tokens inside a tool_use
+// block, whose input is then incomplete.
+func truncatedToolUse(msg *anthropic.Message) bool {
+	n := len(msg.Content)
+	return msg.StopReason == anthropic.StopReasonMaxTokens && n > 0 && msg.Content[n-1].Type == "tool_use"
+}
+
+// errTruncatedToolUse is returned to the model instead of running a cut-off tool call.
+var errTruncatedToolUse = safety.ToolError{
+	Code:    "ERR_TRUNCATED_TOOL_USE",
+	Message: "tool input was cut off at max_tokens and the call was not run; retry with a smaller input (e.g. split large edits)",
+}
+
+// continueReply asks the model to continue a reply that stopped at max_tokens in a
+// text block, prefilling the partial reply as the assistant turn, and merges the
+// continuation into it. It stops after limit continuations, at any other stop
+// reason, or at a truncated tool_use (which cannot be prefilled). Providers without
+// prefill support keep the cut-off reply as is. A failed continuation is reported
+// and the reply so far is kept.
+func (r *Runner) continueReply(ctx context.Context, model anthropic.Model, req provider.Request, msg *anthropic.Message, limit int, printer *textPrinter) *anthropic.Message {
+	if !r.Provider.SupportsPrefill() {
+		return msg
+	}
+	turnID, _ := telemetry.TurnIDFromContext(ctx)
+	for attempt := 1; attempt <= limit && msg.StopReason == anthropic.StopReasonMaxTokens; attempt++ {
+		n := len(msg.Content)
+		if n == 0 || msg.Content[n-1].Type != "text" {
+			break
+		}
+		// The API rejects prefills ending in whitespace; the continuation supplies it.
+		prefill := msg.ToParam()
+		last := strings.TrimRightFunc(msg.Content[n-1].Text, isSpace)
+		prefill.Content[n-1] = anthropic.NewTextBlock(last)
+
+		cont := req
+		cont.Params.Messages = append(slices.Clone(req.Params.Messages), prefill)
+		if printer != nil {
+			cont.OnText = func(index int, delta string) { printer.write(index+n-1, delta) }
+		}
+		resp, err := r.withRetry(ctx, model, func(ctx context.Context) (*provider.Response, error) {
+			return r.Provider.SendMessage(ctx, cont)
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: continuing a reply cut off at max_tokens failed: %v\n", err)
+			break
+		}
+		telemetry.Emit("api_continuation", map[string]any{
+			"turn_id":       turnID,
+			"provider":      r.Provider.Name(),
+			"model":         string(model),
+			"attempt":       attempt,
+			"input_tokens":  resp.Message.Usage.InputTokens,
+			"output_tokens": resp.Message.Usage.OutputTokens,
+			"stop_reason":   resp.Message.StopReason,
+			"streaming":     req.Stream,
+		})
+		merged, err := mergeContinuation(msg, last, resp.Message)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+			break
+		}
+		msg = merged
+	}
+	return msg
+}
+
+func isSpace(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == '\r' }
+
+// mergeContinuation appends cont to partial, whose last text block is replaced by
+// last (its prefilled form) joined with cont's leading text. Stop reason comes from
+// cont and usage is summed. The message is rebuilt through JSON so union accessors
+// (AsAny, ToParam) see the merged content.
+func mergeContinuation(partial *anthropic.Message, last string, cont *anthropic.Message) (*anthropic.Message, error) {
+	n := len(partial.Content)
+	content := make([]json.RawMessage, 0, n+len(cont.Content))
+	for _, b := range partial.Content[:n-1] {
+		content = append(content, json.RawMessage(b.RawJSON()))
+	}
+	rest := cont.Content
+	if len(rest) > 0 && rest[0].Type == "text" {
+		last += rest[0].Text
+		rest = rest[1:]
+	}
+	text, err := json.Marshal(map[string]string{"type": "text", "text": last})
+	if err != nil {
+		return nil, fmt.Errorf("merge continuation: %w", err)
+	}
+	content = append(content, text)
+	for _, b := range rest {
+		content = append(content, json.RawMessage(b.RawJSON()))
+	}
+	b, err := json.Marshal(map[string]any{
+		"id":          partial.ID,
+		"type":        "message",
+		"role":        "assistant",
+		"model":       partial.Model,
+		"content":     content,
+		"stop_reason": cont.StopReason,
+		"usage": map[string]int64{
+			"input_tokens":  partial.Usage.InputTokens + cont.Usage.InputTokens,
+			"output_tokens": partial.Usage.OutputTokens + cont.Usage.OutputTokens,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("merge continuation: %w", err)
+	}
+	var msg anthropic.Message
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return nil, fmt.Errorf("merge continuation: %w", err)
+	}
+	return &msg, nil
+}
+
+// truncatedToolResult reports a tool_use cut off at max_tokens back to the model
+// without running the tool, and records it as a failed tool_exec.
+func (r *Runner) truncatedToolResult(ctx context.Context, id, name string) anthropic.ContentBlockParamUnion {
+	turnID, _ := telemetry.TurnIDFromContext(ctx)
+	telemetry.Emit("tool_exec", map[string]any{
+		"tool_name":   name,
+		"queue_ms":    int64(0),
+		"duration_ms": int64(0),
+		"input_size":  0,
+		"output_size": 0,
+		"turn_id":     turnID,
+		"error":       "truncated",
+	})
+	return anthropic.NewToolResultBlock(id, errTruncatedToolUse.Error(), true)
+}
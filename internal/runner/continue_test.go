@@ -0,0 +1,130 @@
+package runner_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider/providertest"
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+// A reply cut off at max_tokens is continued from a prefill of the partial text and
+// merged into one assistant message.
+func TestRunner_MaxTokens_ContinuesAndMerges(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	fake := providertest.New(t,
+		providertest.Turn{Text: "The lexer splits input into ", StopReason: anthropic.StopReasonMaxTokens, InputTokens: 10, OutputTokens: 5},
+		providertest.Turn{
+			Expect: func(t testing.TB, p anthropic.MessageNewParams) {
+				last := p.Messages[len(p.Messages)-1]
+				if last.Role != anthropic.MessageParamRoleAssistant || providertest.Text(last) != "The lexer splits input into" {
+					t.Errorf("want a prefill of the trimmed partial reply, got %+v", last)
+				}
+			},
+			Text: " tokens.", InputTokens: 15, OutputTokens: 2,
+		},
+	)
+	r := runner.New(fake, nil)
+	conv := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("explain the lexer"))}
+
+	var (
+		msg *anthropic.Message
+		err error
+	)
+	out := captureStdout(t, func() {
+		msg, _, err = r.RunOneStep(context.Background(), "claude-test", conv)
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(msg.Content) != 1 || msg.Content[0].Text != "The lexer splits input into tokens." {
+		t.Fatalf("unexpected merged content: %+v", msg.Content)
+	}
+	if msg.StopReason != anthropic.StopReasonEndTurn || msg.Usage.InputTokens != 25 || msg.Usage.OutputTokens != 7 {
+		t.Fatalf("want end_turn and summed usage, got %s %+v", msg.StopReason, msg.Usage)
+	}
+	if !strings.Contains(out, "The lexer splits input into tokens.") {
+		t.Fatalf("merged text not printed: %q", out)
+	}
+
+	evs := filterEventsByName(readEventLines(t), "api_continuation")
+	var m map[string]any
+	if len(evs) != 1 || json.Unmarshal(evs[0], &m) != nil {
+		t.Fatalf("want one api_continuation event, got %d", len(evs))
+	}
+	if m["attempt"] != float64(1) || m["output_tokens"] != float64(2) || m["stop_reason"] != "end_turn" {
+		t.Fatalf("unexpected api_continuation fields: %v", m)
+	}
+}
+
+func TestRunner_MaxTokens_StopsAtContinuationLimit(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_MAX_CONTINUATIONS", "1")
+	_ = chdirTemp(t)
+
+	fake := providertest.New(t,
+		providertest.Turn{Text: "one", StopReason: anthropic.StopReasonMaxTokens},
+		providertest.Turn{Text: " two", StopReason: anthropic.StopReasonMaxTokens},
+	)
+	r := runner.New(fake, nil)
+	var msg *anthropic.Message
+	_ = captureStdout(t, func() {
+		var err error
+		if msg, _, err = r.RunOneStep(context.Background(), "claude-test", nil); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+	if msg.Content[0].Text != "one two" || msg.StopReason != anthropic.StopReasonMaxTokens {
+		t.Fatalf("unexpected reply: %q %s", msg.Content[0].Text, msg.StopReason)
+	}
+
+	t.Setenv("AGT_MAX_CONTINUATIONS", "-1")
+	if _, _, err := r.RunOneStep(context.Background(), "claude-test", nil); err == nil || !strings.Contains(err.Error(), "AGT_MAX_CONTINUATIONS") {
+		t.Fatalf("want invalid AGT_MAX_CONTINUATIONS error, got %v", err)
+	}
+}
+
+// A tool_use cut off at max_tokens is reported to the model instead of run; complete
+// tool_uses before it still run.
+func TestRunner_MaxTokens_TruncatedToolUseNotExecuted(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	_ = chdirTemp(t)
+
+	fake := providertest.New(t, providertest.Turn{
+		ToolUses: []providertest.ToolUse{
+			{ID: "t1", Name: "echo", Input: map[string]any{"s": "a"}},
+			{ID: "t2", Name: "echo", Input: map[string]any{"s": "b"}},
+		},
+		StopReason: anthropic.StopReasonMaxTokens,
+	})
+	var ran []string
+	echo := tools.ToolDefinition{Name: "echo", Function: func(input json.RawMessage) (string, error) {
+		ran = append(ran, string(input))
+		return string(input), nil
+	}}
+	r := runner.New(fake, []tools.ToolDefinition{echo})
+	var results []anthropic.ContentBlockParamUnion
+	_ = captureStdout(t, func() {
+		var err error
+		if _, results, err = r.RunOneStep(context.Background(), "claude-test", nil); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+	if len(results) != 2 || len(ran) != 1 {
+		t.Fatalf("want 2 tool results from 1 run, got %d from %d", len(results), len(ran))
+	}
+	if tr := results[0].OfToolResult; tr == nil || tr.IsError.Value {
+		t.Fatalf("complete tool_use should run: %+v", tr)
+	}
+	tr := results[1].OfToolResult
+	if tr == nil || tr.ToolUseID != "t2" || !tr.IsError.Value || !strings.Contains(tr.Content[0].OfText.Text, "ERR_TRUNCATED_TOOL_USE") {
+		t.Fatalf("truncated tool_use should be reported, got %+v", tr)
+	}
+}
@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+// CounterFromEnv selects the window token counter from AGT_TOKEN_COUNTER:
+//   - "" or "heuristic": windowing.HeuristicCounter (rune based, no network).
+//   - "bpe": offline estimates of real tokens from the embedded BPE vocabulary.
+//   - "api": exact counts from the provider's CountTokens endpoint, cached per
+//     message and falling back to the BPE estimate while the endpoint is unavailable
+//     (not windowing.APICounter's default HeuristicCounter: the budget is in tokens,
+//     and runes would overestimate it several times over).
+//   - "calibrated": runes per content class scaled by the profile `agent calibrate`
+//     fitted from api_usage telemetry (AGT_CALIBRATION_PROFILE, default
+//     .agent/calibration.json).
+func CounterFromEnv(p provider.Provider, model anthropic.Model) (windowing.TokenCounter, error) {
+	switch v := strings.TrimSpace(os.Getenv("AGT_TOKEN_COUNTER")); v {
+	case "", "heuristic":
+		return windowing.HeuristicCounter{}, nil
+	case "bpe":
+		return windowing.BPECounter{}, nil
+	case "api":
+		c := windowing.NewAPICounter(p.CountTokens, model)
+		c.Fallback = windowing.BPECounter{} // same units as the API; see above
+		return c, nil
+	case "calibrated":
+		path := CalibrationProfilePath()
+		prof, err := windowing.LoadCalibration(path)
+		if err != nil {
+			return nil, fmt.Errorf("AGT_TOKEN_COUNTER=calibrated: %w (run `agent calibrate` after a session with AGT_CALIBRATION_MODE=1)", err)
+		}
+		if prof.Model != "" && prof.Model != string(model) {
+			fmt.Fprintf(os.Stderr, "warning: calibration profile %s was fitted for %s, not %s\n", path, prof.Model, model)
+		}
+		return windowing.CalibratedCounter{Profile: prof}, nil
+	default:
+		return nil, fmt.Errorf("invalid AGT_TOKEN_COUNTER %q (want heuristic, bpe, api or calibrated)", v)
+	}
+}
+
+// CalibrationProfilePath returns AGT_CALIBRATION_PROFILE, or calibration.json under
+// AGT_ARTIFACTS_DIR (default .agent).
+func CalibrationProfilePath() string {
+	if p := strings.TrimSpace(os.Getenv("AGT_CALIBRATION_PROFILE")); p != "" {
+		return p
+	}
+	base := strings.TrimSpace(os.Getenv("AGT_ARTIFACTS_DIR"))
+	if base == "" {
+		base = ".agent"
+	}
+	return filepath.Join(base, "calibration.json")
+}
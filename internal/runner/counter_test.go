@@ -0,0 +1,131 @@
+package runner_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider/providertest"
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/internal/windowing"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+func TestRunner_CounterFromEnv(t *testing.T) {
+	fake := providertest.New(t)
+	for env, want := range map[string]string{
+		"":          "windowing.HeuristicCounter",
+		"heuristic": "windowing.HeuristicCounter",
+		"bpe":       "windowing.BPECounter",
+		"api":       "*windowing.APICounter",
+	} {
+		t.Setenv("AGT_TOKEN_COUNTER", env)
+		c, err := runner.CounterFromEnv(fake, "claude-test")
+		if err != nil || fmt.Sprintf("%T", c) != want {
+			t.Errorf("AGT_TOKEN_COUNTER=%q: got %T, %v; want %s", env, c, err, want)
+		}
+	}
+	t.Setenv("AGT_TOKEN_COUNTER", "exact")
+	if _, err := runner.CounterFromEnv(fake, "claude-test"); err == nil {
+		t.Fatal("expected error for unknown counter")
+	}
+}
+
+func TestRunner_CalibratedCounterLoadsProfile(t *testing.T) {
+	fake := providertest.New(t)
+	t.Setenv("AGT_TOKEN_COUNTER", "calibrated")
+	t.Setenv("AGT_CALIBRATION_PROFILE", filepath.Join(t.TempDir(), "calibration.json"))
+	if _, err := runner.CounterFromEnv(fake, "claude-test"); err == nil {
+		t.Fatal("expected error without a profile")
+	}
+
+	prof := windowing.DefaultCalibration
+	prof.Model = "claude-test"
+	if err := windowing.SaveCalibration(runner.CalibrationProfilePath(), prof); err != nil {
+		t.Fatal(err)
+	}
+	c, err := runner.CounterFromEnv(fake, "claude-test")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if cc, ok := c.(windowing.CalibratedCounter); !ok || cc.Profile.Prose != prof.Prose {
+		t.Fatalf("got %#v", c)
+	}
+}
+
+// In calibration mode api_usage carries the per-class content the calibration is fitted on.
+func TestRunner_CalibrationMode_RecordsPreparedRunes(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_CALIBRATION_MODE", "1")
+	t.Setenv("AGT_PERSIST_API_PAYLOADS", "0")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	fake := providertest.New(t, providertest.Turn{Text: "ok", InputTokens: 42, OutputTokens: 1})
+	r := runner.New(fake, tools.Registry())
+	text := "Why does this fail?\n```go\nfunc main() { panic(nil) }\n```"
+	conv := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(text))}
+	if _, _, err := r.RunOneStep(context.Background(), "claude-test", conv); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	evs := filterEventsByName(readEventLines(t), "api_usage")
+	var ev struct {
+		InputTokens   int64                  `json:"input_tokens"`
+		PreparedRunes windowing.ContentRunes `json:"prepared_runes"`
+	}
+	if len(evs) != 1 || json.Unmarshal(evs[0], &ev) != nil {
+		t.Fatalf("want one api_usage event, got %d", len(evs))
+	}
+	if ev.InputTokens != 42 || ev.PreparedRunes != windowing.MeasureContent(conv) || ev.PreparedRunes.Code == 0 || ev.PreparedRunes.Prose == 0 {
+		t.Fatalf("unexpected sample: %+v", ev)
+	}
+}
+
+// Counters that size tool definitions take them out of the message budget.
+func TestRunner_ToolDefinitionsReduceMessageBudget(t *testing.T) {
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+	defs := tools.Registry()
+	cost := windowing.BPECounter{}.CountTools(context.Background(), runnerTools(defs))
+	conv := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock(strings.Repeat("older context ", 40))),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("hi")),
+	}
+	// Room for both messages, but not once the tools are accounted for.
+	bpe := windowing.BPECounter{}
+	budget := cost + bpe.CountMessage(context.Background(), conv[1]) + bpe.CountMessage(context.Background(), conv[0])/2
+	t.Setenv("AGT_TOKEN_BUDGET", strconv.Itoa(budget))
+
+	fake := providertest.New(t, providertest.Turn{Expect: providertest.MessageCount(1), Text: "hello"})
+	r := runner.New(fake, defs)
+	r.Counter = windowing.BPECounter{}
+	if _, _, err := r.RunOneStep(context.Background(), "claude-test", conv); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	evs := filterEventsByName(readEventLines(t), "window_prepared")
+	var m map[string]any
+	if len(evs) != 1 || json.Unmarshal(evs[0], &m) != nil {
+		t.Fatalf("want one window_prepared event, got %d", len(evs))
+	}
+	if m["tools_tokens"] != float64(cost) || m["budget"] != float64(budget) || m["skipped_groups"] != float64(1) {
+		t.Fatalf("unexpected budget accounting: %v", m)
+	}
+}
+
+// runnerTools mirrors how the runner offers tool definitions to the model.
+func runnerTools(defs []tools.ToolDefinition) []anthropic.ToolUnionParam {
+	out := make([]anthropic.ToolUnionParam, 0, len(defs))
+	for _, d := range defs {
+		out = append(out, anthropic.ToolUnionParam{OfTool: &anthropic.ToolParam{
+			Name:        d.Name,
+			Description: anthropic.String(d.Description),
+			InputSchema: d.InputSchema,
+		}})
+	}
+	return out
+}
@@ -1,5 +1,5 @@
-// Package runner coordinates message exchange with the Anthropic Messages API
-// and dispatches tool calls.
+// Package runner coordinates message exchange with a model provider (see
+// internal/provider) and dispatches tool calls.
 //
 // Invariant:
 //   - tool_use and the corresponding tool_result are kept adjacent within a turn
@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/safety"
+	"github.com/petasbytes/go-agent/internal/telemetry"
+)
+
+const (
+	// DefaultMaxSteps is how many tool steps one user turn may take when
+	// AGT_MAX_STEPS is unset.
+	DefaultMaxSteps = 25
+	// DefaultMaxRepeats is how many times the same tool call may return the same
+	// result within a turn when AGT_MAX_REPEATS is unset.
+	DefaultMaxRepeats = 3
+	// DefaultTurnTimeout bounds one user turn when AGT_TURN_TIMEOUT is unset. It
+	// leaves room for a run_command at its 600s maximum plus the model calls around it.
+	DefaultTurnTimeout = 15 * time.Minute
+)
+
+// TurnTimeoutFromEnv reads AGT_TURN_TIMEOUT in seconds (0 disables the limit).
+func TurnTimeoutFromEnv() (time.Duration, error) {
+	v := strings.TrimSpace(os.Getenv("AGT_TURN_TIMEOUT"))
+	if v == "" {
+		return DefaultTurnTimeout, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid AGT_TURN_TIMEOUT %q: want seconds ≥ 0 (0 disables the limit)", v)
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+// loopGuard stops a turn whose tool loop runs too long or keeps repeating itself.
+type loopGuard struct {
+	maxSteps   int // 0: unlimited
+	maxRepeats int // 0: unlimited
+	steps      int
+	seen       map[string]int // tool call + result -> occurrences this turn
+}
+
+// loopGuardFromEnv reads AGT_MAX_STEPS and AGT_MAX_REPEATS (0 disables either check).
+func loopGuardFromEnv() (*loopGuard, error) {
+	g := &loopGuard{maxSteps: DefaultMaxSteps, maxRepeats: DefaultMaxRepeats, seen: map[string]int{}}
+	for _, e := range []struct {
+		name string
+		dst  *int
+	}{{"AGT_MAX_STEPS", &g.maxSteps}, {"AGT_MAX_REPEATS", &g.maxRepeats}} {
+		v := strings.TrimSpace(os.Getenv(e.name))
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s %q: want a number ≥ 0 (0 disables the check)", e.name, v)
+		}
+		*e.dst = n
+	}
+	return g, nil
+}
+
+// loopTrip describes why the guard stopped a turn.
+type loopTrip struct {
+	reason  string // "max_steps" or "repeated_call"
+	tool    string // repeated tool, for repeated_call
+	count   int    // steps taken, or repeats of the call
+	limit   int
+	message string // told to the model
+}
+
+// observe records a tool step (msg's tool_use blocks and their results, in order)
+// and reports whether the turn should stop.
+func (g *loopGuard) observe(msg *anthropic.Message, results []anthropic.ContentBlockParamUnion) *loopTrip {
+	g.steps++
+	var trip *loopTrip
+	i := 0
+	for _, block := range msg.Content {
+		tu, ok := block.AsAny().(anthropic.ToolUseBlock)
+		if !ok || i >= len(results) {
+			continue
+		}
+		key := callKey(tu, results[i])
+		i++
+		g.seen[key]++
+		if n := g.seen[key]; trip == nil && g.maxRepeats > 0 && n >= g.maxRepeats {
+			trip = &loopTrip{
+				reason: "repeated_call", tool: tu.Name, count: n, limit: g.maxRepeats,
+				message: fmt.Sprintf("%s was called %d times with the same input and returned the same result each time", tu.Name, n),
+			}
+		}
+	}
+	if trip == nil && g.maxSteps > 0 && g.steps >= g.maxSteps {
+		trip = &loopTrip{
+			reason: "max_steps", count: g.steps, limit: g.maxSteps,
+			message: fmt.Sprintf("this turn reached its limit of %d tool steps", g.maxSteps),
+		}
+	}
+	return trip
+}
+
+// callKey identifies a tool call by name, input and result.
+func callKey(tu anthropic.ToolUseBlock, result anthropic.ContentBlockParamUnion) string {
+	var in bytes.Buffer
+	if err := json.Compact(&in, []byte(tu.JSON.Input.Raw())); err != nil {
+		in.WriteString(tu.JSON.Input.Raw())
+	}
+	var out strings.Builder
+	if tr := result.OfToolResult; tr != nil {
+		for _, c := range tr.Content {
+			if c.OfText != nil {
+				out.WriteString(c.OfText.Text)
+			}
+		}
+		if tr.IsError.Value {
+			out.WriteString("\x00error")
+		}
+	}
+	return tu.Name + "\x00" + in.String() + "\x00" + out.String()
+}
+
+// loopGuardNotice is appended to the last tool results to tell the model why its
+// tools were taken away.
+func loopGuardNotice(trip *loopTrip) anthropic.ContentBlockParamUnion {
+	return anthropic.NewTextBlock("Loop guard: " + trip.message + ". Tools are disabled for the rest of this turn; answer the user with what you have so far and say what is left to do.")
+}
+
+// errToolsDisabled answers tool calls made after the loop guard tripped.
+var errToolsDisabled = safety.ToolError{
+	Code:    "ERR_LOOP_GUARD",
+	Message: "tools are disabled for the rest of this turn; answer with what you have",
+}
+
+// emitLoopGuard reports a tripped guard on stderr and as a loop_guard event.
+func (r *Runner) emitLoopGuard(ctx context.Context, model anthropic.Model, trip *loopTrip) {
+	fmt.Fprintf(os.Stderr, "loop guard: %s; asking the model to wrap up\n", trip.message)
+	turnID, _ := telemetry.TurnIDFromContext(ctx)
+	fields := map[string]any{
+		"turn_id":  turnID,
+		"provider": r.Provider.Name(),
+		"model":    string(model),
+		"reason":   trip.reason,
+		"count":    trip.count,
+		"limit":    trip.limit,
+	}
+	if trip.tool != "" {
+		fields["tool_name"] = trip.tool
+	}
+	telemetry.Emit("loop_guard", fields)
+}
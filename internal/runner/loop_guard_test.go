@@ -0,0 +1,125 @@
+package runner_test
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider/providertest"
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+// wrapUpTurn expects the final, tool-less step the loop guard asks for.
+func wrapUpTurn(reason string) providertest.Turn {
+	return providertest.Turn{
+		Expect: func(t testing.TB, p anthropic.MessageNewParams) {
+			if p.ToolChoice.OfNone == nil {
+				t.Errorf("want tool_choice none after the loop guard trips, got %+v", p.ToolChoice)
+			}
+			last := p.Messages[len(p.Messages)-1]
+			if n := len(last.Content); n == 0 || last.Content[n-1].OfText == nil || !strings.Contains(last.Content[n-1].OfText.Text, reason) {
+				t.Errorf("model not told why tools stopped: %+v", last)
+			}
+		},
+		Text: "Here is what I found so far.",
+	}
+}
+
+func TestRunner_LoopGuard_RepeatedIdenticalCalls(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "100000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	same := providertest.Turn{ToolUses: []providertest.ToolUse{{Name: "read", Input: map[string]any{"path": "a.txt"}}}}
+	fake := providertest.New(t, same, same, same, wrapUpTurn("called 3 times with the same input"))
+	read := tools.ToolDefinition{Name: "read", Function: func(json.RawMessage) (string, error) { return "same contents", nil }}
+	r := runner.New(fake, []tools.ToolDefinition{read})
+
+	var (
+		conv  []anthropic.MessageParam
+		usage runner.Usage
+		err   error
+	)
+	_ = captureStdout(t, func() {
+		conv, usage, err = r.RunTurn(context.Background(), "claude-test", []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("read a.txt"))})
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if usage.Steps != 4 || conv[len(conv)-1].Role != anthropic.MessageParamRoleAssistant {
+		t.Fatalf("want 4 steps ending in an assistant reply, got %d steps, last role %s", usage.Steps, conv[len(conv)-1].Role)
+	}
+
+	evs := filterEventsByName(readEventLines(t), "loop_guard")
+	var m map[string]any
+	if len(evs) != 1 || json.Unmarshal(evs[0], &m) != nil {
+		t.Fatalf("want one loop_guard event, got %d", len(evs))
+	}
+	if m["reason"] != "repeated_call" || m["tool_name"] != "read" || m["count"] != float64(3) {
+		t.Fatalf("unexpected loop_guard fields: %v", m)
+	}
+}
+
+func TestRunner_LoopGuard_MaxSteps(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "100000")
+	t.Setenv("AGT_MAX_STEPS", "2")
+	_ = chdirTemp(t)
+
+	step := func(n int) providertest.Turn {
+		return providertest.Turn{ToolUses: []providertest.ToolUse{{Name: "read", Input: map[string]any{"page": n}}}}
+	}
+	// The model ignores tool_choice none; its call is refused and the turn ends.
+	ignored := wrapUpTurn("limit of 2 tool steps")
+	ignored.ToolUses = []providertest.ToolUse{{ID: "late", Name: "read", Input: map[string]any{"page": 3}}}
+	fake := providertest.New(t, step(1), step(2), ignored)
+	calls := 0
+	read := tools.ToolDefinition{Name: "read", Function: func(json.RawMessage) (string, error) {
+		calls++
+		return "page " + strconv.Itoa(calls), nil
+	}}
+	r := runner.New(fake, []tools.ToolDefinition{read})
+
+	var conv []anthropic.MessageParam
+	_ = captureStdout(t, func() {
+		var err error
+		if conv, _, err = r.RunTurn(context.Background(), "claude-test", nil); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+	if calls != 2 {
+		t.Fatalf("tool should run only within the step limit, ran %d times", calls)
+	}
+	last := conv[len(conv)-1]
+	if tr := last.Content[0].OfToolResult; tr == nil || tr.ToolUseID != "late" || !tr.IsError.Value || !strings.Contains(tr.Content[0].OfText.Text, "ERR_LOOP_GUARD") {
+		t.Fatalf("late tool call should be refused, got %+v", last)
+	}
+
+	t.Setenv("AGT_MAX_STEPS", "lots")
+	if _, _, err := r.RunTurn(context.Background(), "claude-test", nil); err == nil || !strings.Contains(err.Error(), "AGT_MAX_STEPS") {
+		t.Fatalf("want invalid AGT_MAX_STEPS error, got %v", err)
+	}
+}
+
+func TestRunner_TurnTimeoutFromEnv(t *testing.T) {
+	t.Setenv("AGT_TURN_TIMEOUT", "")
+	if d, err := runner.TurnTimeoutFromEnv(); err != nil || d != runner.DefaultTurnTimeout {
+		t.Fatalf("unset: got %s, %v", d, err)
+	}
+	t.Setenv("AGT_TURN_TIMEOUT", "0")
+	if d, err := runner.TurnTimeoutFromEnv(); err != nil || d != 0 {
+		t.Fatalf("0 should disable the limit: got %s, %v", d, err)
+	}
+	t.Setenv("AGT_TURN_TIMEOUT", "1200")
+	if d, err := runner.TurnTimeoutFromEnv(); err != nil || d != 20*time.Minute {
+		t.Fatalf("got %s, %v", d, err)
+	}
+	t.Setenv("AGT_TURN_TIMEOUT", "5m")
+	if _, err := runner.TurnTimeoutFromEnv(); err == nil {
+		t.Fatal("expected error for a non-numeric timeout")
+	}
+}
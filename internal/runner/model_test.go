@@ -0,0 +1,79 @@
+package runner_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/provider/providertest"
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+func hiConv() []anthropic.MessageParam {
+	return []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("hi"))}
+}
+
+// Catalogued models default the input budget and max_tokens from their limits.
+func TestRunner_CatalogDefaultsBudgetAndMaxTokens(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "")
+	t.Setenv("AGT_MAX_TOKENS", "")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+	spec, _ := provider.LookupModel("claude-3-haiku-20240307")
+
+	fake := providertest.New(t, providertest.Turn{
+		Expect: func(t testing.TB, p anthropic.MessageNewParams) {
+			if p.MaxTokens != 4096 {
+				t.Errorf("max_tokens = %d, want the model's 4096", p.MaxTokens)
+			}
+		},
+		Text: "ok",
+	})
+	if _, _, err := runner.New(fake, nil).RunOneStep(context.Background(), anthropic.Model(spec.ID), hiConv()); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	evs := filterEventsByName(readEventLines(t), "window_prepared")
+	var m map[string]any
+	if len(evs) != 1 || json.Unmarshal(evs[0], &m) != nil || m["budget"] != float64(200_000-4096) {
+		t.Fatalf("unexpected window_prepared: %v", m)
+	}
+}
+
+func TestRunner_RequestsBeyondModelLimits_ReturnErrors(t *testing.T) {
+	fake := providertest.New(t)
+	r := runner.New(fake, nil)
+
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_MAX_TOKENS", "5000")
+	if _, _, err := r.RunOneStep(context.Background(), "claude-3-haiku-20240307", hiConv()); err == nil || !strings.Contains(err.Error(), "max_tokens") {
+		t.Fatalf("want max_tokens validation error, got %v", err)
+	}
+
+	// A token budget that leaves no room for output in the context window.
+	t.Setenv("AGT_MAX_TOKENS", "")
+	t.Setenv("AGT_TOKEN_BUDGET", "199000")
+	r.Counter = windowing.BPECounter{}
+	if _, _, err := r.RunOneStep(context.Background(), "claude-3-haiku-20240307", hiConv()); err == nil || !strings.Contains(err.Error(), "context window") {
+		t.Fatalf("want context window error, got %v", err)
+	}
+
+	// Runner.Spec describes models outside the catalog.
+	t.Setenv("AGT_TOKEN_BUDGET", "")
+	local := providertest.New(t, providertest.Turn{
+		Expect: func(t testing.TB, p anthropic.MessageNewParams) {
+			if p.MaxTokens != 512 {
+				t.Errorf("max_tokens = %d, want 512", p.MaxTokens)
+			}
+		},
+		Text: "ok",
+	})
+	r = runner.New(local, nil)
+	r.Spec = provider.ModelSpec{ID: "local", ContextWindow: 4096, MaxOutputTokens: 512}
+	if _, _, err := r.RunOneStep(context.Background(), "local", hiConv()); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
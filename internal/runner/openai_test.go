@@ -0,0 +1,149 @@
+package runner_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+// The same step loop runs against an OpenAI-compatible endpoint: tool_calls are
+// dispatched as tool_use and results come back paired by id.
+func TestRunner_OpenAIProvider_DispatchesToolCalls(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(w, `{"id":"c1","model":"local","choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"echo","arguments":"{\"text\":\"hi\"}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":4,"completion_tokens":3}}`)
+	}))
+	defer srv.Close()
+
+	echo := tools.ToolDefinition{
+		Name:        "echo",
+		Description: "echoes text",
+		InputSchema: tools.GenerateSchema[struct {
+			Text string `json:"text"`
+		}](),
+		Function: func(input json.RawMessage) (string, error) {
+			var in struct {
+				Text string `json:"text"`
+			}
+			if err := json.Unmarshal(input, &in); err != nil {
+				return "", err
+			}
+			return in.Text, nil
+		},
+	}
+	r := runner.New(provider.NewOpenAI(srv.URL, ""), []tools.ToolDefinition{echo})
+	conv := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("say hi"))}
+
+	msg, results, err := r.RunOneStep(context.Background(), "local", conv)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if msg.StopReason != anthropic.StopReasonToolUse {
+		t.Errorf("stop_reason = %q", msg.StopReason)
+	}
+	if len(results) != 1 || results[0].OfToolResult == nil {
+		t.Fatalf("want 1 tool_result, got %+v", results)
+	}
+	tr := results[0].OfToolResult
+	if tr.ToolUseID != "call_1" || len(tr.Content) != 1 || tr.Content[0].OfText.Text != "hi" {
+		t.Fatalf("unexpected tool_result: %+v", tr)
+	}
+
+	usage := filterEventsByName(readEventLines(t), "api_usage")
+	if len(usage) != 1 {
+		t.Fatalf("want 1 api_usage event, got %d", len(usage))
+	}
+	var m map[string]any
+	_ = json.Unmarshal(usage[0], &m)
+	if m["provider"] != "openai" || m["input_tokens"] != float64(4) || m["output_tokens"] != float64(3) {
+		t.Errorf("unexpected api_usage: %v", m)
+	}
+}
+
+// After the loop guard trips, the wrap-up request must reach an OpenAI server with
+// tool_choice none, or the model keeps calling tools and the user gets no answer.
+func TestRunner_OpenAIProvider_LoopGuardWrapUpDisablesTools(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "100000")
+	t.Setenv("AGT_MAX_STEPS", "2")
+	_ = chdirTemp(t)
+
+	var choices []any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			ToolChoice any `json:"tool_choice"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		choices = append(choices, body.ToolChoice)
+		if body.ToolChoice == "none" {
+			_, _ = io.WriteString(w, `{"id":"c2","model":"local","choices":[{"message":{"role":"assistant","content":"Here is what I found."},"finish_reason":"stop"}]}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"id":"c1","model":"local","choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"type":"function","function":{"name":"read","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`)
+	}))
+	defer srv.Close()
+
+	read := tools.ToolDefinition{Name: "read", Description: "reads", InputSchema: tools.GenerateSchema[struct{}](),
+		Function: func(json.RawMessage) (string, error) { return "contents", nil }}
+	r := runner.New(provider.NewOpenAI(srv.URL, ""), []tools.ToolDefinition{read})
+
+	var (
+		conv []anthropic.MessageParam
+		err  error
+	)
+	_ = captureStdout(t, func() {
+		conv, _, err = r.RunTurn(context.Background(), "local", []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("read it"))})
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(choices) != 3 || choices[0] != nil || choices[2] != "none" {
+		t.Fatalf("want tool_choice unset, unset, none; got %v", choices)
+	}
+	last := conv[len(conv)-1]
+	if last.Role != anthropic.MessageParamRoleAssistant || len(last.Content) != 1 || last.Content[0].OfText == nil {
+		t.Fatalf("turn should end with the wrap-up answer, got %+v", last)
+	}
+}
+
+// Chat Completions does not continue a trailing assistant message, so a reply cut off
+// at max_tokens is kept as it is rather than joined to an unrelated fresh reply.
+func TestRunner_OpenAIProvider_CutOffReplyNotContinued(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	_ = chdirTemp(t)
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		_, _ = io.WriteString(w, `{"id":"c1","model":"local","choices":[{"message":{"role":"assistant","content":"The first half of"},"finish_reason":"length"}]}`)
+	}))
+	defer srv.Close()
+	r := runner.New(provider.NewOpenAI(srv.URL, ""), nil)
+
+	var (
+		msg *anthropic.Message
+		err error
+	)
+	_ = captureStdout(t, func() {
+		msg, _, err = r.RunOneStep(context.Background(), "local", []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("explain"))})
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("want 1 request, got %d", calls)
+	}
+	if msg.StopReason != anthropic.StopReasonMaxTokens || len(msg.Content) != 1 || msg.Content[0].Text != "The first half of" {
+		t.Fatalf("cut-off reply changed: %+v", msg)
+	}
+}
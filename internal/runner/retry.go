@@ -0,0 +1,206 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/telemetry"
+)
+
+// RetryPolicy bounds retries of transient API failures (429, 529 overloaded, 5xx and
+// network errors). Backoff is exponential with full jitter; a server-provided
+// retry-after header takes precedence over the computed delay.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first; <= 1 disables retries
+	BaseDelay   time.Duration // backoff before jitter for the first retry; doubles per attempt
+	MaxDelay    time.Duration // cap on a single computed (non retry-after) delay
+	MaxElapsed  time.Duration // cap on total time across attempts; 0 means no cap beyond ctx
+}
+
+// DefaultRetryPolicy returns the policy used by New.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    8 * time.Second,
+		MaxElapsed:  45 * time.Second,
+	}
+}
+
+// withRetry calls send under r.Retry; see sendWithRetry.
+func (r *Runner) withRetry(ctx context.Context, model anthropic.Model, send func(context.Context) (*provider.Response, error)) (*provider.Response, error) {
+	return sendWithRetry(ctx, r.Provider, r.Retry, model, send)
+}
+
+// sendWithRetry calls send until it succeeds, a non-retryable error occurs, or the
+// policy p (attempts, elapsed time, ctx deadline) is exhausted. Each failed retryable
+// attempt emits an api_retry event for prov; the last error is returned unchanged.
+func sendWithRetry(ctx context.Context, prov provider.Provider, p RetryPolicy, model anthropic.Model, send func(context.Context) (*provider.Response, error)) (*provider.Response, error) {
+	start := time.Now()
+	turnID, _ := telemetry.TurnIDFromContext(ctx)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := send(ctx)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		status, class, header, ok := classifyAPIError(err)
+		if !ok {
+			return nil, err
+		}
+
+		delay, fromHeader := retryDelay(p, attempt, header)
+		giveUp := ""
+		switch {
+		case attempt >= p.MaxAttempts:
+			giveUp = "max_attempts"
+		case p.MaxElapsed > 0 && time.Since(start)+delay > p.MaxElapsed:
+			giveUp = "max_elapsed"
+		default:
+			if dl, has := ctx.Deadline(); has && time.Now().Add(delay).After(dl) {
+				giveUp = "deadline"
+			}
+		}
+
+		fields := map[string]any{
+			"turn_id":     turnID,
+			"provider":    prov.Name(),
+			"model":       string(model),
+			"attempt":     attempt,
+			"status":      status,
+			"error_class": class,
+			"delay_ms":    delay.Milliseconds(),
+			"retry_after": fromHeader,
+			"will_retry":  giveUp == "",
+		}
+		if giveUp != "" {
+			fields["delay_ms"] = 0
+			fields["give_up_reason"] = giveUp
+		}
+		telemetry.Emit("api_retry", fields)
+
+		if giveUp != "" {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "api: %s (status %d); retrying in %s (attempt %d/%d)\n", class, status, delay.Round(time.Millisecond), attempt+1, p.MaxAttempts)
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+	}
+}
+
+// classifyAPIError reports whether err is transient. It returns the HTTP status
+// (0 for transport failures), a short class for telemetry, and response headers
+// when available.
+func classifyAPIError(err error) (status int, class string, header http.Header, retryable bool) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, "", nil, false
+	}
+	// Output was already printed; a retry would duplicate it.
+	if errors.Is(err, provider.ErrPartialStream) {
+		return 0, "", nil, false
+	}
+
+	var httpErr *provider.HTTPError
+	if errors.As(err, &httpErr) {
+		status = httpErr.StatusCode
+		header = httpErr.Header
+		// Respect an explicit server hint either way.
+		switch header.Get("x-should-retry") {
+		case "true":
+			return status, statusClass(status), header, true
+		case "false":
+			return status, statusClass(status), header, false
+		}
+		switch {
+		case status == http.StatusTooManyRequests, status == 529, status == http.StatusRequestTimeout, status >= 500:
+			return status, statusClass(status), header, true
+		}
+		return status, statusClass(status), header, false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return 0, "network", nil, true
+	}
+	return 0, "", nil, false
+}
+
+func statusClass(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "rate_limited"
+	case status == 529:
+		return "overloaded"
+	case status == http.StatusRequestTimeout:
+		return "timeout"
+	case status >= 500:
+		return "server_error"
+	}
+	return "client_error"
+}
+
+// retryDelay returns the wait before the next attempt. A retry-after-ms or
+// retry-after (seconds or HTTP date) header wins; otherwise full jitter over
+// min(MaxDelay, BaseDelay*2^(attempt-1)).
+func retryDelay(p RetryPolicy, attempt int, header http.Header) (time.Duration, bool) {
+	if d, ok := parseRetryAfter(header, time.Now()); ok {
+		return d, true
+	}
+	backoff := p.BaseDelay << (attempt - 1)
+	if backoff <= 0 || (p.MaxDelay > 0 && backoff > p.MaxDelay) {
+		backoff = p.MaxDelay
+	}
+	if backoff <= 0 {
+		return 0, false
+	}
+	return time.Duration(rand.Int64N(int64(backoff) + 1)), false
+}
+
+// parseRetryAfter reads retry-after-ms, then retry-after as delta-seconds or an HTTP date.
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if header == nil {
+		return 0, false
+	}
+	if v := strings.TrimSpace(header.Get("retry-after-ms")); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	v := strings.TrimSpace(header.Get("retry-after"))
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,289 @@
+package runner_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+const okMessage = `{"id":"msg_ok","type":"message","role":"assistant","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":1,"output_tokens":1}}`
+
+// fastRetry keeps test backoff in the millisecond range.
+var fastRetry = runner.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, MaxElapsed: 5 * time.Second}
+
+// flakyServer fails the first `failures` requests via fail, then serves okBody.
+func flakyServer(t *testing.T, failures int32, fail func(w http.ResponseWriter), okBody string) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if n <= failures {
+			fail(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(okBody))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func newServerRunner(srv *httptest.Server) *runner.Runner {
+	c := anthropic.NewClient(option.WithBaseURL(srv.URL), option.WithAPIKey("test-key"))
+	r := runner.New(provider.NewAnthropic(&c), tools.Registry())
+	r.Retry = fastRetry
+	return r
+}
+
+func apiRetryEvents(t *testing.T) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, b := range filterEventsByName(readEventLines(t), "api_retry") {
+		var m map[string]any
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatalf("invalid api_retry json: %v", err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func userConv(text string) []anthropic.MessageParam {
+	return []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(text))}
+}
+
+func TestRetry_429ThenSuccess_EmitsApiRetryPerAttempt(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	srv, calls := flakyServer(t, 2, func(w http.ResponseWriter) {
+		w.Header().Set("retry-after", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"slow down"}}`))
+	}, okMessage)
+	r := newServerRunner(srv)
+
+	_ = captureStdout(t, func() {
+		if _, _, err := r.RunOneStep(context.Background(), provider.DefaultModel, userConv("hi")); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+	if got := atomic.LoadInt32(calls); got != 3 {
+		t.Fatalf("want 3 attempts, got %d", got)
+	}
+
+	evs := apiRetryEvents(t)
+	if len(evs) != 2 {
+		t.Fatalf("want 2 api_retry events, got %d", len(evs))
+	}
+	for i, m := range evs {
+		if m["attempt"] != float64(i+1) || m["status"] != float64(429) || m["will_retry"] != true {
+			t.Errorf("event %d: unexpected fields %v", i, m)
+		}
+		if m["retry_after"] != true || m["delay_ms"] != float64(0) {
+			t.Errorf("event %d: expected retry-after: 0 to be honoured, got %v", i, m)
+		}
+		if m["error_class"] != "rate_limited" {
+			t.Errorf("event %d: error_class = %v", i, m["error_class"])
+		}
+	}
+}
+
+func TestRetry_Overloaded_ExhaustsMaxAttempts(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	srv, calls := flakyServer(t, 100, func(w http.ResponseWriter) {
+		w.WriteHeader(529)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"overloaded"}}`))
+	}, okMessage)
+	r := newServerRunner(srv)
+
+	if _, _, err := r.RunOneStep(context.Background(), provider.DefaultModel, userConv("hi")); err == nil {
+		t.Fatal("expected error after exhausting attempts")
+	}
+	if got := atomic.LoadInt32(calls); got != int32(fastRetry.MaxAttempts) {
+		t.Fatalf("want %d attempts, got %d", fastRetry.MaxAttempts, got)
+	}
+	evs := apiRetryEvents(t)
+	if len(evs) != fastRetry.MaxAttempts {
+		t.Fatalf("want %d api_retry events, got %d", fastRetry.MaxAttempts, len(evs))
+	}
+	last := evs[len(evs)-1]
+	if last["will_retry"] != false || last["give_up_reason"] != "max_attempts" || last["status"] != float64(529) {
+		t.Fatalf("unexpected final api_retry event: %v", last)
+	}
+}
+
+func TestRetry_ClientError_NotRetried(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	srv, calls := flakyServer(t, 100, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`))
+	}, okMessage)
+	r := newServerRunner(srv)
+
+	if _, _, err := r.RunOneStep(context.Background(), provider.DefaultModel, userConv("hi")); err == nil {
+		t.Fatal("expected 400 error")
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Fatalf("want 1 attempt for 400, got %d", got)
+	}
+	if evs := apiRetryEvents(t); len(evs) != 0 {
+		t.Fatalf("want no api_retry events for 400, got %d", len(evs))
+	}
+}
+
+func TestRetry_HonoursRetryAfterSeconds(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	srv, calls := flakyServer(t, 1, func(w http.ResponseWriter) {
+		w.Header().Set("retry-after", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, okMessage)
+	r := newServerRunner(srv)
+
+	start := time.Now()
+	_ = captureStdout(t, func() {
+		if _, _, err := r.RunOneStep(context.Background(), provider.DefaultModel, userConv("hi")); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Fatalf("retry-after not honoured; elapsed %s", elapsed)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Fatalf("want 2 attempts, got %d", got)
+	}
+	evs := apiRetryEvents(t)
+	if len(evs) != 1 || evs[0]["delay_ms"] != float64(1000) || evs[0]["status"] != float64(503) {
+		t.Fatalf("unexpected api_retry events: %v", evs)
+	}
+}
+
+func TestRetry_RespectsContextDeadline(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	srv, calls := flakyServer(t, 100, func(w http.ResponseWriter) {
+		w.Header().Set("retry-after", "3") // within MaxElapsed, beyond the ctx deadline
+		w.WriteHeader(http.StatusTooManyRequests)
+	}, okMessage)
+	r := newServerRunner(srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := r.RunOneStep(ctx, provider.DefaultModel, userConv("hi")); err == nil {
+		t.Fatal("expected error when retry-after exceeds the turn deadline")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("should give up without sleeping past the deadline; elapsed %s", elapsed)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Fatalf("want 1 attempt, got %d", got)
+	}
+	evs := apiRetryEvents(t)
+	if len(evs) != 1 || evs[0]["give_up_reason"] != "deadline" {
+		t.Fatalf("unexpected api_retry events: %v", evs)
+	}
+}
+
+func TestRetry_NetworkError_Retried(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	// First request: drop the connection without a response.
+	srv, calls := flakyServer(t, 1, func(w http.ResponseWriter) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Fatal("hijacking not supported")
+		}
+		conn, _, err := hj.Hijack()
+		if err != nil {
+			t.Fatalf("hijack: %v", err)
+		}
+		_ = conn.Close()
+	}, okMessage)
+	r := newServerRunner(srv)
+
+	_ = captureStdout(t, func() {
+		if _, _, err := r.RunOneStep(context.Background(), provider.DefaultModel, userConv("hi")); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Fatalf("want 2 attempts, got %d", got)
+	}
+	evs := apiRetryEvents(t)
+	if len(evs) != 1 || evs[0]["error_class"] != "network" || evs[0]["status"] != float64(0) {
+		t.Fatalf("unexpected api_retry events: %v", evs)
+	}
+}
+
+func TestRetry_Streaming_RetriedBeforeStreamStarts(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_STREAM", "1")
+	_ = chdirTemp(t)
+
+	srv, calls := flakyServer(t, 1, func(w http.ResponseWriter) {
+		w.WriteHeader(529)
+	}, string(streamedTextAndToolUse))
+	r := newServerRunner(srv)
+	r.Tools = nil // only the stream matters here; keep fsops roots untouched
+
+	out := captureStdout(t, func() {
+		if _, _, err := r.RunOneStep(context.Background(), provider.DefaultModel, userConv("hi")); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Fatalf("want 2 attempts, got %d", got)
+	}
+	if c := strings.Count(out, "Let me look."); c != 1 {
+		t.Fatalf("streamed text should print exactly once, got %d in %q", c, out)
+	}
+}
+
+func TestRetry_SummarizerRetriesTransientFailures(t *testing.T) {
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	srv, calls := flakyServer(t, 2, func(w http.ResponseWriter) {
+		w.WriteHeader(529)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"overloaded_error","message":"overloaded"}}`))
+	}, okMessage)
+	c := anthropic.NewClient(option.WithBaseURL(srv.URL), option.WithAPIKey("test-key"))
+	s := runner.ModelSummarizer{Provider: provider.NewAnthropic(&c), Model: provider.DefaultModel, Retry: fastRetry}
+
+	summary, err := s.Summarize(context.Background(), "", userConv("hi"))
+	if err != nil || summary != "ok" {
+		t.Fatalf("Summarize = %q, %v", summary, err)
+	}
+	if got := atomic.LoadInt32(calls); got != 3 {
+		t.Fatalf("want 3 attempts, got %d", got)
+	}
+	if evs := apiRetryEvents(t); len(evs) != 2 {
+		t.Fatalf("want 2 api_retry events, got %d", len(evs))
+	}
+}
@@ -3,9 +3,8 @@ package runner
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -13,20 +12,36 @@ import (
 	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
-	"github.com/anthropics/anthropic-sdk-go/option"
 	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/safety"
 	"github.com/petasbytes/go-agent/internal/telemetry"
 	"github.com/petasbytes/go-agent/internal/windowing"
 	"github.com/petasbytes/go-agent/tools"
 )
 
 type Runner struct {
-	Client *anthropic.Client
-	Tools  []tools.ToolDefinition
+	Provider provider.Provider
+	Tools    []tools.ToolDefinition
+	Retry    RetryPolicy // transient API failure handling; see DefaultRetryPolicy
+	// Compactor, when set, summarises groups that no longer fit AGT_TOKEN_BUDGET
+	// instead of dropping them (see CompactionFromEnv).
+	Compactor *windowing.Compactor
+	// Counter sizes groups against AGT_TOKEN_BUDGET; HeuristicCounter when nil
+	// (see CounterFromEnv).
+	Counter windowing.TokenCounter
+	// System is sent as the system prompt of every request and charged against
+	// AGT_TOKEN_BUDGET first (see SystemPromptFromEnv).
+	System string
+	// Pinned lists indices of conversation messages that are always sent, whatever
+	// their age; their groups are charged against the budget before older history.
+	Pinned []int
+	// Spec gives the limits of the model it names (see provider.ModelFromEnv); other
+	// models are looked up in provider.Catalog.
+	Spec provider.ModelSpec
 }
 
-func New(client *anthropic.Client, toolDefs []tools.ToolDefinition) *Runner {
-	return &Runner{Client: client, Tools: toolDefs}
+func New(p provider.Provider, toolDefs []tools.ToolDefinition) *Runner {
+	return &Runner{Provider: p, Tools: toolDefs, Retry: DefaultRetryPolicy()}
 }
 
 func (r *Runner) anthropicTools() []anthropic.ToolUnionParam {
@@ -41,20 +56,68 @@ func (r *Runner) anthropicTools() []anthropic.ToolUnionParam {
 	return out
 }
 
+// fallbackMaxTokens is the output limit for models outside the catalog.
+const fallbackMaxTokens = 1024
+
+// modelSpec returns the limits of model: r.Spec when it names model, else the catalog entry.
+func (r *Runner) modelSpec(model anthropic.Model) (provider.ModelSpec, bool) {
+	if r.Spec.ID != "" && r.Spec.ID == string(model) {
+		return r.Spec, true
+	}
+	return provider.LookupModel(string(model))
+}
+
 // RunOneStep sends the conversation and either prints text or returns tool results to be appended.
 func (r *Runner) RunOneStep(ctx context.Context, model anthropic.Model, conv []anthropic.MessageParam) (*anthropic.Message, []anthropic.ContentBlockParamUnion, error) {
-	v := os.Getenv("AGT_TOKEN_BUDGET")
-	if v == "" {
+	return r.runStep(ctx, model, conv, true)
+}
+
+// runStep implements RunOneStep. With allowTools false the model is asked not to
+// call tools (tool_choice none) and any tool_use it still returns is refused.
+func (r *Runner) runStep(ctx context.Context, model anthropic.Model, conv []anthropic.MessageParam, allowTools bool) (*anthropic.Message, []anthropic.ContentBlockParamUnion, error) {
+	// Output and input limits default from the model catalog; models outside it need
+	// AGT_TOKEN_BUDGET.
+	spec, known := r.modelSpec(model)
+	maxTokens := int64(fallbackMaxTokens)
+	if known {
+		maxTokens = spec.DefaultMaxTokens()
+	}
+	if v := strings.TrimSpace(os.Getenv("AGT_MAX_TOKENS")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, nil, fmt.Errorf("invalid AGT_MAX_TOKENS %q: want a positive number of tokens", v)
+		}
+		maxTokens = n
+	}
+	var (
+		budget int
+		err    error
+	)
+	if v := os.Getenv("AGT_TOKEN_BUDGET"); v != "" {
+		if budget, err = strconv.Atoi(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid AGT_TOKEN_BUDGET %q: %w", v, err)
+		}
+	} else if known {
+		budget = spec.InputBudget(maxTokens)
+	} else {
 		return nil, nil, fmt.Errorf("AGT_TOKEN_BUDGET not set; export it then try again")
 	}
-	budget, err := strconv.Atoi(v)
+
+	// Optional elision of stale tool_result payloads (recent N pairs stay verbatim)
+	keepRecent := -1
+	if v := strings.TrimSpace(os.Getenv("AGT_ELIDE_TOOL_RESULTS")); v != "" {
+		if keepRecent, err = strconv.Atoi(v); err != nil || keepRecent < 0 {
+			return nil, nil, fmt.Errorf("invalid AGT_ELIDE_TOOL_RESULTS %q: want the number of recent tool pairs to keep verbatim", v)
+		}
+	}
+	maxContinuations, err := maxContinuationsFromEnv()
 	if err != nil {
-		return nil, nil, fmt.Errorf("invalid AGT_TOKEN_BUDGET %q: %w", v, err)
+		return nil, nil, err
+	}
+	toolWorkers, err := toolWorkersFromEnv()
+	if err != nil {
+		return nil, nil, err
 	}
-
-	// Prepare pair-safe, budgeted window
-	counter := windowing.HeuristicCounter{}
-	window, stats := windowing.PrepareSendWindow(conv, budget, counter)
 
 	// Get turnID from context if present, else generate once for this call.
 	turnID, ok := telemetry.TurnIDFromContext(ctx)
@@ -64,20 +127,86 @@ func (r *Runner) RunOneStep(ctx context.Context, model anthropic.Model, conv []a
 
 	ctx = telemetry.WithTurnID(ctx, turnID)
 
+	// Prepare pair-safe, budgeted window (optionally eliding stale tool output and
+	// compacting dropped groups). Elision only applies once the history no longer fits.
+	var counter windowing.TokenCounter = windowing.HeuristicCounter{}
+	if r.Counter != nil {
+		counter = r.Counter
+	}
+	// Token-based budgets must leave room for the output within the context window
+	// (the rune heuristic overestimates tokens, so its budgets are not checked).
+	if _, runes := counter.(windowing.HeuristicCounter); known && !runes && budget+int(maxTokens) > spec.ContextWindow {
+		return nil, nil, fmt.Errorf("AGT_TOKEN_BUDGET %d plus max_tokens %d exceeds the %d-token context window of %s", budget, maxTokens, spec.ContextWindow, spec.ID)
+	}
+	// Tools are sent with every request (except in calibration mode); counters that can
+	// size them take their cost out of the budget for messages.
+	var toolParams []anthropic.ToolUnionParam
+	if !telemetry.CalibrationModeEnabled() {
+		toolParams = r.anthropicTools()
+	}
+	toolsCost := 0
+	if tc, ok := counter.(windowing.ToolCounter); ok {
+		toolsCost = tc.CountTools(ctx, toolParams)
+	}
+	// The system prompt is always sent, so it is charged before any message.
+	systemCost := 0
+	if r.System != "" {
+		systemCost = counter.CountMessage(ctx, systemMessage(r.System))
+	}
+	msgBudget := budget - toolsCost - systemCost
+	if systemCost > 0 && msgBudget <= 0 {
+		return nil, nil, fmt.Errorf("windowing: system prompt (%d) and tool definitions (%d) exceed AGT_TOKEN_BUDGET %d", systemCost, toolsCost, budget)
+	}
+	var (
+		window  []anthropic.MessageParam
+		stats   windowing.Stats
+		elision windowing.Elision
+	)
+	stored := conv // before elision; keys the compactor's summary cache
+	if keepRecent >= 0 {
+		if _, st := windowing.PrepareSendWindow(ctx, conv, msgBudget, counter, r.Pinned...); st.SkippedGroups > 0 {
+			conv, elision = windowing.ElideStaleToolResults(conv, keepRecent)
+		}
+	}
+	if r.Compactor != nil {
+		window, stats, err = r.Compactor.PrepareKeyedWindow(ctx, conv, stored, msgBudget, counter, r.Pinned...)
+		if err != nil {
+			// The window falls back to dropping the oldest groups.
+			fmt.Fprintf(os.Stderr, "warning: compaction failed: %v\n", err)
+		}
+	} else {
+		window, stats = windowing.PrepareSendWindow(ctx, conv, msgBudget, counter, r.Pinned...)
+	}
+	stats.ElidedResults, stats.ElidedRunes = elision.Results, elision.Runes
+	if toolsCost > 0 || systemCost > 0 {
+		stats.Budget, stats.ToolsTokens, stats.SystemTokens = budget, toolsCost, systemCost
+		stats.Total += toolsCost + systemCost
+	}
+
 	telemetry.Emit("window_prepared", map[string]any{
 		"turn_id":            turnID,
+		"provider":           r.Provider.Name(),
 		"model":              string(model),
 		"budget":             stats.Budget,
 		"total_estimated":    stats.Total,
 		"included_groups":    stats.IncludedGroups,
 		"skipped_groups":     stats.SkippedGroups,
 		"over_budget_newest": stats.OverBudgetNewest,
+		"compacted_groups":   stats.CompactedGroups,
+		"summary_tokens":     stats.SummaryTokens,
+		"summary_cached":     stats.SummaryCached,
+		"elided_results":     stats.ElidedResults,
+		"elided_runes":       stats.ElidedRunes,
+		"tools_tokens":       stats.ToolsTokens,
+		"system_tokens":      stats.SystemTokens,
+		"pinned_groups":      stats.PinnedGroups,
+		"pinned_tokens":      stats.PinnedTokens,
 	})
 
 	if os.Getenv("AGT_VERBOSE_WINDOW_LOGS") == "1" {
 		fmt.Printf(
-			"window: model=%s budget=%d est_total=%d groups_in=%d groups_skip=%d newest_over=%t\n",
-			string(model), stats.Budget, stats.Total, stats.IncludedGroups, stats.SkippedGroups, stats.OverBudgetNewest,
+			"window: model=%s budget=%d est_total=%d groups_in=%d groups_skip=%d groups_compacted=%d summary=%d elided=%d pinned=%d newest_over=%t\n",
+			string(model), stats.Budget, stats.Total, stats.IncludedGroups, stats.SkippedGroups, stats.CompactedGroups, stats.SummaryTokens, stats.ElidedResults, stats.PinnedTokens, stats.OverBudgetNewest,
 		)
 	}
 
@@ -87,87 +216,83 @@ func (r *Runner) RunOneStep(ctx context.Context, model anthropic.Model, conv []a
 	if stats.OverBudgetNewest {
 		return nil, nil, fmt.Errorf("windowing: newest group exceeds AGT_TOKEN_BUDGET; increase budget with headroom or tighten tool caps")
 	}
+	if stats.OverBudgetPinned {
+		return nil, nil, fmt.Errorf("windowing: pinned messages and system prompt exceed AGT_TOKEN_BUDGET; unpin messages or increase the budget")
+	}
 
 	// Build final request params from the prepared window; gate Tools on calibration mode
 	params := anthropic.MessageNewParams{
 		Model:     model,
-		MaxTokens: int64(1024),
+		MaxTokens: maxTokens,
 		Messages:  window,
 	}
+	if r.System != "" {
+		params.System = []anthropic.TextBlockParam{{Text: r.System}}
+	}
 	// Only include tools when NOT in calibration mode
 	if !telemetry.CalibrationModeEnabled() {
-		params.Tools = r.anthropicTools()
+		params.Tools = toolParams
+		if !allowTools && len(toolParams) > 0 {
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}
+		}
+	}
+	if known {
+		if err := spec.Validate(params); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	// Persist exact request payload if enabled
 	if telemetry.PersistPayloadsEnabled() {
-		// Resolve artifacts base dir
-		base := strings.TrimSpace(os.Getenv("AGT_ARTIFACTS_DIR"))
-		if base == "" {
-			base = ".agent"
-		}
-		// Ensure payloads/{turn_id} exists
-		turnID, _ := telemetry.TurnIDFromContext(ctx)
-		if strings.TrimSpace(turnID) == "" {
-			turnID = "turn-unknown"
-		}
-		dir := filepath.Join(base, "payloads", turnID)
-		if err := os.MkdirAll(dir, 0o755); err == nil {
-			// Serialise the exact params as sent
-			if b, err := json.Marshal(params); err == nil {
-				if err := os.WriteFile(filepath.Join(dir, "request.json"), b, 0o644); err != nil {
-					fmt.Fprintf(os.Stderr, "payloads: write request.json: %v\n", err)
-				}
-			} else {
-				fmt.Fprintf(os.Stderr, "payloads: marshal request params: %v\n", err)
-			}
+		// Serialise the exact params as sent
+		if b, err := json.Marshal(params); err == nil {
+			persistPayload(ctx, "request.json", b)
 		} else {
-			fmt.Fprintf(os.Stderr, "payloads: mkdir %s: %v\n", dir, err)
+			fmt.Fprintf(os.Stderr, "payloads: marshal request params: %v\n", err)
 		}
 	}
 
-	// Capture raw HTTP response for payload persistence
-	var httpResp *http.Response
-	msg, err := r.Client.Messages.New(ctx, params, option.WithResponseInto(&httpResp))
+	// Streaming mode prints text deltas as they arrive; otherwise wait for the full message.
+	// Transient failures (429/529/5xx/network) are retried per r.Retry.
+	streaming := os.Getenv("AGT_STREAM") == "1"
+	req := provider.Request{Params: params, Stream: streaming, CaptureRaw: telemetry.PersistPayloadsEnabled()}
+	var printer *textPrinter
+	if streaming {
+		printer = &textPrinter{index: -1}
+		req.OnText = printer.write
+	}
+	resp, err := r.withRetry(ctx, model, func(ctx context.Context) (*provider.Response, error) {
+		return r.Provider.SendMessage(ctx, req)
+	})
 	if err != nil {
+		if printer != nil {
+			printer.finish()
+		}
 		return nil, nil, err
 	}
+	msg := resp.Message
 
-	// Persist exact response wire JSON if enabled
-	if telemetry.PersistPayloadsEnabled() && httpResp != nil && httpResp.Body != nil {
-		base := strings.TrimSpace(os.Getenv("AGT_ARTIFACTS_DIR"))
-		if base == "" {
-			base = ".agent"
-		}
-		turnID, _ := telemetry.TurnIDFromContext(ctx)
-		if strings.TrimSpace(turnID) == "" {
-			turnID = "turn-unknown"
+	// Persist exact response wire payloads if enabled
+	if telemetry.PersistPayloadsEnabled() {
+		if resp.RawStream != nil {
+			persistPayload(ctx, "response.sse", resp.RawStream)
 		}
-		dir := filepath.Join(base, "payloads", turnID)
-		if err := os.MkdirAll(dir, 0o755); err == nil {
-			// Read entire body then write to file; close safely
-			bodyBytes, readErr := io.ReadAll(httpResp.Body)
-			_ = httpResp.Body.Close()
-			if readErr != nil {
-				fmt.Fprintf(os.Stderr, "payloads: read response body: %v\n", readErr)
-			} else if err := os.WriteFile(filepath.Join(dir, "response.json"), bodyBytes, 0o644); err != nil {
-				fmt.Fprintf(os.Stderr, "payloads: write response.json: %v\n", err)
-			}
-		} else {
-			fmt.Fprintf(os.Stderr, "payloads: mkdir %s: %v\n", dir, err)
+		if resp.RawBody != nil {
+			persistPayload(ctx, "response.json", resp.RawBody)
 		}
 	}
 
-	// Emit api_usage on successful non-streaming responses.
+	// Emit api_usage on successful responses (streamed usage is accumulated from message_start/message_delta).
 	// Guard on usage presence (defensive) and observation enabled.
 	if telemetry.ObserveEnabled() {
-		apiVersion := provider.APIVersion
+		apiVersion := r.Provider.APIVersion()
 
-		// Only emit when usage appears present (non-streaming success responses include usage).
+		// Only emit when usage appears present (success responses include usage).
 		if msg.Usage.InputTokens != 0 || msg.Usage.OutputTokens != 0 {
 			turnID, _ := telemetry.TurnIDFromContext(ctx)
-			telemetry.Emit("api_usage", map[string]any{
+			fields := map[string]any{
 				"turn_id":                  turnID,
+				"provider":                 r.Provider.Name(),
 				"model":                    string(model),
 				"api_version":              apiVersion,
 				"message_id":               msg.ID,
@@ -176,17 +301,35 @@ func (r *Runner) RunOneStep(ctx context.Context, model anthropic.Model, conv []a
 				"output_tokens":            msg.Usage.OutputTokens,
 				"prepared_estimated_total": stats.Total,
 				"max_tokens":               params.MaxTokens,
-			})
+				"streaming":                streaming,
+			}
+			// Calibration samples: the sent content by class, fitted against input_tokens by `agent calibrate`.
+			if telemetry.CalibrationModeEnabled() {
+				sent := window
+				if r.System != "" {
+					sent = append([]anthropic.MessageParam{systemMessage(r.System)}, window...)
+				}
+				fields["prepared_runes"] = windowing.MeasureContent(sent)
+			}
+			telemetry.Emit("api_usage", fields)
 		}
 	}
 
-	// Always print assistant text blocks.
-	for _, block := range msg.Content {
-		switch v := block.AsAny().(type) {
-		case anthropic.TextBlock:
-			fmt.Printf("\u001b[93mClaude\u001b[0m: %s\n", v.Text)
-		case anthropic.ToolUseBlock:
-			// Tool uses are handled below when not in calibration mode.
+	// A reply cut off at max_tokens mid-text is continued and merged into one message.
+	msg = r.continueReply(ctx, model, req, msg, maxContinuations, printer)
+	if printer != nil {
+		printer.finish()
+	}
+
+	// Always print assistant text blocks (already printed incrementally when streaming).
+	if !streaming {
+		for _, block := range msg.Content {
+			switch v := block.AsAny().(type) {
+			case anthropic.TextBlock:
+				fmt.Printf("\u001b[93mClaude\u001b[0m: %s\n", v.Text)
+			case anthropic.ToolUseBlock:
+				// Tool uses are handled below when not in calibration mode.
+			}
 		}
 	}
 
@@ -195,20 +338,119 @@ func (r *Runner) RunOneStep(ctx context.Context, model anthropic.Model, conv []a
 		return msg, nil, nil
 	}
 	// Normal path: execute tools when not in calibration mode.
-	toolResults := []anthropic.ContentBlockParamUnion{}
-	for _, block := range msg.Content {
+	var calls []toolCall
+	truncated := truncatedToolUse(msg)
+	for i, block := range msg.Content {
 		switch v := block.AsAny().(type) {
 		case anthropic.ToolUseBlock:
-			input := json.RawMessage(v.JSON.Input.Raw())
-			res := r.execTool(ctx, v.ID, v.Name, input)
-			toolResults = append(toolResults, res)
+			calls = append(calls, toolCall{
+				id:    v.ID,
+				name:  v.Name,
+				input: json.RawMessage(v.JSON.Input.Raw()),
+				// A tool_use cut off at max_tokens has incomplete input; report it instead of running it.
+				truncated: truncated && i == len(msg.Content)-1,
+				refused:   !allowTools,
+			})
 		}
 	}
+	toolResults := r.execTools(ctx, calls, toolWorkers)
 
 	return msg, toolResults, nil
 }
 
-func (r *Runner) execTool(ctx context.Context, id, name string, input json.RawMessage) anthropic.ContentBlockParamUnion {
+// Usage sums model usage across the steps of a turn.
+type Usage struct {
+	Steps        int // model calls that returned a message
+	InputTokens  int64
+	OutputTokens int64
+}
+
+// RunTurn runs steps until the assistant replies without tool calls, appending each
+// assistant message and its tool results to conv. The extended conversation and the
+// usage so far are returned even on error so callers keep the steps that completed.
+func (r *Runner) RunTurn(ctx context.Context, model anthropic.Model, conv []anthropic.MessageParam) ([]anthropic.MessageParam, Usage, error) {
+	var usage Usage
+	guard, err := loopGuardFromEnv()
+	if err != nil {
+		return conv, usage, err
+	}
+	allowTools := true
+	for {
+		msg, toolResults, err := r.runStep(ctx, model, conv, allowTools)
+		if err != nil {
+			return conv, usage, err
+		}
+		usage.Steps++
+		usage.InputTokens += msg.Usage.InputTokens
+		usage.OutputTokens += msg.Usage.OutputTokens
+		conv = append(conv, msg.ToParam())
+		if len(toolResults) == 0 {
+			return conv, usage, nil // done with assistant turn
+		}
+		if !allowTools {
+			// The model called tools after being told not to; end the turn on the refusals.
+			return append(conv, anthropic.NewUserMessage(toolResults...)), usage, nil
+		}
+		// A looping or runaway turn gets one last step, without tools, to wrap up.
+		if trip := guard.observe(msg, toolResults); trip != nil {
+			r.emitLoopGuard(ctx, model, trip)
+			toolResults = append(toolResults, loopGuardNotice(trip))
+			allowTools = false
+		}
+		// Provide tool results as a user message back to the model
+		conv = append(conv, anthropic.NewUserMessage(toolResults...))
+	}
+}
+
+// textPrinter prints streamed text fragments, starting a prefixed line per content block.
+type textPrinter struct {
+	index    int  // content block currently being printed; -1 before the first fragment
+	printing bool // whether a line is open
+}
+
+func (p *textPrinter) write(index int, delta string) {
+	if !p.printing || index != p.index {
+		if p.printing {
+			fmt.Println()
+		}
+		fmt.Print("\u001b[93mClaude\u001b[0m: ")
+		p.index, p.printing = index, true
+	}
+	fmt.Print(delta)
+}
+
+// finish terminates an open line, including when the stream ended mid-block.
+func (p *textPrinter) finish() {
+	if p.printing {
+		fmt.Println()
+		p.printing = false
+	}
+}
+
+// persistPayload writes data to {AGT_ARTIFACTS_DIR|.agent}/payloads/{turn_id}/name.
+// Failures are reported on stderr and never affect the turn.
+func persistPayload(ctx context.Context, name string, data []byte) {
+	// Resolve artifacts base dir
+	base := strings.TrimSpace(os.Getenv("AGT_ARTIFACTS_DIR"))
+	if base == "" {
+		base = ".agent"
+	}
+	// Ensure payloads/{turn_id} exists
+	turnID, _ := telemetry.TurnIDFromContext(ctx)
+	if strings.TrimSpace(turnID) == "" {
+		turnID = "turn-unknown"
+	}
+	dir := filepath.Join(base, "payloads", turnID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "payloads: mkdir %s: %v\n", dir, err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "payloads: write %s: %v\n", name, err)
+	}
+}
+
+func (r *Runner) execTool(ctx context.Context, id, name string, input json.RawMessage, queued time.Time) anthropic.ContentBlockParamUnion {
 	var def *tools.ToolDefinition
 	for i := range r.Tools {
 		if r.Tools[i].Name == name {
@@ -219,10 +461,14 @@ func (r *Runner) execTool(ctx context.Context, id, name string, input json.RawMe
 
 	turnID, _ := telemetry.TurnIDFromContext(ctx)
 
+	// Queue time runs from dispatch to here; duration_ms covers the run itself.
+	start := time.Now()
+
 	// Helper to emit a tool_exec event
 	emit := func(durationMs int64, inputSize int, outputSize int, errStr string) {
 		fields := map[string]any{
 			"tool_name":   name,
+			"queue_ms":    start.Sub(queued).Milliseconds(),
 			"duration_ms": durationMs,
 			"input_size":  inputSize,
 			"output_size": outputSize,
@@ -236,7 +482,6 @@ func (r *Runner) execTool(ctx context.Context, id, name string, input json.RawMe
 		telemetry.Emit("tool_exec", fields)
 	}
 
-	start := time.Now()
 	inSize := len(input)
 
 	// Handle "tool not found" as an error result and emit telemetry
@@ -245,8 +490,23 @@ func (r *Runner) execTool(ctx context.Context, id, name string, input json.RawMe
 		return anthropic.NewToolResultBlock(id, "tool not found", true)
 	}
 
+	// Reject input that does not match the tool's schema before running it
+	if err := tools.ValidateInput(def.InputSchema, input); err != nil {
+		emit(time.Since(start).Milliseconds(), inSize, 0, "invalid input")
+		return anthropic.NewToolResultBlock(id, err.Error(), true)
+	}
+
 	// Execute the tool
-	resp, err := def.Function(input)
+	resp, err := callTool(ctx, *def, input)
+	var te safety.ToolError
+	if errors.As(err, &te) && (te.Code == errToolTimeout || te.Code == errToolCanceled) {
+		class := "tool timeout"
+		if te.Code == errToolCanceled {
+			class = "tool canceled"
+		}
+		emit(time.Since(start).Milliseconds(), inSize, 0, class)
+		return anthropic.NewToolResultBlock(id, err.Error(), true)
+	}
 	if err != nil {
 		// Emit a generic error string to avoid leaking raw payloads in telemetry
 		emit(time.Since(start).Milliseconds(), inSize, 0, "tool error")
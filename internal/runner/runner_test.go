@@ -14,6 +14,7 @@ import (
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/provider/providertest"
 	"github.com/petasbytes/go-agent/internal/runner"
 	"github.com/petasbytes/go-agent/internal/telemetry"
 	"github.com/petasbytes/go-agent/tools"
@@ -213,13 +214,13 @@ func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
-func newClientWithTransport(rt http.RoundTripper) *anthropic.Client {
+func newClientWithTransport(rt http.RoundTripper) provider.Provider {
 	c := anthropic.NewClient(
 		option.WithHTTPClient(&http.Client{Transport: rt}),
 		option.WithAPIKey("test-key"),
 		// Base URL is irrelevant since transport intercepts
 	)
-	return &c
+	return provider.NewAnthropic(&c)
 }
 
 type reqBody struct {
@@ -236,7 +237,8 @@ func TestRunner_MissingBudget_ReturnsError(t *testing.T) {
 	t.Setenv("AGT_TOKEN_BUDGET", "")
 	cli := newClientWithTransport(&fakeTransport{respStatus: 200, respBody: []byte(`{"content":[],"role":"assistant"}`)})
 	r := runner.New(cli, tools.Registry())
-	_, _, err := r.RunOneStep(context.Background(), provider.DefaultModel, nil)
+	// Catalogued models default the budget; others must set it.
+	_, _, err := r.RunOneStep(context.Background(), "claude-test", nil)
 	if err == nil || !strings.Contains(err.Error(), "AGT_TOKEN_BUDGET not set") {
 		t.Fatalf("expected env error, got %v", err)
 	}
@@ -742,7 +744,8 @@ func TestRunner_ApiUsage_HappyPath_EventFields(t *testing.T) {
 	if _, ok := m["prepared_estimated_total"].(float64); !ok {
 		t.Errorf("prepared_estimated_total not present or not numeric: %v", m["prepared_estimated_total"])
 	}
-	if v, ok := m["max_tokens"].(float64); !ok || v != 1024 {
+	spec, _ := provider.LookupModel(string(provider.DefaultModel))
+	if v, ok := m["max_tokens"].(float64); !ok || v != float64(spec.DefaultMaxTokens()) {
 		t.Errorf("max_tokens = %v", m["max_tokens"])
 	}
 }
@@ -860,3 +863,56 @@ func TestRunner_PrintsAssistantText(t *testing.T) {
 		t.Fatalf("expected assistant text output, got: %q", out)
 	}
 }
+
+func TestRunner_ElidesStaleToolResults_WhenOverBudget(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1500")
+	t.Setenv("AGT_ELIDE_TOOL_RESULTS", "1")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	conv := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("review a.go and b.go"))}
+	for _, id := range []string{"a", "b"} {
+		conv = append(conv,
+			anthropic.NewAssistantMessage(anthropic.NewToolUseBlock(id, map[string]any{"path": id + ".go"}, "read_file")),
+			anthropic.NewUserMessage(anthropic.NewToolResultBlock(id, strings.Repeat("x", 1000), false)),
+		)
+	}
+	fake := providertest.New(t, providertest.Turn{
+		Expect: func(t testing.TB, p anthropic.MessageNewParams) {
+			if len(p.Messages) != len(conv) {
+				t.Fatalf("every message should fit once elided, got %d", len(p.Messages))
+			}
+			if got := providertest.ToolResultText(p.Messages[2].Content[0].OfToolResult); got != "[elided 1,000 runes of read_file output; re-read if needed]" {
+				t.Errorf("stale result not elided: %q", got)
+			}
+			if got := providertest.ToolResultText(p.Messages[4].Content[0].OfToolResult); len(got) != 1000 {
+				t.Errorf("recent result should be verbatim, got %d runes", len(got))
+			}
+		},
+		Text: "done",
+	})
+
+	if _, _, err := runner.New(fake, nil).RunOneStep(context.Background(), provider.DefaultModel, conv); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got := providertest.ToolResultText(conv[2].Content[0].OfToolResult); len(got) != 1000 {
+		t.Fatal("conversation history must keep the full tool output")
+	}
+	evs := filterEventsByName(readEventLines(t), "window_prepared")
+	var m map[string]any
+	if len(evs) != 1 || json.Unmarshal(evs[0], &m) != nil {
+		t.Fatalf("want one window_prepared event, got %d", len(evs))
+	}
+	if m["elided_results"] != float64(1) || m["elided_runes"] != float64(1000) || m["skipped_groups"] != float64(0) {
+		t.Fatalf("unexpected elision fields: %v", m)
+	}
+}
+
+func TestRunner_InvalidElideSetting_ReturnsError(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "100")
+	t.Setenv("AGT_ELIDE_TOOL_RESULTS", "some")
+	r := runner.New(newClientWithTransport(&fakeTransport{}), nil)
+	if _, _, err := r.RunOneStep(context.Background(), provider.DefaultModel, nil); err == nil || !strings.Contains(err.Error(), "AGT_ELIDE_TOOL_RESULTS") {
+		t.Fatalf("expected AGT_ELIDE_TOOL_RESULTS error, got %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package runner_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/internal/telemetry"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+// sseBody builds a text/event-stream body from (event, data) pairs.
+func sseBody(events ...[2]string) []byte {
+	var b strings.Builder
+	for _, ev := range events {
+		b.WriteString("event: " + ev[0] + "\n")
+		b.WriteString("data: " + ev[1] + "\n\n")
+	}
+	return []byte(b.String())
+}
+
+// streamedTextAndToolUse is a canned stream: one text block split across two deltas,
+// then a list_files tool_use whose input arrives as partial JSON fragments.
+var streamedTextAndToolUse = sseBody(
+	[2]string{"message_start", `{"type":"message_start","message":{"id":"msg_s1","type":"message","role":"assistant","model":"claude-3-7-sonnet-latest","content":[],"stop_reason":null,"usage":{"input_tokens":11,"output_tokens":1}}}`},
+	[2]string{"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`},
+	[2]string{"ping", `{"type":"ping"}`},
+	[2]string{"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}`},
+	[2]string{"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"look."}}`},
+	[2]string{"content_block_stop", `{"type":"content_block_stop","index":0}`},
+	[2]string{"content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"t1","name":"list_files","input":{}}}`},
+	[2]string{"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"pa"}}`},
+	[2]string{"content_block_delta", `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"th\": \".\"}"}}`},
+	[2]string{"content_block_stop", `{"type":"content_block_stop","index":1}`},
+	[2]string{"message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":23}}`},
+	[2]string{"message_stop", `{"type":"message_stop"}`},
+)
+
+func TestRunner_Stream_PrintsTextAndReassemblesToolUse(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_STREAM", "1")
+	_ = chdirTemp(t)
+
+	capReq := &capture{}
+	fake := &fakeTransport{respStatus: 200, respBody: streamedTextAndToolUse, captured: capReq}
+	r := runner.New(newClientWithTransport(fake), tools.Registry())
+	conv := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("please list files"))}
+
+	var (
+		msg         *anthropic.Message
+		toolResults []anthropic.ContentBlockParamUnion
+		err         error
+	)
+	out := captureStdout(t, func() {
+		msg, toolResults, err = r.RunOneStep(context.Background(), provider.DefaultModel, conv)
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// Request must ask for a stream.
+	var req struct {
+		Stream bool `json:"stream"`
+	}
+	if err := json.Unmarshal(capReq.body, &req); err != nil || !req.Stream {
+		t.Fatalf("expected stream=true in request; err=%v body=%s", err, string(capReq.body))
+	}
+
+	// Text printed once, with the usual prefix.
+	if strings.Count(out, "Claude") != 1 || !strings.Contains(out, "Let me look.\n") {
+		t.Fatalf("unexpected streamed output: %q", out)
+	}
+
+	// Returned message matches the non-streaming contract.
+	if msg.ID != "msg_s1" || msg.StopReason != anthropic.StopReasonToolUse {
+		t.Fatalf("unexpected message: id=%q stop=%q", msg.ID, msg.StopReason)
+	}
+	if len(msg.Content) != 2 {
+		t.Fatalf("want 2 content blocks, got %d", len(msg.Content))
+	}
+	tu, ok := msg.Content[1].AsAny().(anthropic.ToolUseBlock)
+	if !ok {
+		t.Fatalf("second block is %T, want ToolUseBlock", msg.Content[1].AsAny())
+	}
+	var in struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(tu.Input, &in); err != nil || in.Path != "." {
+		t.Fatalf("tool_use input not reassembled: %s (err=%v)", string(tu.Input), err)
+	}
+
+	// The reassembled tool_use was executed.
+	if len(toolResults) != 1 || toolResults[0].OfToolResult == nil || toolResults[0].OfToolResult.ToolUseID != "t1" {
+		t.Fatalf("unexpected tool results: %+v", toolResults)
+	}
+	if toolResults[0].OfToolResult.IsError.Value {
+		t.Fatalf("tool execution failed: %+v", toolResults[0].OfToolResult.Content)
+	}
+}
+
+func TestRunner_Stream_ApiUsage_FromStreamEvents(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_STREAM", "1")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	fake := &fakeTransport{respStatus: 200, respBody: streamedTextAndToolUse, captured: &capture{}}
+	r := runner.New(newClientWithTransport(fake), tools.Registry())
+	ctx := telemetry.WithTurnID(context.Background(), "turn-stream-usage")
+	conv := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("hi"))}
+
+	_ = captureStdout(t, func() {
+		if _, _, err := r.RunOneStep(ctx, provider.DefaultModel, conv); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+
+	usage := filterEventsByName(readEventLines(t), "api_usage")
+	if len(usage) != 1 {
+		t.Fatalf("want 1 api_usage event, got %d", len(usage))
+	}
+	var m map[string]any
+	if err := json.Unmarshal(usage[0], &m); err != nil {
+		t.Fatalf("invalid api_usage json: %v", err)
+	}
+	if m["message_id"] != "msg_s1" || m["stop_reason"] != "tool_use" || m["streaming"] != true {
+		t.Errorf("unexpected api_usage fields: %v", m)
+	}
+	if m["input_tokens"] != float64(11) || m["output_tokens"] != float64(23) {
+		t.Errorf("usage mismatch: input=%v output=%v", m["input_tokens"], m["output_tokens"])
+	}
+}
+
+func TestRunner_Stream_Payloads_PersistSSEAndMessage(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_STREAM", "1")
+	t.Setenv("AGT_PERSIST_API_PAYLOADS", "1")
+	base := chdirTemp(t)
+	t.Setenv("AGT_ARTIFACTS_DIR", base)
+
+	fake := &fakeTransport{respStatus: 200, respBody: streamedTextAndToolUse, captured: &capture{}}
+	r := runner.New(newClientWithTransport(fake), tools.Registry())
+	ctx := telemetry.WithTurnID(context.Background(), "turn-sse")
+	conv := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("hi"))}
+
+	_ = captureStdout(t, func() {
+		if _, _, err := r.RunOneStep(ctx, provider.DefaultModel, conv); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+
+	dir := filepath.Join(base, "payloads", "turn-sse")
+	if _, err := os.Stat(filepath.Join(dir, "request.json")); err != nil {
+		t.Fatalf("missing request.json: %v", err)
+	}
+	sse, err := os.ReadFile(filepath.Join(dir, "response.sse"))
+	if err != nil {
+		t.Fatalf("missing response.sse: %v", err)
+	}
+	if string(sse) != string(streamedTextAndToolUse) {
+		t.Fatalf("response.sse does not match the wire stream:\n%s", string(sse))
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "response.json"))
+	if err != nil {
+		t.Fatalf("missing response.json: %v", err)
+	}
+	var final struct {
+		ID      string `json:"id"`
+		Content []struct {
+			Type string `json:"type"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(b, &final); err != nil {
+		t.Fatalf("invalid response.json: %v", err)
+	}
+	if final.ID != "msg_s1" || len(final.Content) != 2 || final.Content[1].Type != "tool_use" {
+		t.Fatalf("unexpected final message: %+v", final)
+	}
+}
+
+func TestRunner_Stream_HTTPError_ReturnsError(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_STREAM", "1")
+	_ = chdirTemp(t)
+
+	fake := &fakeTransport{respStatus: 400, respBody: []byte(`{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`), captured: &capture{}}
+	r := runner.New(newClientWithTransport(fake), tools.Registry())
+	conv := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock("hi"))}
+
+	if _, _, err := r.RunOneStep(context.Background(), provider.DefaultModel, conv); err == nil {
+		t.Fatal("expected error from streaming 400")
+	}
+}
@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/fsops"
+)
+
+// DefaultSystemPromptFile is read from the read root when AGT_SYSTEM_PROMPT is unset.
+const DefaultSystemPromptFile = "AGENT.md"
+
+// SystemPromptFromEnv loads the system prompt from the file named by AGT_SYSTEM_PROMPT,
+// or from AGENT.md in the read root when that variable is unset. A missing AGENT.md
+// means no system prompt; AGT_SYSTEM_PROMPT set to "" disables it.
+func SystemPromptFromEnv() (string, error) {
+	path, ok := os.LookupEnv("AGT_SYSTEM_PROMPT")
+	if !ok {
+		s, err := fsops.ReadFile(DefaultSystemPromptFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("system prompt %s: %w", DefaultSystemPromptFile, err)
+		}
+		return strings.TrimSpace(s), nil
+	}
+	if path = strings.TrimSpace(path); path == "" {
+		return "", nil
+	}
+	s, err := SystemPromptFromFile(path)
+	if err != nil {
+		return "", fmt.Errorf("AGT_SYSTEM_PROMPT: %w", err)
+	}
+	return s, nil
+}
+
+// SystemPromptFromFile reads the system prompt from path, which is not confined to
+// the read root, trimming surrounding whitespace.
+func SystemPromptFromFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// systemMessage stands in for the system prompt when sizing it with a TokenCounter.
+func systemMessage(system string) anthropic.MessageParam {
+	return anthropic.NewUserMessage(anthropic.NewTextBlock(system))
+}
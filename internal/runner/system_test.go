@@ -0,0 +1,103 @@
+package runner_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/provider/providertest"
+	"github.com/petasbytes/go-agent/internal/runner"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+func TestRunner_SystemPromptFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompt.md")
+	if err := os.WriteFile(path, []byte("\nYou are terse.\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AGT_SYSTEM_PROMPT", path)
+	if s, err := runner.SystemPromptFromEnv(); err != nil || s != "You are terse." {
+		t.Fatalf("got %q, %v", s, err)
+	}
+	t.Setenv("AGT_SYSTEM_PROMPT", "")
+	if s, err := runner.SystemPromptFromEnv(); err != nil || s != "" {
+		t.Fatalf("empty AGT_SYSTEM_PROMPT should disable the prompt: %q, %v", s, err)
+	}
+	t.Setenv("AGT_SYSTEM_PROMPT", filepath.Join(t.TempDir(), "missing.md"))
+	if _, err := runner.SystemPromptFromEnv(); err == nil {
+		t.Fatal("expected error for a missing prompt file")
+	}
+}
+
+func TestRunner_SystemPromptFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "review.md")
+	if err := os.WriteFile(path, []byte("  Review only.\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := runner.SystemPromptFromFile(path); err != nil || s != "Review only." {
+		t.Fatalf("got %q, %v", s, err)
+	}
+	if _, err := runner.SystemPromptFromFile(filepath.Join(t.TempDir(), "missing.md")); err == nil {
+		t.Fatal("expected error for a missing prompt file")
+	}
+}
+
+// The system prompt and pinned messages are sent every step and charged before history.
+func TestRunner_SystemPromptAndPinnedSurviveWindowing(t *testing.T) {
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+	system := "Always answer in French."
+	conv := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("The task: port the parser.")),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("Understood, starting with the lexer.")),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("Now the grammar.")),
+	}
+	h := windowing.HeuristicCounter{}
+	systemCost := h.CountMessage(context.Background(), anthropic.NewUserMessage(anthropic.NewTextBlock(system)))
+	budget := systemCost + h.CountMessage(context.Background(), conv[0]) + h.CountMessage(context.Background(), conv[2])
+	t.Setenv("AGT_TOKEN_BUDGET", strconv.Itoa(budget))
+
+	fake := providertest.New(t, providertest.Turn{
+		Expect: func(t testing.TB, p anthropic.MessageNewParams) {
+			if len(p.System) != 1 || p.System[0].Text != system {
+				t.Errorf("system prompt not sent: %+v", p.System)
+			}
+			if len(p.Messages) != 2 || providertest.Text(p.Messages[0]) != "The task: port the parser." {
+				t.Errorf("pinned task not kept: %+v", p.Messages)
+			}
+		},
+		Text: "D'accord.",
+	})
+	r := runner.New(fake, nil)
+	r.System, r.Pinned = system, []int{0}
+	if _, _, err := r.RunOneStep(context.Background(), "claude-test", conv); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	evs := filterEventsByName(readEventLines(t), "window_prepared")
+	var m map[string]any
+	if len(evs) != 1 || json.Unmarshal(evs[0], &m) != nil {
+		t.Fatalf("want one window_prepared event, got %d", len(evs))
+	}
+	if m["system_tokens"] != float64(systemCost) || m["pinned_tokens"] != float64(h.CountMessage(context.Background(), conv[0])) || m["total_estimated"] != float64(budget) {
+		t.Fatalf("unexpected accounting: %v", m)
+	}
+}
+
+func TestRunner_PinnedOverBudget_ReturnsError(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "20")
+	fake := providertest.New(t)
+	r := runner.New(fake, nil)
+	r.Pinned = []int{0}
+	conv := []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("a pinned instruction that is far too long")),
+		anthropic.NewUserMessage(anthropic.NewTextBlock("hi")),
+	}
+	if _, _, err := r.RunOneStep(context.Background(), "claude-test", conv); err == nil {
+		t.Fatal("expected error when pinned messages exceed the budget")
+	}
+}
@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/safety"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+// DefaultToolWorkers is how many parallel-safe tool calls run at once when
+// AGT_TOOL_WORKERS is unset.
+const DefaultToolWorkers = 4
+
+// toolWorkersFromEnv reads AGT_TOOL_WORKERS (1 runs every call sequentially).
+func toolWorkersFromEnv() (int, error) {
+	v := strings.TrimSpace(os.Getenv("AGT_TOOL_WORKERS"))
+	if v == "" {
+		return DefaultToolWorkers, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid AGT_TOOL_WORKERS %q: want a number ≥ 1", v)
+	}
+	return n, nil
+}
+
+// toolCall is one tool_use block of an assistant message.
+type toolCall struct {
+	id, name  string
+	input     json.RawMessage
+	truncated bool // cut off at max_tokens; reported, never run
+	refused   bool // tools are disabled for the rest of the turn (see loopGuard)
+}
+
+// execTools runs calls and returns their results in call order, so each tool_result
+// lines up with its tool_use. Consecutive parallel-safe calls run concurrently on up
+// to workers goroutines; any other call waits for the calls before it and runs alone,
+// so writes stay serialized and ordered relative to the reads around them.
+func (r *Runner) execTools(ctx context.Context, calls []toolCall, workers int) []anthropic.ContentBlockParamUnion {
+	results := make([]anthropic.ContentBlockParamUnion, len(calls))
+	queued := time.Now()
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, c := range calls {
+		switch {
+		case c.truncated:
+			results[i] = r.truncatedToolResult(ctx, c.id, c.name)
+		case c.refused:
+			results[i] = anthropic.NewToolResultBlock(c.id, errToolsDisabled.Error(), true)
+		case workers > 1 && r.parallelSafe(c.name):
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				results[i] = r.execTool(ctx, c.id, c.name, c.input, queued)
+			}()
+		default:
+			wg.Wait()
+			results[i] = r.execTool(ctx, c.id, c.name, c.input, queued)
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// parallelSafe reports whether the named tool is registered as ParallelSafe.
+func (r *Runner) parallelSafe(name string) bool {
+	for _, t := range r.Tools {
+		if t.Name == name {
+			return t.ParallelSafe
+		}
+	}
+	return false
+}
+
+const (
+	errToolTimeout  = "ERR_TOOL_TIMEOUT"
+	errToolCanceled = "ERR_TOOL_CANCELED"
+)
+
+// callTool runs def's handler under its timeout and waits for it to return, so a
+// write never lands after the model was told the call failed, and never races the
+// next serialized call. Handlers return promptly once ctx is done; when a handler
+// returns this call's context error, it is reported as ERR_TOOL_TIMEOUT or
+// ERR_TOOL_CANCELED. Context-free Functions cannot be interrupted, so they have no
+// timeout and always run to completion.
+func callTool(ctx context.Context, def tools.ToolDefinition, input json.RawMessage) (string, error) {
+	callCtx, cancel := ctx, context.CancelFunc(func() {})
+	timeout := def.CallTimeout()
+	if timeout > 0 {
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	out, err := def.Handle()(callCtx, input)
+	// Only errors caused by this call's context are reclassified; a tool's own errors pass through.
+	switch {
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		return "", safety.ToolError{Code: errToolCanceled, Message: "tool call cancelled before it finished"}
+	case callCtx.Err() == context.DeadlineExceeded && errors.Is(err, context.DeadlineExceeded):
+		return "", safety.ToolError{Code: errToolTimeout, Message: fmt.Sprintf("%s did not finish within %s; narrow the request or try again", def.Name, timeout)}
+	}
+	return out, err
+}
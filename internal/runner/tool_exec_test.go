@@ -5,11 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/provider/providertest"
 	"github.com/petasbytes/go-agent/internal/runner"
 	"github.com/petasbytes/go-agent/internal/telemetry"
 	"github.com/petasbytes/go-agent/tools"
@@ -312,3 +317,215 @@ func TestRunner_ToolExec_Privacy_NoRawPayloadLeak(t *testing.T) {
 		}
 	}
 }
+
+// probeTool records how many calls run at once. Parallel-safe calls wait briefly for
+// each other so overlapping runs are observable.
+type probeTool struct {
+	mu            sync.Mutex
+	running, peak int
+	overlapWrite  bool
+	order         []string
+}
+
+func (p *probeTool) def(name string, parallel bool) tools.ToolDefinition {
+	return tools.ToolDefinition{Name: name, ParallelSafe: parallel, Function: func(input json.RawMessage) (string, error) {
+		p.mu.Lock()
+		p.running++
+		p.peak = max(p.peak, p.running)
+		if !parallel && p.running > 1 {
+			p.overlapWrite = true
+		}
+		p.mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		p.mu.Lock()
+		p.running--
+		p.order = append(p.order, name+string(input))
+		p.mu.Unlock()
+		return name + string(input), nil
+	}}
+}
+
+func TestRunner_ToolExec_ParallelSafeRunConcurrently_WritesSerialized(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	read := func(n int) providertest.ToolUse { return providertest.ToolUse{Name: "read", Input: []int{n}} }
+	fake := providertest.New(t, providertest.Turn{ToolUses: []providertest.ToolUse{
+		read(1), read(2), read(3), {Name: "write", Input: []int{4}}, read(5),
+	}})
+	p := &probeTool{}
+	r := runner.New(fake, []tools.ToolDefinition{p.def("read", true), p.def("write", false)})
+
+	_, results, err := r.RunOneStep(context.Background(), "claude-test", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := []string{"read[1]", "read[2]", "read[3]", "write[4]", "read[5]"}
+	for i, res := range results {
+		if tr := res.OfToolResult; tr == nil || tr.Content[0].OfText.Text != want[i] || tr.ToolUseID != fmt.Sprintf("toolu_1_%d", i+1) {
+			t.Fatalf("result %d out of order: %+v", i, res.OfToolResult)
+		}
+	}
+	if p.peak < 2 || p.overlapWrite {
+		t.Fatalf("want concurrent reads and a serialized write: peak=%d overlapWrite=%v", p.peak, p.overlapWrite)
+	}
+	if p.order[3] != "write[4]" {
+		t.Fatalf("write should run after the reads before it and before those after: %v", p.order)
+	}
+
+	evs := filterEventsByName(readEventLines(t), "tool_exec")
+	if len(evs) != 5 {
+		t.Fatalf("want 5 tool_exec events, got %d", len(evs))
+	}
+	for _, ev := range evs {
+		var m map[string]any
+		if err := json.Unmarshal(ev, &m); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if _, ok := m["queue_ms"].(float64); !ok {
+			t.Fatalf("tool_exec missing queue_ms: %v", m)
+		}
+	}
+}
+
+func TestRunner_ToolExec_WorkerLimit(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_TOOL_WORKERS", "1")
+	_ = chdirTemp(t)
+
+	fake := providertest.New(t, providertest.Turn{ToolUses: []providertest.ToolUse{
+		{Name: "read", Input: []int{1}}, {Name: "read", Input: []int{2}},
+	}})
+	p := &probeTool{}
+	r := runner.New(fake, []tools.ToolDefinition{p.def("read", true)})
+	if _, _, err := r.RunOneStep(context.Background(), "claude-test", nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if p.peak != 1 {
+		t.Fatalf("AGT_TOOL_WORKERS=1 should run calls one at a time, peak=%d", p.peak)
+	}
+
+	t.Setenv("AGT_TOOL_WORKERS", "0")
+	if _, _, err := r.RunOneStep(context.Background(), "claude-test", nil); err == nil || !strings.Contains(err.Error(), "AGT_TOOL_WORKERS") {
+		t.Fatalf("want invalid AGT_TOOL_WORKERS error, got %v", err)
+	}
+}
+
+func TestRunner_ToolExec_HandlerSeesTurnAndTimesOut(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	seenTurn := make(chan string, 1)
+	var returned atomic.Bool
+	slow := tools.ToolDefinition{Name: "slow", Timeout: 20 * time.Millisecond, Handler: func(ctx context.Context, _ json.RawMessage) (string, error) {
+		id, _ := telemetry.TurnIDFromContext(ctx)
+		seenTurn <- id
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond) // e.g. a write finishing up
+		returned.Store(true)
+		return "", ctx.Err()
+	}}
+	fake := providertest.New(t, providertest.Turn{ToolUses: []providertest.ToolUse{{Name: "slow"}}})
+	r := runner.New(fake, []tools.ToolDefinition{slow})
+
+	ctx := telemetry.WithTurnID(context.Background(), "turn-tools")
+	start := time.Now()
+	_, results, err := r.RunOneStep(ctx, "claude-test", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("runner waited too long for a timed-out tool: %v", time.Since(start))
+	}
+	if !returned.Load() {
+		t.Fatal("ERR_TOOL_TIMEOUT was reported before the handler returned")
+	}
+	if id := <-seenTurn; id != "turn-tools" {
+		t.Fatalf("handler should see the turn id, got %q", id)
+	}
+	for i, res := range results {
+		tr := res.OfToolResult
+		if tr == nil || !tr.IsError.Value || !strings.Contains(tr.Content[0].OfText.Text, `"code":"ERR_TOOL_TIMEOUT"`) {
+			t.Fatalf("result %d: want ERR_TOOL_TIMEOUT, got %+v", i, tr)
+		}
+	}
+	for _, ev := range filterEventsByName(readEventLines(t), "tool_exec") {
+		var m map[string]any
+		if err := json.Unmarshal(ev, &m); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if m["error"] != "tool timeout" {
+			t.Fatalf("want error class tool timeout, got %v", m["error"])
+		}
+	}
+}
+
+func TestRunner_ToolExec_InvalidInputRejectedBeforeDispatch(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	t.Setenv("AGT_OBSERVE_JSON", "1")
+	_ = chdirTemp(t)
+
+	ran := false
+	def := tools.ReadFileDefinition
+	def.Handler = func(context.Context, json.RawMessage) (string, error) { ran = true; return "", nil }
+	fake := providertest.New(t, providertest.Turn{ToolUses: []providertest.ToolUse{{Name: "read_file", Input: map[string]any{"offset": -2}}}})
+	r := runner.New(fake, []tools.ToolDefinition{def})
+
+	_, results, err := r.RunOneStep(context.Background(), "claude-test", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if ran {
+		t.Fatal("tool ran despite invalid input")
+	}
+	tr := results[0].OfToolResult
+	if tr == nil || !tr.IsError.Value || !strings.Contains(tr.Content[0].OfText.Text, `"code":"ERR_INVALID_INPUT"`) || !strings.Contains(tr.Content[0].OfText.Text, `"fields":["path","offset"]`) {
+		t.Fatalf("want ERR_INVALID_INPUT listing path and offset, got %+v", tr)
+	}
+	evs := filterEventsByName(readEventLines(t), "tool_exec")
+	var m map[string]any
+	if len(evs) != 1 || json.Unmarshal(evs[0], &m) != nil || m["error"] != "invalid input" {
+		t.Fatalf("want one tool_exec with error class invalid input, got %d events %v", len(evs), m)
+	}
+}
+
+func TestRunner_ToolExec_ContextFreeToolFinishesBeforeResult(t *testing.T) {
+	t.Setenv("AGT_TOKEN_BUDGET", "1000")
+	dir := chdirTemp(t)
+
+	// A slow context-free write past its Timeout must land before its result is
+	// reported, and before the next serialized call starts.
+	target := filepath.Join(dir, "late.txt")
+	var order []string
+	slowWrite := tools.ToolDefinition{Name: "slow_write", Timeout: 20 * time.Millisecond, Function: func(json.RawMessage) (string, error) {
+		time.Sleep(200 * time.Millisecond)
+		if err := os.WriteFile(target, []byte("written"), 0o644); err != nil {
+			return "", err
+		}
+		order = append(order, "slow_write")
+		return "OK", nil
+	}}
+	next := tools.ToolDefinition{Name: "next", Function: func(json.RawMessage) (string, error) {
+		order = append(order, "next")
+		return "OK", nil
+	}}
+	fake := providertest.New(t, providertest.Turn{ToolUses: []providertest.ToolUse{{Name: "slow_write"}, {Name: "next"}}})
+	r := runner.New(fake, []tools.ToolDefinition{slowWrite, next})
+
+	_, results, err := r.RunOneStep(context.Background(), "claude-test", nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	tr := results[0].OfToolResult
+	if tr == nil || tr.IsError.Value || tr.Content[0].OfText.Text != "OK" {
+		t.Fatalf("the completed write should be reported as done, got %+v", tr)
+	}
+	if b, err := os.ReadFile(target); err != nil || string(b) != "written" {
+		t.Fatalf("write should have landed before the result: %q, %v", b, err)
+	}
+	if strings.Join(order, ",") != "slow_write,next" {
+		t.Fatalf("calls overlapped or ran out of order: %v", order)
+	}
+}
@@ -11,8 +11,9 @@ import (
 
 // ToolError is a machine-readable error body for surfacing back to the agent as JSON.
 type ToolError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Fields  []string `json:"fields,omitempty"` // offending input fields, for ERR_INVALID_INPUT
 }
 
 // Error returns a compact, single-line JSON string to keep tool_result payloads small.
@@ -9,9 +9,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
+// emitMu serialises appends so events from concurrent tool calls stay whole lines.
+var emitMu sync.Mutex
+
 // Emit writes a single JSON line to .agent/events.jsonl when observation is enabled.
 // It augments fields with RFC3339Nano time and the event name.
 func Emit(name string, fields map[string]any) {
@@ -40,6 +44,8 @@ func Emit(name string, fields map[string]any) {
 		return
 	}
 
+	emitMu.Lock()
+	defer emitMu.Unlock()
 	path := filepath.Join(base, "events.jsonl")
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 	if err != nil {
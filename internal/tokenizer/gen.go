@@ -0,0 +1,198 @@
+//go:build ignore
+
+// gen trains the embedded BPE merges on the Go distribution's source and docs.
+//
+//	go run gen.go -out merges.txt [-corpus dir] [-merges n]
+//
+// Chunks come from tokenizer.Split so training and encoding agree. Chunks seen
+// once are ignored; ties are broken by the lower pair of ids, so the output is
+// deterministic for a given corpus.
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/petasbytes/go-agent/internal/tokenizer"
+)
+
+type pair struct{ a, b int }
+
+type word struct {
+	ids   []int
+	count int
+}
+
+// pairHeap is a max-heap of candidate merges; stale entries are skipped on pop.
+type pairHeap []heapItem
+
+type heapItem struct {
+	p     pair
+	count int
+}
+
+func (h pairHeap) Len() int { return len(h) }
+func (h pairHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count > h[j].count
+	}
+	if h[i].p.a != h[j].p.a {
+		return h[i].p.a < h[j].p.a
+	}
+	return h[i].p.b < h[j].p.b
+}
+func (h pairHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *pairHeap) Push(x any)   { *h = append(*h, x.(heapItem)) }
+func (h *pairHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func main() {
+	corpus := flag.String("corpus", filepath.Join(runtime.GOROOT(), "src"), "directory of training text")
+	out := flag.String("out", "merges.txt", "output file")
+	merges := flag.Int("merges", 16000, "number of merges to learn")
+	flag.Parse()
+
+	chunks := map[string]int{}
+	var files, bytes int
+	err := filepath.WalkDir(*corpus, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); name == "testdata" || name == "vendor" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch filepath.Ext(path) {
+		case ".go", ".md", ".txt", ".json", ".html":
+		default:
+			return nil
+		}
+		if strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, c := range tokenizer.Split(string(b)) {
+			chunks[c]++
+		}
+		files++
+		bytes += len(b)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("corpus: %d files, %d bytes, %d distinct chunks", files, bytes, len(chunks))
+
+	// Distinct chunks in a stable order.
+	keys := make([]string, 0, len(chunks))
+	for c, n := range chunks {
+		if n > 1 && len(c) > 1 {
+			keys = append(keys, c)
+		}
+	}
+	sort.Strings(keys)
+	words := make([]word, len(keys))
+	counts := map[pair]int{}
+	where := map[pair]map[int]struct{}{}
+	add := func(p pair, w, n int) {
+		counts[p] += n
+		if where[p] == nil {
+			where[p] = map[int]struct{}{}
+		}
+		where[p][w] = struct{}{}
+	}
+	for w, c := range keys {
+		ids := make([]int, len(c))
+		for i := 0; i < len(c); i++ {
+			ids[i] = int(c[i])
+		}
+		words[w] = word{ids: ids, count: chunks[c]}
+		for i := 0; i+1 < len(ids); i++ {
+			add(pair{ids[i], ids[i+1]}, w, chunks[c])
+		}
+	}
+	h := &pairHeap{}
+	for p, n := range counts {
+		*h = append(*h, heapItem{p, n})
+	}
+	heap.Init(h)
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "# BPE merges generated by gen.go; do not edit.\n# corpus: Go %s source and docs (%d files, %d bytes)\n", runtime.Version(), files, bytes)
+
+	next := 256
+	for learned := 0; learned < *merges && h.Len() > 0; {
+		it := heap.Pop(h).(heapItem)
+		if counts[it.p] != it.count || it.count < 2 {
+			continue // stale
+		}
+		p, id := it.p, next
+		next++
+		learned++
+		fmt.Fprintf(bw, "%d %d\n", p.a, p.b)
+
+		// Re-tokenise the words that contain p and update pair counts.
+		touched := map[pair]bool{}
+		for w := range where[p] {
+			wd := &words[w]
+			for i := 0; i+1 < len(wd.ids); i++ {
+				q := pair{wd.ids[i], wd.ids[i+1]}
+				counts[q] -= wd.count
+				touched[q] = true
+			}
+			merged := wd.ids[:0:0]
+			for i := 0; i < len(wd.ids); i++ {
+				if i+1 < len(wd.ids) && wd.ids[i] == p.a && wd.ids[i+1] == p.b {
+					merged = append(merged, id)
+					i++
+					continue
+				}
+				merged = append(merged, wd.ids[i])
+			}
+			wd.ids = merged
+			for i := 0; i+1 < len(wd.ids); i++ {
+				q := pair{wd.ids[i], wd.ids[i+1]}
+				add(q, w, wd.count)
+				touched[q] = true
+			}
+		}
+		delete(counts, p)
+		delete(where, p)
+		for q := range touched {
+			if n := counts[q]; n > 0 {
+				heap.Push(h, heapItem{q, n})
+			} else {
+				delete(counts, q)
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d merges to %s", next-256, *out)
+}
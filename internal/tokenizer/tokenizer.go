@@ -0,0 +1,258 @@
+// Package tokenizer implements a byte-level BPE tokenizer with an embedded
+// vocabulary, used to estimate model token counts offline.
+//
+// The vocabulary (merges.txt) is trained by gen.go on the Go distribution's source
+// and documentation, so it covers English prose, code and JSON well. It is not any
+// model's actual vocabulary: counts are estimates, typically much closer to real
+// token counts than rune counts. Text unlike the training corpus (e.g. CJK) falls
+// back to byte tokens and is overestimated, which keeps budgets conservative.
+//
+// Regenerate the vocabulary with:
+//
+//	go generate ./internal/tokenizer
+package tokenizer
+
+//go:generate go run gen.go -out merges.txt
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed merges.txt
+var embeddedMerges string
+
+// MaxChunk is the longest pre-tokenized chunk, in bytes; longer runs are split.
+const MaxChunk = 64
+
+// maxCacheEntries bounds the per-tokenizer chunk cache.
+const maxCacheEntries = 1 << 16
+
+type pair struct{ a, b int }
+
+// Tokenizer encodes text with a list of BPE merges over bytes. Token ids 0-255
+// are single bytes; merge i produces id 256+i. A Tokenizer is safe for concurrent use.
+type Tokenizer struct {
+	ranks  map[pair]int // merge -> rank (lower merges first)
+	tokens [][]byte     // id -> bytes
+
+	mu    sync.Mutex
+	cache map[string]int // chunk -> token count
+}
+
+var (
+	defaultOnce sync.Once
+	defaultTok  *Tokenizer
+)
+
+// Default returns the shared tokenizer for the embedded vocabulary.
+func Default() *Tokenizer {
+	defaultOnce.Do(func() { defaultTok = New() })
+	return defaultTok
+}
+
+// New returns a tokenizer for the embedded vocabulary with its own chunk cache.
+func New() *Tokenizer {
+	t, err := Parse(strings.NewReader(embeddedMerges))
+	if err != nil {
+		panic("tokenizer: embedded merges: " + err.Error())
+	}
+	return t
+}
+
+// Parse reads merges, one per line as two space-separated token ids; "#" starts a comment.
+func Parse(r io.Reader) (*Tokenizer, error) {
+	t := &Tokenizer{ranks: make(map[pair]int), cache: make(map[string]int)}
+	for i := range 256 {
+		t.tokens = append(t.tokens, []byte{byte(i)})
+	}
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		s := strings.TrimSpace(sc.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		f := strings.Fields(s)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("line %d: want 2 ids, got %q", line, s)
+		}
+		a, errA := strconv.Atoi(f[0])
+		b, errB := strconv.Atoi(f[1])
+		if errA != nil || errB != nil || a < 0 || b < 0 || a >= len(t.tokens) || b >= len(t.tokens) {
+			return nil, fmt.Errorf("line %d: invalid merge %q", line, s)
+		}
+		t.ranks[pair{a, b}] = len(t.tokens) - 256
+		t.tokens = append(t.tokens, append(append([]byte(nil), t.tokens[a]...), t.tokens[b]...))
+	}
+	return t, sc.Err()
+}
+
+// VocabSize returns the number of token ids (256 bytes plus merges).
+func (t *Tokenizer) VocabSize() int { return len(t.tokens) }
+
+// Count returns the number of tokens in s.
+func (t *Tokenizer) Count(s string) int {
+	n := 0
+	for _, chunk := range Split(s) {
+		t.mu.Lock()
+		c, ok := t.cache[chunk]
+		t.mu.Unlock()
+		if !ok {
+			c = len(t.encodeChunk(chunk))
+			t.mu.Lock()
+			if len(t.cache) >= maxCacheEntries {
+				clear(t.cache)
+			}
+			t.cache[chunk] = c
+			t.mu.Unlock()
+		}
+		n += c
+	}
+	return n
+}
+
+// Encode returns the token ids of s.
+func (t *Tokenizer) Encode(s string) []int {
+	var ids []int
+	for _, chunk := range Split(s) {
+		ids = append(ids, t.encodeChunk(chunk)...)
+	}
+	return ids
+}
+
+// Decode returns the text of ids; unknown ids are skipped.
+func (t *Tokenizer) Decode(ids []int) string {
+	var b strings.Builder
+	for _, id := range ids {
+		if id >= 0 && id < len(t.tokens) {
+			b.Write(t.tokens[id])
+		}
+	}
+	return b.String()
+}
+
+// encodeChunk applies merges in rank order until none applies.
+func (t *Tokenizer) encodeChunk(chunk string) []int {
+	ids := make([]int, len(chunk))
+	for i := 0; i < len(chunk); i++ {
+		ids[i] = int(chunk[i])
+	}
+	for len(ids) > 1 {
+		best, bestRank := -1, len(t.ranks)
+		for i := 0; i+1 < len(ids); i++ {
+			if r, ok := t.ranks[pair{ids[i], ids[i+1]}]; ok && r < bestRank {
+				best, bestRank = i, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		p, merged := pair{ids[best], ids[best+1]}, 256+bestRank
+		out := ids[:best]
+		for i := best; i < len(ids); i++ {
+			if i+1 < len(ids) && ids[i] == p.a && ids[i+1] == p.b {
+				out = append(out, merged)
+				i++
+				continue
+			}
+			out = append(out, ids[i])
+		}
+		ids = out
+	}
+	return ids
+}
+
+// Split pre-tokenizes s into chunks that BPE merges never cross: words with an
+// optional leading space, digit runs of up to three, punctuation runs with an
+// optional leading space, and whitespace. Chunks are at most MaxChunk bytes.
+func Split(s string) []string {
+	var out []string
+	emit := func(chunk string) {
+		for len(chunk) > MaxChunk {
+			cut := MaxChunk
+			for cut > 0 && !utf8.RuneStart(chunk[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = MaxChunk
+			}
+			out = append(out, chunk[:cut])
+			chunk = chunk[cut:]
+		}
+		if chunk != "" {
+			out = append(out, chunk)
+		}
+	}
+	for i := 0; i < len(s); {
+		start := i
+		r, size := utf8.DecodeRuneInString(s[i:])
+		// A single space joins the following word or punctuation run.
+		if r == ' ' && i+1 < len(s) {
+			if next, _ := utf8.DecodeRuneInString(s[i+1:]); class(next) == classLetter || class(next) == classOther {
+				i += size
+				r, size = next, utf8.RuneLen(next)
+			}
+		}
+		switch c := class(r); c {
+		case classDigit:
+			for n := 0; i < len(s) && n < 3; n++ {
+				r, size = utf8.DecodeRuneInString(s[i:])
+				if class(r) != classDigit {
+					break
+				}
+				i += size
+			}
+		case classSpace:
+			for i < len(s) {
+				r, size = utf8.DecodeRuneInString(s[i:])
+				if class(r) != classSpace {
+					break
+				}
+				i += size
+			}
+			// Leave a trailing single space to join the next word.
+			if i < len(s) && i-start > 1 && s[i-1] == ' ' {
+				if next, _ := utf8.DecodeRuneInString(s[i:]); class(next) == classLetter || class(next) == classOther {
+					i--
+				}
+			}
+		default:
+			for i < len(s) {
+				r, size = utf8.DecodeRuneInString(s[i:])
+				if class(r) != c {
+					break
+				}
+				i += size
+			}
+		}
+		emit(s[start:i])
+	}
+	return out
+}
+
+const (
+	classLetter = iota
+	classDigit
+	classSpace
+	classOther
+)
+
+func class(r rune) int {
+	switch {
+	case unicode.IsLetter(r) || unicode.IsMark(r):
+		return classLetter
+	case unicode.IsDigit(r):
+		return classDigit
+	case unicode.IsSpace(r):
+		return classSpace
+	default:
+		return classOther
+	}
+}
@@ -0,0 +1,79 @@
+package tokenizer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/petasbytes/go-agent/internal/tokenizer"
+)
+
+var samples = []string{
+	"",
+	"hello world",
+	"The quick brown fox jumps over the lazy dog.\n\n  Indented  text\twith tabs.",
+	"func (r *Runner) RunTurn(ctx context.Context) error {\n\treturn nil\n}\n",
+	`{"path":"internal/runner/runner.go","offset":10,"limit":200}`,
+	"こんにちは世界 — naïve café 12345678",
+	strings.Repeat("=", 200),
+	"invalid \xff\xfe utf-8",
+}
+
+func TestTokenizer_RoundTrips(t *testing.T) {
+	tok := tokenizer.Default()
+	for _, s := range samples {
+		ids := tok.Encode(s)
+		if got := tok.Decode(ids); got != s {
+			t.Errorf("round trip of %q = %q", s, got)
+		}
+		if n := tok.Count(s); n != len(ids) {
+			t.Errorf("Count(%q) = %d, Encode gave %d ids", s, n, len(ids))
+		}
+	}
+}
+
+func TestTokenizer_EmbeddedVocabularyMergesCommonText(t *testing.T) {
+	tok := tokenizer.Default()
+	if tok.VocabSize() <= 256 {
+		t.Fatalf("embedded vocabulary not loaded: %d ids", tok.VocabSize())
+	}
+	for _, s := range []string{" return", " the", "func", " context"} {
+		if n := tok.Count(s); n != 1 {
+			t.Errorf("Count(%q) = %d, want a single token", s, n)
+		}
+	}
+	// English, code and JSON should average well over two bytes per token.
+	text := samples[2] + samples[3] + samples[4]
+	if n := tok.Count(text); n*5 > len(text)*2 {
+		t.Errorf("%d tokens for %d bytes; vocabulary barely merges", n, len(text))
+	}
+}
+
+func TestSplit_ChunksCoverInputAndRespectMaxChunk(t *testing.T) {
+	for _, s := range samples {
+		chunks := tokenizer.Split(s)
+		if got := strings.Join(chunks, ""); got != s {
+			t.Errorf("chunks of %q rejoin to %q", s, got)
+		}
+		for _, c := range chunks {
+			if len(c) > tokenizer.MaxChunk {
+				t.Errorf("chunk of %d bytes exceeds MaxChunk", len(c))
+			}
+		}
+	}
+	got := tokenizer.Split("say  hello, 2025 world")
+	want := []string{"say", " ", " hello", ",", " ", "202", "5", " world"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Split = %q, want %q", got, want)
+	}
+}
+
+func TestParse_RejectsInvalidMerges(t *testing.T) {
+	if _, err := tokenizer.Parse(strings.NewReader("# comment\n104 105\n256 33\n")); err != nil {
+		t.Fatalf("valid merges: %v", err)
+	}
+	for _, bad := range []string{"1\n", "a b\n", "300 1\n"} {
+		if _, err := tokenizer.Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
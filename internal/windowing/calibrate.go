@@ -0,0 +1,155 @@
+package windowing
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// MinCalibrationSamples is the fewest api_usage samples FitCalibration accepts.
+const MinCalibrationSamples = 5
+
+// DefaultCalibration holds the prior rates a fit is pulled toward, and that classes
+// absent from the samples keep: roughly 4 runes per token for prose, fewer for code
+// and JSON, whose punctuation tends to tokenize alone.
+var DefaultCalibration = Calibration{
+	Version:    CalibrationVersion,
+	Prose:      0.25,
+	Code:       0.35,
+	JSON:       0.45,
+	PerMessage: 4,
+	PerRequest: 8,
+}
+
+// CalibrationSample pairs the content of one sent window with the input tokens the
+// provider reported for it.
+type CalibrationSample struct {
+	Runes       ContentRunes
+	InputTokens int64
+}
+
+// ridge is the strength of the pull toward the prior, relative to each feature's
+// own scale. It keeps the fit well-posed when a class or the framing is barely
+// observed, without noticeably biasing well-observed rates.
+const ridge = 1e-3
+
+// FitCalibration fits tokens = Σ rate·runes per class + per-message framing + a
+// per-request constant by ridge-regularised least squares toward DefaultCalibration.
+// Coefficients the data would drive negative keep their prior.
+func FitCalibration(samples []CalibrationSample) (Calibration, error) {
+	if len(samples) < MinCalibrationSamples {
+		return Calibration{}, fmt.Errorf("calibration: need at least %d samples, have %d", MinCalibrationSamples, len(samples))
+	}
+	prior := DefaultCalibration
+	p := []float64{prior.Prose, prior.Code, prior.JSON, prior.PerMessage, prior.PerRequest}
+	const k = 5
+	features := func(r ContentRunes) [k]float64 {
+		return [k]float64{float64(r.Prose), float64(r.Code), float64(r.JSON), float64(r.Messages), 1}
+	}
+
+	free := []bool{true, true, true, true, true}
+	beta := append([]float64(nil), p...)
+	for range k {
+		// Normal equations over the free coefficients; pinned ones contribute their prior.
+		var idx []int
+		for j := range k {
+			if free[j] {
+				idx = append(idx, j)
+			}
+		}
+		n := len(idx)
+		a := make([][]float64, n)
+		for i := range a {
+			a[i] = make([]float64, n)
+		}
+		b := make([]float64, n)
+		for _, s := range samples {
+			x := features(s.Runes)
+			y := float64(s.InputTokens)
+			for j := range k {
+				if !free[j] {
+					y -= x[j] * p[j]
+				}
+			}
+			for i, ji := range idx {
+				b[i] += x[ji] * y
+				for l, jl := range idx {
+					a[i][l] += x[ji] * x[jl]
+				}
+			}
+		}
+		for i, ji := range idx {
+			lambda := ridge*a[i][i] + 1
+			a[i][i] += lambda
+			b[i] += lambda * p[ji]
+		}
+		sol, ok := solve(a, b)
+		if !ok {
+			return Calibration{}, fmt.Errorf("calibration: samples do not determine a fit")
+		}
+		negative := false
+		for i, j := range idx {
+			beta[j] = sol[i]
+			if sol[i] < 0 {
+				free[j], beta[j], negative = false, p[j], true
+			}
+		}
+		if !negative {
+			break
+		}
+	}
+
+	c := Calibration{
+		Version:    CalibrationVersion,
+		FittedAt:   time.Now().UTC(),
+		Samples:    len(samples),
+		Prose:      beta[0],
+		Code:       beta[1],
+		JSON:       beta[2],
+		PerMessage: beta[3],
+		PerRequest: beta[4],
+	}
+	var relErr float64
+	for _, s := range samples {
+		c.Observed = c.Observed.Add(s.Runes)
+		if s.InputTokens > 0 {
+			relErr += math.Abs(c.Estimate(s.Runes)+c.PerRequest-float64(s.InputTokens)) / float64(s.InputTokens)
+		}
+	}
+	c.MeanRelError = relErr / float64(len(samples))
+	return c, nil
+}
+
+// solve solves a·x = b by Gaussian elimination with partial pivoting.
+func solve(a [][]float64, b []float64) ([]float64, bool) {
+	n := len(b)
+	for col := range n {
+		piv := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[piv][col]) {
+				piv = r
+			}
+		}
+		if a[piv][col] == 0 {
+			return nil, false
+		}
+		a[col], a[piv] = a[piv], a[col]
+		b[col], b[piv] = b[piv], b[col]
+		for r := col + 1; r < n; r++ {
+			f := a[r][col] / a[col][col]
+			for c := col; c < n; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+			b[r] -= f * b[col]
+		}
+	}
+	x := make([]float64, n)
+	for r := n - 1; r >= 0; r-- {
+		s := b[r]
+		for c := r + 1; c < n; c++ {
+			s -= a[r][c] * x[c]
+		}
+		x[r] = s / a[r][r]
+	}
+	return x, true
+}
@@ -0,0 +1,138 @@
+package windowing_test
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want windowing.ContentClass
+	}{
+		{benchCorpus[0], windowing.ClassProse},
+		{benchCorpus[1], windowing.ClassCode},
+		{benchCorpus[2], windowing.ClassJSON},
+		{"{not json, just a sentence wrapped in braces}", windowing.ClassProse},
+		{"def f(x):\n    y = x + 1\n    return y\n", windowing.ClassCode},
+		{"", windowing.ClassProse},
+	} {
+		if got := windowing.Classify(tc.text); got != tc.want {
+			t.Errorf("Classify(%.30q) = %v, want %v", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestMeasureContent_SplitsFencedCode(t *testing.T) {
+	msgs := []anthropic.MessageParam{
+		User(T("Why does this fail?\n```go\nfunc main() { panic(nil) }\n```\nThanks.")),
+		anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("t1", map[string]any{}, "test")),
+		User(TRString("t1", `{"ok":true}`)),
+	}
+	r := windowing.MeasureContent(msgs)
+	want := windowing.ContentRunes{
+		Prose:    len("Why does this fail?\n") + len("go") + len("\nThanks.") + len("test"),
+		Code:     len("func main() { panic(nil) }\n"),
+		JSON:     len(`{}`) + len(`{"ok":true}`),
+		Messages: 3,
+	}
+	if r != want {
+		t.Fatalf("MeasureContent = %+v, want %+v", r, want)
+	}
+}
+
+// calibrationSamples synthesises api_usage samples from known rates.
+func calibrationSamples(prose, code, json, perMsg, perReq float64, withJSON bool) []windowing.CalibrationSample {
+	var out []windowing.CalibrationSample
+	for i := range 12 {
+		r := windowing.ContentRunes{Prose: 400 + 130*i, Code: 900 * (i % 4), Messages: 1 + (7*i)%5}
+		if withJSON {
+			r.JSON = 250 * ((i + 1) % 3)
+		}
+		tokens := prose*float64(r.Prose) + code*float64(r.Code) + json*float64(r.JSON) + perMsg*float64(r.Messages) + perReq
+		out = append(out, windowing.CalibrationSample{Runes: r, InputTokens: int64(math.Round(tokens))})
+	}
+	return out
+}
+
+func TestFitCalibration_RecoversRates(t *testing.T) {
+	c, err := windowing.FitCalibration(calibrationSamples(0.22, 0.41, 0.6, 5, 12, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, got := range map[string][2]float64{
+		"prose": {c.Prose, 0.22}, "code": {c.Code, 0.41}, "json": {c.JSON, 0.6},
+	} {
+		if math.Abs(got[0]-got[1]) > 0.01 {
+			t.Errorf("%s rate = %.4f, want %.2f", name, got[0], got[1])
+		}
+	}
+	if c.MeanRelError > 0.01 || c.Samples != 12 {
+		t.Fatalf("poor fit: %+v", c)
+	}
+}
+
+func TestFitCalibration_UnobservedClassKeepsPrior(t *testing.T) {
+	c, err := windowing.FitCalibration(calibrationSamples(0.3, 0.5, 0, 4, 10, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.JSON != windowing.DefaultCalibration.JSON || c.Observed.JSON != 0 {
+		t.Fatalf("json rate %.3f, want prior %.3f", c.JSON, windowing.DefaultCalibration.JSON)
+	}
+	if math.Abs(c.Code-0.5) > 0.01 {
+		t.Fatalf("code rate = %.4f, want 0.5", c.Code)
+	}
+}
+
+func TestFitCalibration_TooFewSamples(t *testing.T) {
+	if _, err := windowing.FitCalibration(calibrationSamples(0.25, 0.3, 0.4, 4, 8, true)[:2]); err == nil {
+		t.Fatal("expected error with 2 samples")
+	}
+}
+
+func TestCalibratedCounter_ProfileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calibration.json")
+	prof := windowing.DefaultCalibration
+	prof.Code = 0.5
+	if err := windowing.SaveCalibration(path, prof); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := windowing.LoadCalibration(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := windowing.CalibratedCounter{Profile: loaded}
+	code := strings.Repeat("x := f(y)\n", 20)
+	// 200 code runes at 0.5 plus 4 per message.
+	if got := c.CountMessage(context.Background(), User(T("```\n"+code+"```"))); got != 104 {
+		t.Fatalf("CountMessage = %d, want 104", got)
+	}
+
+	prof.Version = 99
+	_ = windowing.SaveCalibration(path, prof)
+	if _, err := windowing.LoadCalibration(path); err == nil {
+		t.Fatal("expected error for unknown profile version")
+	}
+}
+
+func TestCalibratedCounter_CountToolsChargesRequestFraming(t *testing.T) {
+	c := windowing.CalibratedCounter{Profile: windowing.DefaultCalibration}
+	if got := c.CountTools(context.Background(), nil); got != 8 {
+		t.Fatalf("CountTools(nil) = %d, want the per-request framing 8", got)
+	}
+	tools := []anthropic.ToolUnionParam{{OfTool: &anthropic.ToolParam{
+		Name:        "read_file",
+		Description: anthropic.String("Read a file relative to the sandbox root."),
+		InputSchema: anthropic.ToolInputSchemaParam{Properties: map[string]any{"path": map[string]any{"type": "string"}}},
+	}}}
+	if got, want := c.CountTools(context.Background(), tools), 8+(windowing.BPECounter{}).CountTools(context.Background(), tools); got != want {
+		t.Fatalf("CountTools = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,251 @@
+package windowing
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Summarizer condenses messages that no longer fit in the send window.
+//
+// previous is the summary already produced for an earlier prefix of the same
+// conversation ("" if none); msgs are the messages dropped since that prefix. The
+// result must cover both, so summaries can be extended incrementally.
+type Summarizer interface {
+	Summarize(ctx context.Context, previous string, msgs []anthropic.MessageParam) (string, error)
+}
+
+// SummarizerFunc adapts a function to the Summarizer interface.
+type SummarizerFunc func(ctx context.Context, previous string, msgs []anthropic.MessageParam) (string, error)
+
+func (f SummarizerFunc) Summarize(ctx context.Context, previous string, msgs []anthropic.MessageParam) (string, error) {
+	return f(ctx, previous, msgs)
+}
+
+// SummaryHeader starts the synthetic message that carries a compaction summary.
+const SummaryHeader = "[Summary of earlier conversation]"
+
+// DefaultSummaryReserve is the share of the budget kept for the summary message.
+const DefaultSummaryReserve = 0.25
+
+// maxCachedSummaries bounds the per-Compactor span cache.
+const maxCachedSummaries = 8
+
+// Compactor prepares send windows like PrepareSendWindow, but instead of silently
+// dropping the oldest groups it replaces them with a summary message at the head of
+// the window.
+//
+// Summaries are cached per span (a group-aligned prefix of the conversation). A step
+// reuses the shortest cached span whose remaining suffix still fits, so the model is not
+// asked to summarise on every step; when a new span is needed the previous summary is
+// extended with only the newly dropped messages. Fresh spans leave the window about a
+// quarter below its share of the budget so later steps have room to grow.
+//
+// A Compactor is safe for concurrent use.
+type Compactor struct {
+	Summarizer Summarizer
+	// Reserve is the share of the budget kept for the summary (DefaultSummaryReserve when ≤ 0).
+	Reserve float64
+
+	mu    sync.Mutex
+	cache []summarySpan // oldest first
+}
+
+type summarySpan struct {
+	end     int      // messages [0, end) are covered
+	hash    [32]byte // of messages [0, end)
+	summary string
+}
+
+// NewCompactor returns a Compactor using s and the default reserve.
+func NewCompactor(s Summarizer) *Compactor {
+	return &Compactor{Summarizer: s}
+}
+
+// PrepareSendWindow returns the send window for msgs within budget. When everything
+// fits, the result equals PrepareSendWindow(ctx, msgs, budget, c, pinned...). Otherwise the
+// window is a user message holding the summary of the dropped prefix, then any pinned
+// groups from that prefix verbatim, then the newest groups; Stats.CompactedGroups and
+// Stats.SummaryTokens describe the summary.
+//
+// If the summariser fails, the plain (dropping) window is returned together with the
+// error, so callers may warn and continue.
+func (cp *Compactor) PrepareSendWindow(ctx context.Context, msgs []anthropic.MessageParam, budget int, c TokenCounter, pinned ...int) ([]anthropic.MessageParam, Stats, error) {
+	return cp.PrepareKeyedWindow(ctx, msgs, msgs, budget, c, pinned...)
+}
+
+// PrepareKeyedWindow is PrepareSendWindow for msgs rewritten from keys, the stored
+// conversation, without changing its message layout (as ElideStaleToolResults does).
+// Cached spans are matched against keys, so rewrites of older messages from one
+// step to the next do not invalidate their summaries. When keys does not line up
+// with msgs, msgs is used.
+func (cp *Compactor) PrepareKeyedWindow(ctx context.Context, msgs, keys []anthropic.MessageParam, budget int, c TokenCounter, pinned ...int) ([]anthropic.MessageParam, Stats, error) {
+	if len(keys) != len(msgs) {
+		keys = msgs
+	}
+	window, stats := PrepareSendWindow(ctx, msgs, budget, c, pinned...)
+	if stats.SkippedGroups == 0 || stats.OverBudgetNewest || stats.OverBudgetPinned || cp.Summarizer == nil {
+		return window, stats, nil
+	}
+
+	reserve := int(float64(budget) * cp.reserve())
+	avail := budget - reserve
+	groups := GroupBlocks(msgs)
+	totalGroups := len(groups)
+
+	// Reuse a cached span when its suffix still fits next to the summary.
+	end, summary, cached := -1, "", false
+	spans := cp.matchingSpans(keys)
+	for _, s := range spans {
+		if _, st := keepFrom(ctx, msgs, s.end, avail, c, pinned); st.SkippedGroups == 0 && !st.OverBudgetNewest && !st.OverBudgetPinned {
+			end, summary, cached = s.end, s.summary, true
+			break
+		}
+	}
+
+	if !cached {
+		// Fresh span: leave headroom, falling back to the full share if the newest group needs it.
+		_, st, start := prepare(ctx, msgs, avail*3/4, c, pinned)
+		if st.OverBudgetNewest || st.OverBudgetPinned {
+			_, st, start = prepare(ctx, msgs, avail, c, pinned)
+		}
+		if st.OverBudgetNewest || st.OverBudgetPinned {
+			vlogf("compact: reason=newest_group_exceeds_reserve budget=%d reserve=%d", budget, reserve)
+			return window, stats, nil
+		}
+		end = len(msgs)
+		if start < len(groups) {
+			end = groups[start].Start
+		}
+
+		// Extend the longest cached prefix of the new span.
+		previous, from := "", 0
+		for _, s := range spans {
+			if s.end <= end && s.end > from {
+				previous, from = s.summary, s.end
+			}
+		}
+		var err error
+		summary, err = cp.Summarizer.Summarize(ctx, previous, msgs[from:end])
+		if err != nil {
+			return window, stats, fmt.Errorf("windowing: summarise %d dropped messages: %w", end-from, err)
+		}
+		cp.store(keys, end, summary)
+	}
+
+	head := fitSummary(ctx, summary, reserve, c)
+	headCost := c.CountMessage(ctx, head)
+	rest, st := keepFrom(ctx, msgs, end, avail, c, pinned)
+	out := make([]anthropic.MessageParam, 0, len(rest)+1)
+	out = append(out, head)
+	out = append(out, rest...)
+
+	included := st.IncludedGroups
+	st.Total += headCost
+	st.Budget = budget
+	st.SkippedGroups = totalGroups - included
+	st.CompactedGroups = totalGroups - included
+	st.SummaryTokens = headCost
+	st.SummaryCached = cached
+	return out, st, nil
+}
+
+// keepFrom prepares the window for msgs[end:] within budget, preceded by the pinned
+// groups of msgs[:end], which are charged first. end must be group-aligned.
+func keepFrom(ctx context.Context, msgs []anthropic.MessageParam, end, budget int, c TokenCounter, pinned []int) ([]anthropic.MessageParam, Stats) {
+	var (
+		head       []anthropic.MessageParam
+		headCost   int
+		headGroups int
+		restPinned []int
+	)
+	for _, g := range GroupBlocks(msgs[:end]) {
+		if slices.ContainsFunc(pinned, func(p int) bool { return p >= g.Start && p < g.End }) {
+			head = append(head, msgs[g.Start:g.End]...)
+			headCost += c.CountGroup(ctx, g, msgs)
+			headGroups++
+		}
+	}
+	for _, p := range pinned {
+		if p >= end {
+			restPinned = append(restPinned, p-end)
+		}
+	}
+	if headCost > budget {
+		return nil, Stats{Budget: budget, SkippedGroups: len(GroupBlocks(msgs)), PinnedGroups: headGroups, PinnedTokens: headCost, OverBudgetPinned: true}
+	}
+	rest, st := PrepareSendWindow(ctx, msgs[end:], budget-headCost, c, restPinned...)
+	if st.OverBudgetNewest || st.OverBudgetPinned {
+		return nil, st
+	}
+	st.Total += headCost
+	st.Budget = budget
+	st.IncludedGroups += headGroups
+	st.PinnedGroups += headGroups
+	st.PinnedTokens += headCost
+	if len(head) == 0 {
+		return rest, st
+	}
+	return append(head, rest...), st
+}
+
+func (cp *Compactor) reserve() float64 {
+	if cp.Reserve <= 0 || cp.Reserve >= 1 {
+		return DefaultSummaryReserve
+	}
+	return cp.Reserve
+}
+
+// matchingSpans returns cached spans that are prefixes of msgs, shortest first.
+func (cp *Compactor) matchingSpans(msgs []anthropic.MessageParam) []summarySpan {
+	cp.mu.Lock()
+	spans := append([]summarySpan(nil), cp.cache...)
+	cp.mu.Unlock()
+
+	var out []summarySpan
+	for _, s := range spans {
+		if s.end <= len(msgs) && hashMessages(msgs[:s.end]) == s.hash {
+			out = append(out, s)
+		}
+	}
+	slices.SortFunc(out, func(a, b summarySpan) int { return a.end - b.end })
+	return out
+}
+
+func (cp *Compactor) store(msgs []anthropic.MessageParam, end int, summary string) {
+	s := summarySpan{end: end, hash: hashMessages(msgs[:end]), summary: summary}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.cache = append(cp.cache, s)
+	if len(cp.cache) > maxCachedSummaries {
+		cp.cache = cp.cache[len(cp.cache)-maxCachedSummaries:]
+	}
+}
+
+// SummaryMessage returns the synthetic user message that carries summary.
+func SummaryMessage(summary string) anthropic.MessageParam {
+	return anthropic.NewUserMessage(anthropic.NewTextBlock(SummaryHeader + "\n" + summary))
+}
+
+// fitSummary builds the summary message, shortening the summary until it costs at
+// most limit tokens.
+func fitSummary(ctx context.Context, summary string, limit int, c TokenCounter) anthropic.MessageParam {
+	m := SummaryMessage(summary)
+	for r := []rune(summary); len(r) > 0; {
+		cost := c.CountMessage(ctx, m)
+		if cost <= limit {
+			break
+		}
+		keep := len(r) * limit / cost
+		if keep >= len(r) {
+			keep = len(r) - 1
+		}
+		r = r[:keep]
+		m = SummaryMessage(string(r) + "…")
+		vlogf("compact: summary_trimmed runes=%d", keep)
+	}
+	return m
+}
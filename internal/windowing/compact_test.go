@@ -0,0 +1,230 @@
+package windowing_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+// recordingSummarizer returns "S<n>" and records each call's arguments.
+type recordingSummarizer struct {
+	calls    int
+	previous []string
+	counts   []int
+	err      error
+}
+
+func (s *recordingSummarizer) Summarize(_ context.Context, previous string, msgs []anthropic.MessageParam) (string, error) {
+	s.calls++
+	s.previous = append(s.previous, previous)
+	s.counts = append(s.counts, len(msgs))
+	if s.err != nil {
+		return "", s.err
+	}
+	return fmt.Sprintf("S%d", s.calls), nil
+}
+
+// history returns n user/assistant singletons of 10 runes each (cost 14).
+func history(n int) []anthropic.MessageParam {
+	msgs := make([]anthropic.MessageParam, 0, n)
+	for i := range n {
+		text := fmt.Sprintf("message%03d", i)
+		if i%2 == 0 {
+			msgs = append(msgs, User(T(text)))
+		} else {
+			msgs = append(msgs, Asst(T(text)))
+		}
+	}
+	return msgs
+}
+
+func headText(t *testing.T, window []anthropic.MessageParam) string {
+	t.Helper()
+	if len(window) == 0 || window[0].Role != anthropic.MessageParamRoleUser || window[0].Content[0].OfText == nil {
+		t.Fatalf("window does not start with a user text message: %+v", window)
+	}
+	return window[0].Content[0].OfText.Text
+}
+
+func TestCompactor_NoCompactionWhenAllFits(t *testing.T) {
+	s := &recordingSummarizer{}
+	cp := windowing.NewCompactor(s)
+	msgs := history(4)
+
+	window, stats, err := cp.PrepareSendWindow(context.Background(), msgs, 1000, windowing.HeuristicCounter{})
+	if err != nil || len(window) != 4 || s.calls != 0 {
+		t.Fatalf("want plain window, got %d msgs, %d calls, err %v", len(window), s.calls, err)
+	}
+	if stats.CompactedGroups != 0 || stats.SummaryTokens != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestCompactor_SummarisesDroppedGroupsAtHead(t *testing.T) {
+	s := &recordingSummarizer{}
+	cp := windowing.NewCompactor(s)
+	msgs := history(40) // 560 tokens
+	budget := 400
+
+	window, stats, err := cp.PrepareSendWindow(context.Background(), msgs, budget, windowing.HeuristicCounter{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	head := headText(t, window)
+	if !strings.HasPrefix(head, windowing.SummaryHeader) || !strings.HasSuffix(head, "S1") {
+		t.Fatalf("unexpected summary message: %q", head)
+	}
+	if s.calls != 1 || s.previous[0] != "" {
+		t.Fatalf("want one fresh summary, got calls=%d previous=%q", s.calls, s.previous)
+	}
+	kept := len(window) - 1
+	if s.counts[0]+kept != len(msgs) {
+		t.Fatalf("summary covered %d messages, window kept %d of %d", s.counts[0], kept, len(msgs))
+	}
+	if window[1].Content[0].OfText.Text != msgs[len(msgs)-kept].Content[0].OfText.Text {
+		t.Fatal("window should continue with the oldest kept message")
+	}
+	if stats.Total > budget || stats.CompactedGroups != s.counts[0] || stats.SkippedGroups != stats.CompactedGroups {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.SummaryTokens != (windowing.HeuristicCounter{}).CountMessage(context.Background(), window[0]) || stats.SummaryCached {
+		t.Fatalf("unexpected summary stats: %+v", stats)
+	}
+}
+
+func TestCompactor_ReusesAndExtendsCachedSpans(t *testing.T) {
+	s := &recordingSummarizer{}
+	cp := windowing.NewCompactor(s)
+	ctx := context.Background()
+	msgs := history(40)
+	budget := 400
+
+	if _, _, err := cp.PrepareSendWindow(ctx, msgs, budget, windowing.HeuristicCounter{}); err != nil {
+		t.Fatalf("first: %v", err)
+	}
+	// The next step adds one message; the cached span still leaves room.
+	msgs = append(msgs, User(T("message040")))
+	window, stats, err := cp.PrepareSendWindow(ctx, msgs, budget, windowing.HeuristicCounter{})
+	if err != nil || s.calls != 1 || !stats.SummaryCached || !strings.HasSuffix(headText(t, window), "S1") {
+		t.Fatalf("want cached summary, got calls=%d stats=%+v err=%v", s.calls, stats, err)
+	}
+
+	// Growing well past the headroom needs a new span built on the previous summary.
+	firstSpan := s.counts[0]
+	msgs = append(msgs, history(60)[41:]...)
+	window, stats, err = cp.PrepareSendWindow(ctx, msgs, budget, windowing.HeuristicCounter{})
+	if err != nil || s.calls != 2 || stats.SummaryCached {
+		t.Fatalf("want a new summary, got calls=%d stats=%+v err=%v", s.calls, stats, err)
+	}
+	if s.previous[1] != "S1" || s.counts[1]+firstSpan+len(window)-1 != len(msgs) {
+		t.Fatalf("second summary should extend S1 with newly dropped messages only: previous=%q counts=%v", s.previous, s.counts)
+	}
+
+	// An edited prefix must not reuse summaries of the original messages.
+	edited := append([]anthropic.MessageParam{User(T("different"))}, msgs[1:]...)
+	if _, stats, _ := cp.PrepareSendWindow(ctx, edited, budget, windowing.HeuristicCounter{}); stats.SummaryCached || s.previous[2] != "" {
+		t.Fatalf("edited history reused a stale summary: stats=%+v previous=%q", stats, s.previous)
+	}
+}
+
+// Elision rewrites older tool_results as they age; summaries keyed on the stored
+// conversation survive it.
+func TestCompactor_KeyedSpansSurviveRewrites(t *testing.T) {
+	s := &recordingSummarizer{}
+	cp := windowing.NewCompactor(s)
+	ctx := context.Background()
+	stored := []anthropic.MessageParam{User(T("start"))}
+	for i := range 12 {
+		id := fmt.Sprintf("t%d", i)
+		stored = append(stored, Asst(TU(id)), User(TRString(id, strings.Repeat("output ", 8))))
+	}
+	budget := 300
+
+	if _, _, err := cp.PrepareKeyedWindow(ctx, stored, stored, budget, windowing.HeuristicCounter{}); err != nil || s.calls != 1 {
+		t.Fatalf("first: calls=%d err=%v", s.calls, err)
+	}
+	stored = append(stored, Asst(T("done")))
+	elided, el := windowing.ElideStaleToolResults(stored, 2)
+	if el.Results == 0 {
+		t.Fatal("test needs elided results")
+	}
+	_, stats, err := cp.PrepareKeyedWindow(ctx, elided, stored, budget, windowing.HeuristicCounter{})
+	if err != nil || s.calls != 1 || !stats.SummaryCached {
+		t.Fatalf("rewritten messages invalidated the summary: calls=%d stats=%+v err=%v", s.calls, stats, err)
+	}
+}
+
+func TestCompactor_KeepsToolPairsWhole(t *testing.T) {
+	cp := windowing.NewCompactor(&recordingSummarizer{})
+	var msgs []anthropic.MessageParam
+	for i := range 8 {
+		id := fmt.Sprintf("t%d", i)
+		msgs = append(msgs, Asst(TU(id)), User(TRString(id, strings.Repeat("x", 20))))
+	}
+	window, _, err := cp.PrepareSendWindow(context.Background(), msgs, 120, windowing.HeuristicCounter{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for _, g := range windowing.GroupBlocks(window[1:]) {
+		if g.Kind != windowing.GroupPair {
+			t.Fatalf("window split a tool pair: %+v", windowing.GroupBlocks(window[1:]))
+		}
+	}
+}
+
+func TestCompactor_TrimsOversizedSummary(t *testing.T) {
+	long := windowing.SummarizerFunc(func(context.Context, string, []anthropic.MessageParam) (string, error) {
+		return strings.Repeat("y", 500), nil
+	})
+	cp := windowing.NewCompactor(long)
+	budget := 400
+	_, stats, err := cp.PrepareSendWindow(context.Background(), history(40), budget, windowing.HeuristicCounter{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if stats.SummaryTokens > budget/4 || stats.Total > budget {
+		t.Fatalf("summary not trimmed to its reserve: %+v", stats)
+	}
+}
+
+func TestCompactor_SummariserErrorFallsBackToDropping(t *testing.T) {
+	boom := errors.New("boom")
+	cp := windowing.NewCompactor(&recordingSummarizer{err: boom})
+	msgs := history(40)
+
+	window, stats, err := cp.PrepareSendWindow(context.Background(), msgs, 400, windowing.HeuristicCounter{})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected summariser error, got %v", err)
+	}
+	plain, plainStats := windowing.PrepareSendWindow(context.Background(), msgs, 400, windowing.HeuristicCounter{})
+	if len(window) != len(plain) || stats != plainStats {
+		t.Fatalf("want plain window on failure: got %d msgs %+v, want %d msgs %+v", len(window), stats, len(plain), plainStats)
+	}
+}
+
+func TestCompactor_KeepsPinnedMessagesAfterSummary(t *testing.T) {
+	s := &recordingSummarizer{}
+	cp := windowing.NewCompactor(s)
+	msgs := history(40)
+
+	window, stats, err := cp.PrepareSendWindow(context.Background(), msgs, 400, windowing.HeuristicCounter{}, 2)
+	if err != nil || s.calls != 1 {
+		t.Fatalf("err %v, %d calls", err, s.calls)
+	}
+	if !strings.HasPrefix(headText(t, window), windowing.SummaryHeader) || window[1].Content[0].OfText.Text != "message002" {
+		t.Fatalf("pinned message should follow the summary: %+v", window[:2])
+	}
+	if stats.PinnedTokens != 14 || stats.Total > 400 || stats.SkippedGroups != stats.CompactedGroups {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	// The pinned message is also sent when the cached span is reused.
+	window, stats, _ = cp.PrepareSendWindow(context.Background(), append(msgs, User(T("message040"))), 400, windowing.HeuristicCounter{}, 2)
+	if !stats.SummaryCached || window[1].Content[0].OfText.Text != "message002" {
+		t.Fatalf("cached window lost the pin: %+v", stats)
+	}
+}
@@ -0,0 +1,294 @@
+package windowing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// CountFunc counts the input tokens of a request, e.g. provider.Provider.CountTokens.
+type CountFunc func(ctx context.Context, params anthropic.MessageNewParams) (int64, error)
+
+// Defaults for APICounter.
+const (
+	DefaultCountTimeout = 10 * time.Second
+	DefaultCountBackoff = time.Minute
+)
+
+// APICounter counts tokens exactly with the Messages CountTokens endpoint.
+//
+// Each group is counted in a request of its own and the fixed per-request overhead
+// (measured once with a one-character message) is subtracted. Singleton messages are
+// counted alone; tool pairs are counted together because the API rejects a tool_use
+// or tool_result without its partner. Results are cached by content hash, so each
+// message (or pair) costs at most one call for the lifetime of the counter. Tool
+// definitions are counted the same way (see ToolCounter).
+//
+// The API also rejects tool blocks in a request that defines no tools, so pairs are
+// counted with the definitions last passed to CountTools attached, and their cached
+// cost is subtracted. Until CountTools has been given tools, pairs use Fallback.
+//
+// When a call fails (offline, rate limited, endpoint unsupported), the group is
+// counted with Fallback and the API is not tried again for Backoff. Fallback results
+// are not cached. HeuristicCounter counts runes, which overestimate tokens, so the
+// default fallback keeps windows within budget at the cost of including less.
+//
+// An APICounter is safe for concurrent use.
+type APICounter struct {
+	Count    CountFunc
+	Model    anthropic.Model
+	Fallback TokenCounter  // HeuristicCounter when nil
+	Timeout  time.Duration // per call; DefaultCountTimeout when zero
+	Backoff  time.Duration // API pause after a failure; DefaultCountBackoff when zero
+
+	mu        sync.Mutex
+	cache     map[[32]byte]int
+	tools     []anthropic.ToolUnionParam // from the last CountTools, attached to pair counts
+	overhead  int
+	measured  bool
+	downUntil time.Time
+}
+
+// NewAPICounter returns an APICounter for model using count.
+func NewAPICounter(count CountFunc, model anthropic.Model) *APICounter {
+	return &APICounter{Count: count, Model: model}
+}
+
+// CountMessage counts m alone; messages with tool blocks use the fallback, since the
+// API only accepts them as part of a pair (see CountGroup).
+func (a *APICounter) CountMessage(ctx context.Context, m anthropic.MessageParam) int {
+	if hasTool(m) {
+		return a.fallback().CountMessage(ctx, m)
+	}
+	return a.count(ctx, []anthropic.MessageParam{m}, func() int { return a.fallback().CountMessage(ctx, m) })
+}
+
+func (a *APICounter) CountGroup(ctx context.Context, g Group, all []anthropic.MessageParam) int {
+	msgs := all[g.Start:min(g.End, len(all))]
+	if g.Kind == GroupSingleton && len(msgs) == 1 && hasTool(msgs[0]) {
+		// Broken pair halves cannot be counted by the API.
+		return a.fallback().CountGroup(ctx, g, all)
+	}
+	return a.count(ctx, msgs, func() int { return a.fallback().CountGroup(ctx, g, all) })
+}
+
+// CountTools counts tool definitions, including the tool use system prompt. When
+// the API is unavailable the fallback is used if it is a ToolCounter, else 0.
+func (a *APICounter) CountTools(ctx context.Context, tools []anthropic.ToolUnionParam) int {
+	a.mu.Lock()
+	a.tools = tools
+	a.mu.Unlock()
+	if len(tools) == 0 {
+		return 0
+	}
+	fallback := func() int {
+		if tc, ok := a.fallback().(ToolCounter); ok {
+			return tc.CountTools(ctx, tools)
+		}
+		return 0
+	}
+	key, err := toolsKey(tools)
+	if err != nil {
+		return fallback()
+	}
+	return a.cached(ctx, key, fallback, func(overhead int) (int, error) {
+		return a.measureTools(ctx, tools, overhead)
+	})
+}
+
+// toolsCost returns the cached cost of tools, measuring and caching it when unknown.
+func (a *APICounter) toolsCost(ctx context.Context, tools []anthropic.ToolUnionParam, overhead int) (int, error) {
+	key, err := toolsKey(tools)
+	if err != nil {
+		return 0, err
+	}
+	a.mu.Lock()
+	n, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok {
+		return n, nil
+	}
+	if n, err = a.measureTools(ctx, tools, overhead); err != nil {
+		return 0, err
+	}
+	a.store(key, n)
+	return n, nil
+}
+
+// measureTools counts tools, with the tool use system prompt, next to the lead-in message.
+func (a *APICounter) measureTools(ctx context.Context, tools []anthropic.ToolUnionParam, overhead int) (int, error) {
+	total, err := a.call(ctx, []anthropic.MessageParam{leadIn()}, tools)
+	return max(int(total)-overhead-1, 0), err
+}
+
+func toolsKey(tools []anthropic.ToolUnionParam) ([32]byte, error) {
+	b, err := json.Marshal(tools)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(append([]byte("tools:"), b...)), nil
+}
+
+// CachedEntries reports the number of cached counts.
+func (a *APICounter) CachedEntries() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.cache)
+}
+
+func (a *APICounter) count(ctx context.Context, msgs []anthropic.MessageParam, fallback func() int) int {
+	var tools []anthropic.ToolUnionParam
+	if slices.ContainsFunc(msgs, hasTool) {
+		a.mu.Lock()
+		tools = a.tools
+		a.mu.Unlock()
+		if len(tools) == 0 {
+			return fallback()
+		}
+	}
+	return a.cached(ctx, hashMessages(msgs), fallback, func(overhead int) (int, error) {
+		if len(tools) > 0 {
+			toolsCost, err := a.toolsCost(ctx, tools, overhead)
+			if err != nil {
+				return 0, err
+			}
+			overhead += toolsCost
+		}
+		total, err := a.call(ctx, countable(msgs), tools)
+		if msgs[0].Role == anthropic.MessageParamRoleAssistant {
+			overhead++ // the one-character lead-in user message
+		}
+		return max(int(total)-overhead, 0), err
+	})
+}
+
+// cached returns the count stored under key, or measures it with the request
+// overhead known. Failures pause the API and return fallback(); once ctx is done,
+// fallback() is returned without pausing, as the API itself did not fail.
+func (a *APICounter) cached(ctx context.Context, key [32]byte, fallback func() int, measure func(overhead int) (int, error)) int {
+	a.mu.Lock()
+	if n, ok := a.cache[key]; ok {
+		a.mu.Unlock()
+		return n
+	}
+	down := time.Now().Before(a.downUntil)
+	a.mu.Unlock()
+	if down || ctx.Err() != nil {
+		return fallback()
+	}
+
+	overhead, err := a.requestOverhead(ctx)
+	if err != nil {
+		return a.fail(ctx, err, fallback)
+	}
+	n, err := measure(overhead)
+	if err != nil {
+		return a.fail(ctx, err, fallback)
+	}
+
+	a.store(key, n)
+	return n
+}
+
+func (a *APICounter) store(key [32]byte, n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cache == nil {
+		a.cache = make(map[[32]byte]int)
+	}
+	a.cache[key] = n
+}
+
+// requestOverhead measures the tokens of a request holding a single "." user message.
+func (a *APICounter) requestOverhead(ctx context.Context) (int, error) {
+	a.mu.Lock()
+	if a.measured {
+		defer a.mu.Unlock()
+		return a.overhead, nil
+	}
+	a.mu.Unlock()
+	n, err := a.call(ctx, []anthropic.MessageParam{leadIn()}, nil)
+	if err != nil {
+		return 0, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.overhead, a.measured = max(int(n)-1, 0), true
+	return a.overhead, nil
+}
+
+// call counts one request, bounded by Timeout and by ctx.
+func (a *APICounter) call(ctx context.Context, msgs []anthropic.MessageParam, tools []anthropic.ToolUnionParam) (int64, error) {
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCountTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return a.Count(ctx, anthropic.MessageNewParams{Model: a.Model, Messages: msgs, Tools: tools})
+}
+
+// fail pauses API counting and returns the fallback count.
+func (a *APICounter) fail(ctx context.Context, err error, fallback func() int) int {
+	if ctx.Err() != nil {
+		return fallback()
+	}
+	backoff := a.Backoff
+	if backoff <= 0 {
+		backoff = DefaultCountBackoff
+	}
+	a.mu.Lock()
+	a.downUntil = time.Now().Add(backoff)
+	a.mu.Unlock()
+	fmt.Fprintf(os.Stderr, "warning: token counting failed (%v); using %T counts for %s\n", err, a.fallback(), backoff)
+	return fallback()
+}
+
+func (a *APICounter) fallback() TokenCounter {
+	if a.Fallback == nil {
+		return HeuristicCounter{}
+	}
+	return a.Fallback
+}
+
+// countable makes msgs a valid request: it must start with a user message.
+func countable(msgs []anthropic.MessageParam) []anthropic.MessageParam {
+	if msgs[0].Role == anthropic.MessageParamRoleUser {
+		return msgs
+	}
+	return append([]anthropic.MessageParam{leadIn()}, msgs...)
+}
+
+func leadIn() anthropic.MessageParam {
+	return anthropic.NewUserMessage(anthropic.NewTextBlock("."))
+}
+
+func hasTool(m anthropic.MessageParam) bool {
+	for _, blk := range m.Content {
+		if blk.OfToolUse != nil || blk.OfToolResult != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hashMessages identifies messages by their wire form.
+func hashMessages(msgs []anthropic.MessageParam) [32]byte {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, m := range msgs {
+		if err := enc.Encode(m); err != nil {
+			fmt.Fprintf(h, "unencodable:%v", err)
+		}
+	}
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
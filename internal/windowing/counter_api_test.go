@@ -0,0 +1,216 @@
+package windowing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/petasbytes/go-agent/internal/provider"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+// countServer stubs /v1/messages/count_tokens: 7 tokens of overhead, one per word of
+// text, two per tool_use block and ten per tool definition. It returns 500 while
+// failing is set and, like the API, 400 for tool blocks in a request without tools.
+type countServer struct {
+	calls   atomic.Int32
+	failing atomic.Bool
+	bodies  []map[string]any
+}
+
+func (s *countServer) counter(t *testing.T) *windowing.APICounter {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.calls.Add(1)
+		if r.URL.Path != "/v1/messages/count_tokens" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if s.failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"api_error","message":"down"}}`))
+			return
+		}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		s.bodies = append(s.bodies, body)
+		tools, _ := body["tools"].([]any)
+		if b, _ := json.Marshal(body["messages"]); len(tools) == 0 && strings.Contains(string(b), `"tool_`) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"tool blocks require tools to be defined"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"input_tokens": 7 + stubTokens(body["messages"]) + 10*len(tools)})
+	}))
+	t.Cleanup(srv.Close)
+	c := anthropic.NewClient(option.WithBaseURL(srv.URL), option.WithAPIKey("test-key"))
+	return windowing.NewAPICounter(provider.NewAnthropic(&c).CountTokens, provider.DefaultModel)
+}
+
+func stubTokens(v any) int {
+	n := 0
+	switch v := v.(type) {
+	case []any:
+		for _, e := range v {
+			n += stubTokens(e)
+		}
+	case map[string]any:
+		if v["type"] == "tool_use" {
+			n += 2
+		}
+		if s, ok := v["text"].(string); ok {
+			n += len(strings.Fields(s))
+		}
+		for k, e := range v {
+			if k != "text" {
+				n += stubTokens(e)
+			}
+		}
+	}
+	return n
+}
+
+func TestAPICounter_CountsAndCachesPerMessage(t *testing.T) {
+	srv := &countServer{}
+	c := srv.counter(t)
+	hello := User(T("hello there world"))
+
+	if got := c.CountMessage(context.Background(), hello); got != 3 {
+		t.Fatalf("CountMessage = %d, want 3", got)
+	}
+	if got := c.CountMessage(context.Background(), Asst(T("two words"))); got != 2 {
+		t.Fatalf("assistant CountMessage = %d, want 2 (lead-in excluded)", got)
+	}
+	calls := srv.calls.Load() // overhead probe + 2 messages
+	if calls != 3 {
+		t.Fatalf("want 3 calls, got %d", calls)
+	}
+	if first := srv.bodies[2]["messages"].([]any)[0].(map[string]any); first["role"] != "user" {
+		t.Errorf("assistant-first request needs a user lead-in: %v", srv.bodies[2])
+	}
+
+	// The same content in another conversation position is served from the cache.
+	msgs := []anthropic.MessageParam{User(T("other")), hello}
+	if got := c.CountGroup(context.Background(), windowing.Group{Kind: windowing.GroupSingleton, Start: 1, End: 2}, msgs); got != 3 {
+		t.Fatalf("CountGroup = %d, want 3", got)
+	}
+	if srv.calls.Load() != calls || c.CachedEntries() != 2 {
+		t.Fatalf("cached message was re-counted: calls=%d entries=%d", srv.calls.Load(), c.CachedEntries())
+	}
+}
+
+func TestAPICounter_CountsToolPairsTogether(t *testing.T) {
+	srv := &countServer{}
+	c := srv.counter(t)
+	msgs := []anthropic.MessageParam{
+		Asst(TU("t1")),
+		User(TRString("t1", "four words of output")),
+	}
+	groups := windowing.GroupBlocks(msgs)
+	// Before any tool definitions are known, the pair cannot be sent and uses the heuristic.
+	if got, want := c.CountGroup(context.Background(), groups[0], msgs), (windowing.HeuristicCounter{}).CountGroup(context.Background(), groups[0], msgs); got != want || srv.calls.Load() != 0 {
+		t.Fatalf("pair without tools = %d after %d calls, want heuristic %d and no calls", got, srv.calls.Load(), want)
+	}
+
+	tools := []anthropic.ToolUnionParam{{OfTool: &anthropic.ToolParam{Name: "t", InputSchema: anthropic.ToolInputSchemaParam{}}}}
+	if got := c.CountTools(context.Background(), tools); got != 10 {
+		t.Fatalf("CountTools = %d, want 10", got)
+	}
+	// Tools attached to the pair request, with their cost subtracted.
+	if got := c.CountGroup(context.Background(), groups[0], msgs); got != 6 {
+		t.Fatalf("pair = %d, want 6", got)
+	}
+	if last := srv.bodies[len(srv.bodies)-1]; last["tools"] == nil {
+		t.Fatalf("pair counted without tools: %v", last)
+	}
+	// A lone tool message cannot be sent to the API and uses the heuristic.
+	calls := srv.calls.Load()
+	if got, want := c.CountMessage(context.Background(), msgs[1]), (windowing.HeuristicCounter{}).CountMessage(context.Background(), msgs[1]); got != want {
+		t.Fatalf("lone tool_result = %d, want heuristic %d", got, want)
+	}
+	if srv.calls.Load() != calls {
+		t.Fatal("lone tool message must not be sent to the API")
+	}
+}
+
+func TestAPICounter_FallsBackWhileUnavailable(t *testing.T) {
+	srv := &countServer{}
+	c := srv.counter(t)
+	c.Backoff = 50 * time.Millisecond
+	srv.failing.Store(true)
+	m := User(T("hello there world"))
+	heuristic := (windowing.HeuristicCounter{}).CountMessage(context.Background(), m)
+
+	if got := c.CountMessage(context.Background(), m); got != heuristic {
+		t.Fatalf("fallback = %d, want %d", got, heuristic)
+	}
+	calls := srv.calls.Load()
+	_ = c.CountMessage(context.Background(), User(T("another")))
+	if srv.calls.Load() != calls {
+		t.Fatal("API called again during backoff")
+	}
+
+	// Once the backoff passes and the endpoint recovers, exact counts resume.
+	srv.failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	if got := c.CountMessage(context.Background(), m); got != 3 {
+		t.Fatalf("after recovery = %d, want 3", got)
+	}
+}
+
+func TestAPICounter_UnsupportedProviderUsesFallback(t *testing.T) {
+	unsupported := func(context.Context, anthropic.MessageNewParams) (int64, error) {
+		return 0, provider.ErrUnsupported
+	}
+	c := windowing.NewAPICounter(unsupported, "local")
+	c.Fallback = fixedCounter(5)
+	if got := c.CountMessage(context.Background(), User(T("x"))); got != 5 {
+		t.Fatalf("got %d, want fallback 5", got)
+	}
+	_, stats := windowing.PrepareSendWindow(context.Background(), []anthropic.MessageParam{User(T("a")), User(T("b"))}, 10, c)
+	if stats.Total != 10 || stats.IncludedGroups != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestAPICounter_CallsFollowCallerContext(t *testing.T) {
+	var calls atomic.Int32
+	count := func(ctx context.Context, _ anthropic.MessageNewParams) (int64, error) {
+		if calls.Add(1) == 1 {
+			<-ctx.Done() // hangs until the caller gives up
+			return 0, ctx.Err()
+		}
+		return 8, nil
+	}
+	c := windowing.NewAPICounter(count, "m")
+	c.Fallback = fixedCounter(5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if got := c.CountMessage(ctx, User(T("x"))); got != 5 {
+		t.Fatalf("got %d, want fallback 5", got)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("count outlived the caller's context: %s", d)
+	}
+
+	// A cancelled caller is not an API failure, so the API is not paused.
+	if got := c.CountMessage(context.Background(), User(T("y"))); got == 5 || calls.Load() < 2 {
+		t.Fatalf("API paused after caller cancellation: got %d after %d calls", got, calls.Load())
+	}
+}
+
+type fixedCounter int
+
+func (f fixedCounter) CountMessage(context.Context, anthropic.MessageParam) int { return int(f) }
+func (f fixedCounter) CountGroup(_ context.Context, g windowing.Group, _ []anthropic.MessageParam) int {
+	return int(f) * (g.End - g.Start)
+}
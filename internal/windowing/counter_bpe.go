@@ -0,0 +1,97 @@
+package windowing
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/tokenizer"
+)
+
+// Fixed framing costs used by BPECounter, in tokens.
+const (
+	bpeMessageOverhead = 4 // role and turn delimiters
+	bpeBlockOverhead   = 2 // content block framing
+	bpeToolOverhead    = 8 // per tool definition
+	// ToolUseSystemPromptTokens is the system prompt Anthropic adds when tools are
+	// offered (tool_choice auto/none), per the tool use pricing documentation.
+	ToolUseSystemPromptTokens = 346
+)
+
+// BPECounter estimates token counts offline with the embedded BPE vocabulary (see
+// internal/tokenizer), so budgets can be expressed in tokens rather than runes.
+//
+// Unlike HeuristicCounter it counts every block with text in it: text, tool_use
+// name and input JSON, tool_result content, and thinking. Images, documents and
+// redacted thinking count framing only. It also implements ToolCounter.
+type BPECounter struct {
+	Tokenizer *tokenizer.Tokenizer // tokenizer.Default() when nil
+}
+
+func (c BPECounter) tok() *tokenizer.Tokenizer {
+	if c.Tokenizer == nil {
+		return tokenizer.Default()
+	}
+	return c.Tokenizer
+}
+
+func (c BPECounter) CountMessage(_ context.Context, m anthropic.MessageParam) int {
+	total := bpeMessageOverhead
+	for _, blk := range m.Content {
+		total += bpeBlockOverhead + c.countBlock(blk)
+	}
+	return total
+}
+
+func (c BPECounter) CountGroup(ctx context.Context, g Group, all []anthropic.MessageParam) int {
+	total := 0
+	for i := g.Start; i < g.End && i < len(all); i++ {
+		total += c.CountMessage(ctx, all[i])
+	}
+	return total
+}
+
+// CountTools sizes tool definitions (name, description and input schema) plus the
+// tool use system prompt.
+func (c BPECounter) CountTools(_ context.Context, tools []anthropic.ToolUnionParam) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	total := ToolUseSystemPromptTokens
+	for _, t := range tools {
+		tp := t.OfTool
+		if tp == nil {
+			continue
+		}
+		total += bpeToolOverhead + c.tok().Count(tp.Name) + c.tok().Count(tp.Description.Value)
+		if b, err := json.Marshal(tp.InputSchema); err == nil {
+			total += c.tok().Count(string(b))
+		}
+	}
+	return total
+}
+
+func (c BPECounter) countBlock(blk anthropic.ContentBlockParamUnion) int {
+	t := c.tok()
+	switch {
+	case blk.OfText != nil:
+		return t.Count(blk.OfText.Text)
+	case blk.OfToolUse != nil:
+		n := t.Count(blk.OfToolUse.Name)
+		if b, err := json.Marshal(blk.OfToolUse.Input); err == nil {
+			n += t.Count(string(b))
+		}
+		return n
+	case blk.OfToolResult != nil:
+		n := 0
+		for _, nb := range blk.OfToolResult.Content {
+			if nb.OfText != nil {
+				n += t.Count(nb.OfText.Text)
+			}
+		}
+		return n
+	case blk.OfThinking != nil:
+		return t.Count(blk.OfThinking.Thinking)
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+package windowing_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/tokenizer"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+func TestBPECounter_CountsTextAndFraming(t *testing.T) {
+	c := windowing.BPECounter{}
+	text := "The quick brown fox jumps over the lazy dog."
+	want := 4 + 2 + tokenizer.Default().Count(text) // message + block framing
+	if got := c.CountMessage(context.Background(), User(T(text))); got != want {
+		t.Fatalf("CountMessage = %d, want %d", got, want)
+	}
+	if got := c.CountGroup(context.Background(), windowing.Group{Start: 0, End: 2}, []anthropic.MessageParam{User(T(text)), User(T(text))}); got != 2*want {
+		t.Fatalf("CountGroup = %d, want %d", got, 2*want)
+	}
+}
+
+func TestBPECounter_CountsToolInputAndResults(t *testing.T) {
+	c := windowing.BPECounter{}
+	small := anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("t1", map[string]any{"path": "a.go"}, "read_file"))
+	large := anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("t1", map[string]any{"path": "a.go", "content": strings.Repeat("some file content ", 50)}, "edit_file"))
+	if c.CountMessage(context.Background(), large) <= c.CountMessage(context.Background(), small)+50 {
+		t.Errorf("tool_use input not counted: small=%d large=%d", c.CountMessage(context.Background(), small), c.CountMessage(context.Background(), large))
+	}
+	// The heuristic ignores tool_use input entirely.
+	h := windowing.HeuristicCounter{}
+	if h.CountMessage(context.Background(), large) != h.CountMessage(context.Background(), small) {
+		t.Fatal("heuristic behaviour changed; update this comparison")
+	}
+
+	result := User(TRString("t1", "package main\n\nfunc main() {}\n"))
+	if got := c.CountMessage(context.Background(), result); got <= 4+2 {
+		t.Errorf("tool_result content not counted: %d", got)
+	}
+}
+
+func TestBPECounter_CountTools(t *testing.T) {
+	c := windowing.BPECounter{}
+	if c.CountTools(context.Background(), nil) != 0 {
+		t.Fatal("no tools should cost nothing")
+	}
+	tool := anthropic.ToolUnionParam{OfTool: &anthropic.ToolParam{
+		Name:        "read_file",
+		Description: anthropic.String("Read a file relative to the sandbox root."),
+		InputSchema: anthropic.ToolInputSchemaParam{Properties: map[string]any{"path": map[string]any{"type": "string"}}},
+	}}
+	one := c.CountTools(context.Background(), []anthropic.ToolUnionParam{tool})
+	two := c.CountTools(context.Background(), []anthropic.ToolUnionParam{tool, tool})
+	if one <= windowing.ToolUseSystemPromptTokens || two-one != one-windowing.ToolUseSystemPromptTokens {
+		t.Fatalf("unexpected tool costs: one=%d two=%d", one, two)
+	}
+}
+
+func TestBPECounter_CloserToTokensThanRunesOnCode(t *testing.T) {
+	// Budgets in tokens: rune counts overshoot code and JSON several times over.
+	m := User(T(benchCorpus[1]))
+	bpe, runes := windowing.BPECounter{}.CountMessage(context.Background(), m), windowing.HeuristicCounter{}.CountMessage(context.Background(), m)
+	if bpe*2 > runes {
+		t.Fatalf("BPE %d vs runes %d: expected well under half", bpe, runes)
+	}
+}
+
+var benchCorpus = []string{
+	"Please review the changes in internal/runner and explain why the retry loop gives up early when the context deadline is close.",
+	"func (r *Runner) RunTurn(ctx context.Context, model anthropic.Model, conv []anthropic.MessageParam) ([]anthropic.MessageParam, Usage, error) {\n\tvar usage Usage\n\tfor {\n\t\tmsg, toolResults, err := r.RunOneStep(ctx, model, conv)\n\t\tif err != nil {\n\t\t\treturn conv, usage, err\n\t\t}\n\t}\n}\n",
+	`{"entries":["cmd/","internal/","memory/","tools/","go.mod","go.sum","README.md"],"page":1,"page_size":200,"total":7}`,
+	"日本語のテキストも含まれています。これはトークン数の見積もりに影響します。",
+}
+
+func benchMessages() []anthropic.MessageParam {
+	var msgs []anthropic.MessageParam
+	for i := range 50 {
+		s := benchCorpus[i%len(benchCorpus)]
+		msgs = append(msgs,
+			User(T(s)),
+			anthropic.NewAssistantMessage(anthropic.NewToolUseBlock("t", map[string]any{"path": "x.go"}, "read_file")),
+			User(TRString("t", s)),
+		)
+	}
+	return msgs
+}
+
+func benchmarkCounter(b *testing.B, c windowing.TokenCounter) {
+	msgs := benchMessages()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for b.Loop() {
+		for _, m := range msgs {
+			_ = c.CountMessage(context.Background(), m)
+		}
+	}
+}
+
+func BenchmarkHeuristicCounter(b *testing.B) { benchmarkCounter(b, windowing.HeuristicCounter{}) }
+func BenchmarkBPECounter(b *testing.B)       { benchmarkCounter(b, windowing.BPECounter{}) }
+
+// BenchmarkBPECounter_Uncached measures cold encoding, with every chunk new to the cache.
+func BenchmarkBPECounter_Uncached(b *testing.B) {
+	msgs := benchMessages()
+	for b.Loop() {
+		b.StopTimer()
+		c := windowing.BPECounter{Tokenizer: tokenizer.New()}
+		b.StartTimer()
+		for _, m := range msgs {
+			_ = c.CountMessage(context.Background(), m)
+		}
+	}
+}
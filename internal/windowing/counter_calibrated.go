@@ -0,0 +1,234 @@
+package windowing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// CalibrationVersion is the current calibration profile format.
+const CalibrationVersion = 1
+
+// ContentClass is the kind of text a run of runes holds; each class tokenizes at a
+// different rate (prose packs more runes into a token than code or JSON).
+type ContentClass int
+
+const (
+	ClassProse ContentClass = iota
+	ClassCode
+	ClassJSON
+)
+
+func (c ContentClass) String() string {
+	switch c {
+	case ClassCode:
+		return "code"
+	case ClassJSON:
+		return "json"
+	default:
+		return "prose"
+	}
+}
+
+// ContentRunes is the content of a window broken down by class: the features a
+// calibration profile maps to tokens.
+type ContentRunes struct {
+	Prose    int `json:"prose"`
+	Code     int `json:"code"`
+	JSON     int `json:"json"`
+	Messages int `json:"messages"`
+}
+
+// Add returns the sum of r and o.
+func (r ContentRunes) Add(o ContentRunes) ContentRunes {
+	return ContentRunes{r.Prose + o.Prose, r.Code + o.Code, r.JSON + o.JSON, r.Messages + o.Messages}
+}
+
+func (r *ContentRunes) addText(s string) {
+	for s != "" {
+		// Fenced blocks are code (or JSON); the text around them is classified as a whole.
+		before, rest, fenced := strings.Cut(s, "```")
+		r.addClass(Classify(before), before)
+		if !fenced {
+			return
+		}
+		body, after, _ := strings.Cut(rest, "```")
+		if lang, code, ok := strings.Cut(body, "\n"); ok && !strings.ContainsAny(lang, " \t") {
+			r.Prose += utf8.RuneCountInString(lang) // info string, e.g. "go"
+			body = code
+		}
+		if c := Classify(body); c == ClassJSON {
+			r.addClass(ClassJSON, body)
+		} else {
+			r.addClass(ClassCode, body)
+		}
+		s = after
+	}
+}
+
+func (r *ContentRunes) addClass(c ContentClass, s string) {
+	n := utf8.RuneCountInString(s)
+	switch c {
+	case ClassCode:
+		r.Code += n
+	case ClassJSON:
+		r.JSON += n
+	default:
+		r.Prose += n
+	}
+}
+
+// MeasureContent breaks msgs down into runes per class. Text and thinking blocks are
+// classified, tool_use inputs count as JSON and tool_result text is classified.
+func MeasureContent(msgs []anthropic.MessageParam) ContentRunes {
+	var r ContentRunes
+	for _, m := range msgs {
+		r.Messages++
+		for _, blk := range m.Content {
+			switch {
+			case blk.OfText != nil:
+				r.addText(blk.OfText.Text)
+			case blk.OfThinking != nil:
+				r.addText(blk.OfThinking.Thinking)
+			case blk.OfToolUse != nil:
+				r.Prose += utf8.RuneCountInString(blk.OfToolUse.Name)
+				if b, err := json.Marshal(blk.OfToolUse.Input); err == nil {
+					r.JSON += utf8.RuneCount(b)
+				}
+			case blk.OfToolResult != nil:
+				for _, c := range blk.OfToolResult.Content {
+					if c.OfText != nil {
+						r.addText(c.OfText.Text)
+					}
+				}
+			}
+		}
+	}
+	return r
+}
+
+// Classify guesses the content class of s: valid JSON objects and arrays are JSON,
+// text dense in code punctuation or mostly indented lines is code, anything else prose.
+func Classify(s string) ContentClass {
+	t := strings.TrimSpace(s)
+	if t == "" {
+		return ClassProse
+	}
+	if (t[0] == '{' || t[0] == '[') && json.Valid([]byte(t)) {
+		return ClassJSON
+	}
+	var runes, symbols int
+	for _, c := range t {
+		runes++
+		if strings.ContainsRune("{}[]()<>;=&|*/\\_$#:", c) {
+			symbols++
+		}
+	}
+	lines, indented := 0, 0
+	for _, l := range strings.Split(t, "\n") {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		lines++
+		if strings.HasPrefix(l, "\t") || strings.HasPrefix(l, "    ") {
+			indented++
+		}
+	}
+	if float64(symbols) >= 0.06*float64(runes) || (lines >= 3 && 3*indented >= lines) {
+		return ClassCode
+	}
+	return ClassProse
+}
+
+// Calibration is a fitted runes->tokens model for one model's tokenizer. It is
+// written by `agent calibrate` from api_usage telemetry and loaded by CalibratedCounter.
+type Calibration struct {
+	Version  int       `json:"version"`
+	Model    string    `json:"model,omitempty"`
+	FittedAt time.Time `json:"fitted_at"`
+	Samples  int       `json:"samples"`
+
+	// Tokens per rune of each content class.
+	Prose float64 `json:"tokens_per_rune_prose"`
+	Code  float64 `json:"tokens_per_rune_code"`
+	JSON  float64 `json:"tokens_per_rune_json"`
+	// Framing tokens per message and per request.
+	PerMessage float64 `json:"tokens_per_message"`
+	PerRequest float64 `json:"tokens_per_request"`
+
+	// Observed runes per class across the samples; a class with none keeps its prior rate.
+	Observed ContentRunes `json:"observed_runes"`
+	// Mean absolute error of the fit relative to the real input tokens.
+	MeanRelError float64 `json:"mean_rel_error"`
+}
+
+// Estimate returns the token estimate for content, excluding the per-request framing.
+func (c Calibration) Estimate(r ContentRunes) float64 {
+	return c.Prose*float64(r.Prose) + c.Code*float64(r.Code) + c.JSON*float64(r.JSON) + c.PerMessage*float64(r.Messages)
+}
+
+// LoadCalibration reads a calibration profile written by SaveCalibration.
+func LoadCalibration(path string) (Calibration, error) {
+	var c Calibration
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("calibration profile %s: %w", path, err)
+	}
+	if c.Version != CalibrationVersion {
+		return c, fmt.Errorf("calibration profile %s: unsupported version %d (re-run calibration)", path, c.Version)
+	}
+	if c.Prose <= 0 || c.Code <= 0 || c.JSON <= 0 {
+		return c, errors.New("calibration profile " + path + ": token rates must be positive")
+	}
+	return c, nil
+}
+
+// SaveCalibration writes c to path as indented JSON, creating parent directories.
+func SaveCalibration(path string, c Calibration) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// CalibratedCounter estimates tokens from runes per content class using a fitted
+// Calibration, so budgets stay in tokens without network access or a vocabulary.
+// It implements ToolCounter, which also carries the profile's per-request framing.
+type CalibratedCounter struct {
+	Profile Calibration
+}
+
+func (c CalibratedCounter) CountMessage(_ context.Context, m anthropic.MessageParam) int {
+	return int(math.Ceil(c.Profile.Estimate(MeasureContent([]anthropic.MessageParam{m}))))
+}
+
+func (c CalibratedCounter) CountGroup(ctx context.Context, g Group, all []anthropic.MessageParam) int {
+	total := 0
+	for i := g.Start; i < g.End && i < len(all); i++ {
+		total += c.CountMessage(ctx, all[i])
+	}
+	return total
+}
+
+// CountTools charges the profile's per-request framing, which the runner asks for
+// once per request, plus the tool definitions sized by BPECounter: profiles are
+// fitted from windows sent without tools, so they have no rate for definitions.
+func (c CalibratedCounter) CountTools(ctx context.Context, tools []anthropic.ToolUnionParam) int {
+	return int(math.Ceil(c.Profile.PerRequest)) + BPECounter{}.CountTools(ctx, tools)
+}
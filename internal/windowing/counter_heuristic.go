@@ -1,15 +1,23 @@
 package windowing
 
 import (
+	"context"
 	"unicode/utf8"
 
 	"github.com/anthropics/anthropic-sdk-go"
 )
 
-// TokenCounter estimates input-token cost for messages or groups.
+// TokenCounter estimates input-token cost for messages or groups. ctx bounds any
+// network calls a counter makes; offline counters ignore it.
 type TokenCounter interface {
-	CountMessage(m anthropic.MessageParam) int
-	CountGroup(g Group, all []anthropic.MessageParam) int
+	CountMessage(ctx context.Context, m anthropic.MessageParam) int
+	CountGroup(ctx context.Context, g Group, all []anthropic.MessageParam) int
+}
+
+// ToolCounter is implemented by counters that can also size tool definitions,
+// which are sent with every request and so reduce the budget left for messages.
+type ToolCounter interface {
+	CountTools(ctx context.Context, tools []anthropic.ToolUnionParam) int
 }
 
 // HeuristicCounter is the current default deterministic estimator.
@@ -24,7 +32,7 @@ type HeuristicCounter struct{}
 // Fixed per-block overhead for deterministic counts; changing this requires updating the guard test.
 const blockOverhead = 4
 
-func (HeuristicCounter) CountMessage(m anthropic.MessageParam) int {
+func (HeuristicCounter) CountMessage(_ context.Context, m anthropic.MessageParam) int {
 	total := 0
 	for _, blk := range m.Content {
 		total += countBlock(blk)
@@ -32,10 +40,10 @@ func (HeuristicCounter) CountMessage(m anthropic.MessageParam) int {
 	return total
 }
 
-func (h HeuristicCounter) CountGroup(g Group, all []anthropic.MessageParam) int {
+func (h HeuristicCounter) CountGroup(ctx context.Context, g Group, all []anthropic.MessageParam) int {
 	total := 0
 	for i := g.Start; i < g.End && i < len(all); i++ {
-		total += h.CountMessage(all[i])
+		total += h.CountMessage(ctx, all[i])
 	}
 	return total
 }
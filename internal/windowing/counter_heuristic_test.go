@@ -4,6 +4,7 @@
 package windowing_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/anthropics/anthropic-sdk-go"
@@ -14,9 +15,9 @@ func TestHeuristicCounter_TextBlocks_CountsRunes(t *testing.T) {
 	h := windowing.HeuristicCounter{}
 	// ASCII + multibyte (emoji)
 	msg := User(T("hello"), T("👍"))
-	got := h.CountMessage(msg)
+	got := h.CountMessage(context.Background(), msg)
 	// Derive per-block overhead from an empty text block (0 runes => result equals overhead)
-	overhead := h.CountMessage(User(T("")))
+	overhead := h.CountMessage(context.Background(), User(T("")))
 	// "hello" = 5 runes, "👍" = 1 rune; 2 blocks overhead
 	want := (5 + 1) + 2*overhead
 	if got != want {
@@ -28,8 +29,8 @@ func TestHeuristicCounter_ToolResult_StringPayload(t *testing.T) {
 	h := windowing.HeuristicCounter{}
 	payload := "abcdef" // 6 runes
 	msg := User(TRString("t1", payload))
-	got := h.CountMessage(msg)
-	overhead := h.CountMessage(User(T("")))
+	got := h.CountMessage(context.Background(), msg)
+	overhead := h.CountMessage(context.Background(), User(T("")))
 	want := 6 + overhead
 	if got != want {
 		t.Fatalf("got=%d want=%d", got, want)
@@ -43,8 +44,8 @@ func TestHeuristicCounter_ToolResult_NestedTextPayload(t *testing.T) {
 		T("世界"), // 2 runes (Chinese chars)
 	}
 	msg := User(TRNested("t1", nested))
-	got := h.CountMessage(msg)
-	overhead := h.CountMessage(User(T("")))
+	got := h.CountMessage(context.Background(), msg)
+	overhead := h.CountMessage(context.Background(), User(T("")))
 	want := (2 + 2) + overhead
 	if got != want {
 		t.Fatalf("got=%d want=%d", got, want)
@@ -62,10 +63,10 @@ func TestHeuristicCounter_CountGroup_SumsMessages(t *testing.T) {
 
 	total := 0
 	for _, g := range groups {
-		total += h.CountGroup(g, msgs)
+		total += h.CountGroup(context.Background(), g, msgs)
 	}
 
-	overhead := h.CountMessage(User(T("")))
+	overhead := h.CountMessage(context.Background(), User(T("")))
 	want := (1 + overhead) + (1 + 1 + 2*overhead) + (3 + overhead)
 	if total != want {
 		t.Fatalf("got=%d want=%d", total, want)
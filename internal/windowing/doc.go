@@ -1,3 +1,7 @@
 // Package windowing provides pair-safe grouping and budgeted context window
 // preparation for Anthropic Messages API conversations.
+//
+// PrepareSendWindow drops the oldest groups that do not fit the budget, except
+// groups holding pinned messages, which are charged first; a Compactor instead
+// replaces dropped groups with a cached summary message.
 package windowing
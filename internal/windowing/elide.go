@@ -0,0 +1,126 @@
+package windowing
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Elision summarizes the tool_result payloads replaced by ElideStaleToolResults.
+type Elision struct {
+	Results int // tool_result blocks replaced by a stub
+	Runes   int // payload runes removed (before adding stubs)
+}
+
+// ElideStaleToolResults returns a copy of msgs in which the payload of every
+// tool_result outside the newest keepRecent pairs is replaced by a short stub, e.g.
+//
+//	[elided 8,214 runes of read_file output; re-read if needed]
+//
+// Only validated pairs (see GroupBlocks) are touched, and blocks keep their
+// tool_use_id and is_error flag, so the window remains pair-safe and acceptable to
+// the API. Payloads no longer than their stub are left as they are. msgs is not
+// modified.
+func ElideStaleToolResults(msgs []anthropic.MessageParam, keepRecent int) ([]anthropic.MessageParam, Elision) {
+	var el Elision
+	if keepRecent < 0 {
+		keepRecent = 0
+	}
+	groups := GroupBlocks(msgs)
+	pairs := 0
+	for _, g := range groups {
+		if g.Kind == GroupPair {
+			pairs++
+		}
+	}
+	if pairs <= keepRecent {
+		return msgs, el
+	}
+
+	out := msgs
+	copied := false
+	stale := pairs - keepRecent
+	for _, g := range groups {
+		if stale == 0 {
+			break
+		}
+		if g.Kind != GroupPair {
+			continue
+		}
+		stale--
+		names := toolNames(msgs[g.Start])
+		res := msgs[g.Start+1]
+		var content []anthropic.ContentBlockParamUnion
+		for i, blk := range res.Content {
+			tr := blk.OfToolResult
+			if tr == nil {
+				continue
+			}
+			runes := toolResultRunes(tr)
+			stub := elisionStub(runes, names[tr.ToolUseID])
+			if runes <= utf8.RuneCountInString(stub) {
+				continue
+			}
+			if content == nil {
+				content = append([]anthropic.ContentBlockParamUnion(nil), res.Content...)
+			}
+			elided := *tr
+			elided.Content = []anthropic.ToolResultBlockParamContentUnion{{OfText: &anthropic.TextBlockParam{Text: stub}}}
+			content[i] = anthropic.ContentBlockParamUnion{OfToolResult: &elided}
+			el.Results++
+			el.Runes += runes
+		}
+		if content == nil {
+			continue
+		}
+		if !copied {
+			out = append([]anthropic.MessageParam(nil), msgs...)
+			copied = true
+		}
+		out[g.Start+1] = anthropic.MessageParam{Role: res.Role, Content: content}
+	}
+	if el.Results > 0 {
+		vlogf("elide: results=%d runes=%d keep_recent=%d", el.Results, el.Runes, keepRecent)
+	}
+	return out, el
+}
+
+// toolNames maps tool_use ids in an assistant message to tool names.
+func toolNames(m anthropic.MessageParam) map[string]string {
+	names := make(map[string]string)
+	for _, blk := range m.Content {
+		if tu := blk.OfToolUse; tu != nil {
+			names[tu.ID] = tu.Name
+		}
+	}
+	return names
+}
+
+// toolResultRunes counts the text runes of a tool_result payload.
+func toolResultRunes(tr *anthropic.ToolResultBlockParam) int {
+	n := 0
+	for _, c := range tr.Content {
+		if c.OfText != nil {
+			n += utf8.RuneCountInString(c.OfText.Text)
+		}
+	}
+	return n
+}
+
+func elisionStub(runes int, tool string) string {
+	if tool == "" {
+		tool = "tool"
+	}
+	return fmt.Sprintf("[elided %s runes of %s output; re-read if needed]", groupThousands(runes), tool)
+}
+
+// groupThousands formats n with comma separators (8214 -> "8,214").
+func groupThousands(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
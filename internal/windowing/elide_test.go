@@ -0,0 +1,87 @@
+package windowing_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+// readPair returns assistant(tool_use read_file) + user(tool_result) with a payload of n runes.
+func readPair(id string, n int, isErr bool) []anthropic.MessageParam {
+	use := anthropic.ContentBlockParamUnion{OfToolUse: &anthropic.ToolUseBlockParam{ID: id, Name: "read_file", Input: map[string]any{"path": id + ".go"}}}
+	return []anthropic.MessageParam{
+		Asst(T("reading"), use),
+		User(anthropic.NewToolResultBlock(id, strings.Repeat("é", n), isErr), T("next")),
+	}
+}
+
+func resultText(m anthropic.MessageParam) string {
+	return m.Content[0].OfToolResult.Content[0].OfText.Text
+}
+
+func TestElideStaleToolResults_StubsOlderPairsOnly(t *testing.T) {
+	var msgs []anthropic.MessageParam
+	msgs = append(msgs, User(T("look at the code")))
+	msgs = append(msgs, readPair("a", 8214, false)...)
+	msgs = append(msgs, readPair("b", 500, true)...)
+	msgs = append(msgs, readPair("c", 300, false)...)
+	before := windowing.GroupBlocks(msgs)
+
+	out, el := windowing.ElideStaleToolResults(msgs, 1)
+
+	if got := resultText(out[2]); got != "[elided 8,214 runes of read_file output; re-read if needed]" {
+		t.Errorf("unexpected stub: %q", got)
+	}
+	if !strings.HasPrefix(resultText(out[4]), "[elided 500 runes of read_file") {
+		t.Errorf("second pair should be elided: %q", resultText(out[4]))
+	}
+	if len([]rune(resultText(out[6]))) != 300 {
+		t.Error("newest pair must stay verbatim")
+	}
+	if el.Results != 2 || el.Runes != 8714 {
+		t.Errorf("unexpected elision counts: %+v", el)
+	}
+
+	// Pairing, ids, error flags and trailing text survive; the input is untouched.
+	tr := out[4].Content[0].OfToolResult
+	if tr.ToolUseID != "b" || !tr.IsError.Value || out[4].Content[1].OfText.Text != "next" {
+		t.Errorf("elided block lost its metadata: %+v", out[4].Content)
+	}
+	if !groupsEqual(windowing.GroupBlocks(out), before) {
+		t.Errorf("grouping changed: %v vs %v", windowing.GroupBlocks(out), before)
+	}
+	if len([]rune(resultText(msgs[2]))) != 8214 {
+		t.Error("input messages were modified")
+	}
+}
+
+func TestElideStaleToolResults_NothingToElide(t *testing.T) {
+	var msgs []anthropic.MessageParam
+	msgs = append(msgs, readPair("a", 10, false)...) // shorter than its stub
+	msgs = append(msgs, readPair("b", 900, false)...)
+
+	if out, el := windowing.ElideStaleToolResults(msgs, 2); el.Results != 0 || &out[0] != &msgs[0] {
+		t.Fatalf("keepRecent covers every pair: %+v", el)
+	}
+	out, el := windowing.ElideStaleToolResults(msgs, 1)
+	if el.Results != 0 || len([]rune(resultText(out[1]))) != 10 {
+		t.Fatalf("short payloads should be kept: %+v", el)
+	}
+}
+
+func TestElideStaleToolResults_FitsMorePairsInBudget(t *testing.T) {
+	var msgs []anthropic.MessageParam
+	for _, id := range []string{"a", "b", "c", "d"} {
+		msgs = append(msgs, readPair(id, 1000, false)...)
+	}
+	budget := 1300
+	_, plain := windowing.PrepareSendWindow(context.Background(), msgs, budget, windowing.HeuristicCounter{})
+	elided, _ := windowing.ElideStaleToolResults(msgs, 1)
+	_, stats := windowing.PrepareSendWindow(context.Background(), elided, budget, windowing.HeuristicCounter{})
+	if plain.IncludedGroups != 1 || stats.SkippedGroups != 0 {
+		t.Fatalf("elision should let all pairs fit: plain=%+v elided=%+v", plain, stats)
+	}
+}
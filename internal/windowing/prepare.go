@@ -1,6 +1,10 @@
 package windowing
 
-import "github.com/anthropics/anthropic-sdk-go"
+import (
+	"context"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
 
 // Stats summarizes the result of window preparation.
 //
@@ -10,25 +14,60 @@ import "github.com/anthropics/anthropic-sdk-go"
 // - IncludedGroups: number of groups included.
 // - SkippedGroups: total groups minus IncludedGroups.
 // - OverBudgetNewest: true when the newest single group alone exceeds Budget.
+// - CompactedGroups: skipped groups covered by a summary message (Compactor only).
+// - SummaryTokens: estimated cost of the summary message, included in Total.
+// - SummaryCached: the summary was reused from an earlier step.
+// - ElidedResults, ElidedRunes: tool_result payloads replaced by stubs before
+// preparation (see ElideStaleToolResults).
+// - ToolsTokens: cost of tool definitions taken out of the budget, included in Total
+// (set by the runner when the counter is a ToolCounter).
+// - SystemTokens: cost of the system prompt taken out of the budget, included in
+// Total (set by the runner).
+// - PinnedGroups, PinnedTokens: groups holding pinned messages, which are always
+// included and charged first; their cost is included in Total.
+// - OverBudgetPinned: true when the pinned groups alone exceed Budget.
 type Stats struct {
 	Total            int
 	Budget           int
 	IncludedGroups   int
 	SkippedGroups    int
 	OverBudgetNewest bool
+	CompactedGroups  int
+	SummaryTokens    int
+	SummaryCached    bool
+	ElidedResults    int
+	ElidedRunes      int
+	ToolsTokens      int
+	SystemTokens     int
+	PinnedGroups     int
+	PinnedTokens     int
+	OverBudgetPinned bool
 }
 
 // PrepareSendWindow returns a subslice of msgs (oldest→newest) that fits within
-// budget using the TokenCounter, without splitting groups.
+// budget using the TokenCounter, without splitting groups. ctx is passed to the
+// counter.
 //
 // Rules:
+// - Groups containing a pinned message index are always included and charged first.
 // - Include whole groups scanning newest→oldest while total ≤ budget.
 // - If the newest group alone exceeds budget, return an empty window and set OverBudgetNewest.
+// - If the pinned groups alone exceed budget, return an empty window and set OverBudgetPinned.
 // - If budget ≤ 0, return an empty window (OverBudgetNewest set when any groups exist).
-func PrepareSendWindow(msgs []anthropic.MessageParam, budget int, c TokenCounter) ([]anthropic.MessageParam, Stats) {
+//
+// With pinned messages older than the included groups, the window is a new slice
+// holding those pinned groups followed by the newest groups.
+func PrepareSendWindow(ctx context.Context, msgs []anthropic.MessageParam, budget int, c TokenCounter, pinned ...int) ([]anthropic.MessageParam, Stats) {
+	window, stats, _ := prepare(ctx, msgs, budget, c, pinned)
+	return window, stats
+}
+
+// prepare implements PrepareSendWindow and also returns the group index where the
+// contiguous newest part of the window starts (len(groups) when nothing is included).
+func prepare(ctx context.Context, msgs []anthropic.MessageParam, budget int, c TokenCounter, pinned []int) ([]anthropic.MessageParam, Stats, int) {
 	// Base cases
 	if len(msgs) == 0 {
-		return nil, Stats{Budget: budget}
+		return nil, Stats{Budget: budget}, 0
 	}
 
 	groups := GroupBlocks(msgs)
@@ -39,29 +78,51 @@ func PrepareSendWindow(msgs []anthropic.MessageParam, budget int, c TokenCounter
 		if len(groups) > 0 {
 			stats.OverBudgetNewest = true
 		}
-		return nil, stats
+		return nil, stats, len(groups)
 	}
 
 	// Walk groups newest → oldest and find the earliest included group index.
 	// We first compute each group's cost once to avoid re-counting.
 	type gCost struct {
-		idx  int
-		cost int
+		idx    int
+		cost   int
+		pinned bool
 	}
 	costs := make([]gCost, len(groups))
+	pinnedTotal, pinnedGroups := 0, 0
 	for i, g := range groups {
-		costs[i] = gCost{idx: i, cost: c.CountGroup(g, msgs)}
+		costs[i] = gCost{idx: i, cost: c.CountGroup(ctx, g, msgs)}
+		for _, p := range pinned {
+			if p >= g.Start && p < g.End {
+				costs[i].pinned = true
+				pinnedTotal += costs[i].cost
+				pinnedGroups++
+				break
+			}
+		}
+	}
+	if pinnedTotal > budget {
+		vlogf("reason=over_budget_pinned budget=%d cost=%d", budget, pinnedTotal)
+		return nil, Stats{
+			Budget:           budget,
+			SkippedGroups:    len(groups),
+			PinnedGroups:     pinnedGroups,
+			PinnedTokens:     pinnedTotal,
+			OverBudgetPinned: true,
+		}, len(groups)
 	}
 
-	total := 0
-	included := 0
+	total := pinnedTotal
 	startIdx := len(groups) // exclusive sentinel; will be lowered when a group is included
 
 	for gi := len(groups) - 1; gi >= 0; gi-- {
 		gc := costs[gi]
-		// If no groups have been included yet and the newest group alone exceeds budget,
+		if gc.pinned {
+			continue // already charged
+		}
+		// If the newest group alone exceeds the budget left after pinned groups,
 		// return empty window and mark OverBudgetNewest=true.
-		if included == 0 && gc.cost > budget {
+		if gi == len(groups)-1 && total+gc.cost > budget {
 			vlogf("reason=over_budget_newest_group budget=%d cost=%d", budget, gc.cost)
 			return nil, Stats{
 				Total:            0,
@@ -69,12 +130,13 @@ func PrepareSendWindow(msgs []anthropic.MessageParam, budget int, c TokenCounter
 				IncludedGroups:   0,
 				SkippedGroups:    len(groups),
 				OverBudgetNewest: true,
-			}
+				PinnedGroups:     pinnedGroups,
+				PinnedTokens:     pinnedTotal,
+			}, len(groups)
 		}
 
 		if total+gc.cost <= budget {
 			total += gc.cost
-			included++
 			startIdx = gi
 			continue
 		}
@@ -83,21 +145,38 @@ func PrepareSendWindow(msgs []anthropic.MessageParam, budget int, c TokenCounter
 		break
 	}
 
-	if included == 0 {
+	included := len(groups) - startIdx
+	if included == 0 && pinnedGroups == 0 {
 		// There were groups but none could be included (handled above for newest>budget),
 		// or there was some other corner case; return empty window within budget.
-		return nil, Stats{Total: 0, Budget: budget, IncludedGroups: 0, SkippedGroups: len(groups)}
+		return nil, Stats{Total: 0, Budget: budget, IncludedGroups: 0, SkippedGroups: len(groups)}, len(groups)
 	}
 
 	// Convert group index to message index start (groups are contiguous and non-overlapping).
-	startMsg := groups[startIdx].Start
-	window := msgs[startMsg:]
+	var window []anthropic.MessageParam
+	if startIdx < len(groups) {
+		window = msgs[groups[startIdx].Start:]
+	}
+
+	// Pinned groups older than the newest part are placed before it, in order.
+	var head []anthropic.MessageParam
+	for gi := 0; gi < startIdx; gi++ {
+		if costs[gi].pinned {
+			head = append(head, msgs[groups[gi].Start:groups[gi].End]...)
+			included++
+		}
+	}
+	if len(head) > 0 {
+		window = append(head, window...)
+	}
 
 	stats := Stats{
 		Total:          total,
 		Budget:         budget,
 		IncludedGroups: included,
 		SkippedGroups:  len(groups) - included,
+		PinnedGroups:   pinnedGroups,
+		PinnedTokens:   pinnedTotal,
 	}
-	return window, stats
+	return window, stats, startIdx
 }
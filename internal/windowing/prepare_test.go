@@ -1,6 +1,7 @@
 package windowing_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/anthropics/anthropic-sdk-go"
@@ -17,7 +18,7 @@ func TestPrepareSendWindow_BudgetRespected_OrderPreserved(t *testing.T) {
 	}
 	budget := 17 // G2(8)  G1(9) = 17
 
-	window, stats := windowing.PrepareSendWindow(msgs, budget, windowing.HeuristicCounter{})
+	window, stats := windowing.PrepareSendWindow(context.Background(), msgs, budget, windowing.HeuristicCounter{})
 
 	if stats.Budget != budget || stats.Total != 17 || stats.IncludedGroups != 2 || stats.OverBudgetNewest {
 		t.Fatalf("unexpected stats: %+v", stats)
@@ -39,7 +40,7 @@ func TestPrepareSendWindow_NewestGroupOverBudget(t *testing.T) {
 	}
 	budget := 10 // less than newest group cost (14)
 
-	window, stats := windowing.PrepareSendWindow(msgs, budget, windowing.HeuristicCounter{})
+	window, stats := windowing.PrepareSendWindow(context.Background(), msgs, budget, windowing.HeuristicCounter{})
 
 	if len(window) != 0 {
 		t.Fatalf("expected empty window; got=%d", len(window))
@@ -53,7 +54,7 @@ func TestPrepareSendWindow_NoCapacityBudget_WithGroups(t *testing.T) {
 	msgs := []anthropic.MessageParam{
 		User(T("x")), // at least one group
 	}
-	window, stats := windowing.PrepareSendWindow(msgs, 0, windowing.HeuristicCounter{})
+	window, stats := windowing.PrepareSendWindow(context.Background(), msgs, 0, windowing.HeuristicCounter{})
 
 	if len(window) != 0 || !stats.OverBudgetNewest || stats.SkippedGroups != 1 || stats.IncludedGroups != 0 {
 		t.Fatalf("unpexpected stats: %+v", stats)
@@ -61,7 +62,7 @@ func TestPrepareSendWindow_NoCapacityBudget_WithGroups(t *testing.T) {
 }
 
 func TestPrepareSendWindow_EmptyMsgs(t *testing.T) {
-	window, stats := windowing.PrepareSendWindow(nil, 123, windowing.HeuristicCounter{})
+	window, stats := windowing.PrepareSendWindow(context.Background(), nil, 123, windowing.HeuristicCounter{})
 	if window != nil || stats.Budget != 123 || stats.Total != 0 || stats.OverBudgetNewest {
 		t.Fatalf("unexpected result: window=%v stats=%+v", window, stats)
 	}
@@ -83,7 +84,7 @@ func TestPrepareSendWindow_AllFitIncludingOldest(t *testing.T) {
 
 	// Budget allows all three groups
 	budget := 24
-	window, stats := windowing.PrepareSendWindow(msgs, budget, counter)
+	window, stats := windowing.PrepareSendWindow(context.Background(), msgs, budget, counter)
 
 	if stats.Budget != budget {
 		t.Fatalf("Budget echo mismatch: got=%d want=%d", stats.Budget, budget)
@@ -121,7 +122,7 @@ func TestPrepareSendWindow_ExactlyOneOlderAlsoFits(t *testing.T) {
 	counter := windowing.HeuristicCounter{}
 
 	budget := 14
-	window, stats := windowing.PrepareSendWindow(msgs, budget, counter)
+	window, stats := windowing.PrepareSendWindow(context.Background(), msgs, budget, counter)
 
 	if stats.Budget != budget {
 		t.Fatalf("Budget echo mismatch: got=%d want=%d", stats.Budget, budget)
@@ -146,9 +147,43 @@ func TestPrepareSendWindow_ExactlyOneOlderAlsoFits(t *testing.T) {
 	// Verify total cost equals budget (6 + 8)
 	gotCost := 0
 	for _, m := range window {
-		gotCost += counter.CountMessage(m)
+		gotCost += counter.CountMessage(context.Background(), m)
 	}
 	if gotCost != 14 {
 		t.Fatalf("total cost mismatch: got=%d want=14", gotCost)
 	}
 }
+
+func TestPrepareSendWindow_PinnedChargedFirstAndKept(t *testing.T) {
+	msgs := []anthropic.MessageParam{
+		User(T("task: fix it")), // G0: 12 + 4 = 16 (pinned)
+		Asst(T("older")),        // G1: 9
+		User(T("newer")),        // G2: 9
+		Asst(T("newest")),       // G3: 10
+	}
+	// 16 pinned + 10 + 9 = 35: G1 no longer fits.
+	window, stats := windowing.PrepareSendWindow(context.Background(), msgs, 35, windowing.HeuristicCounter{}, 0)
+
+	if stats.Total != 35 || stats.PinnedTokens != 16 || stats.PinnedGroups != 1 || stats.IncludedGroups != 3 || stats.SkippedGroups != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(window) != 3 || window[0].Content[0].OfText.Text != "task: fix it" || window[1].Content[0].OfText.Text != "newer" {
+		t.Fatalf("unexpected window: %+v", window)
+	}
+	if &msgs[0] == &window[0] || msgs[1].Content[0].OfText.Text != "older" {
+		t.Fatal("input must not be modified")
+	}
+
+	// Without the pin the oldest groups are dropped newest-first as before.
+	if w, st := windowing.PrepareSendWindow(context.Background(), msgs, 35, windowing.HeuristicCounter{}); len(w) != 3 || st.PinnedTokens != 0 || w[0].Content[0].OfText.Text != "older" {
+		t.Fatalf("unpinned window changed: %+v %+v", w, st)
+	}
+}
+
+func TestPrepareSendWindow_PinnedOverBudget(t *testing.T) {
+	msgs := []anthropic.MessageParam{User(T("a long pinned instruction")), Asst(T("ok"))}
+	window, stats := windowing.PrepareSendWindow(context.Background(), msgs, 20, windowing.HeuristicCounter{}, 0)
+	if len(window) != 0 || !stats.OverBudgetPinned || stats.OverBudgetNewest || stats.PinnedTokens != 29 {
+		t.Fatalf("unexpected result: %d msgs, %+v", len(window), stats)
+	}
+}
@@ -6,13 +6,16 @@ import (
 	"os"
 )
 
-// Message is a minimal persisted view of a chat turn.
-// For simplicity, currently storing only text. Tool blocks are transient.
+// Message is the legacy (version 1) text-only view of a chat turn.
+// New code should use LoadHistory/SaveHistory, which keep every content block.
 type Message struct {
 	Role string `json:"role"`
 	Text string `json:"text,omitempty"`
 }
 
+// LoadConversation reads a version 1 text-only conversation.
+//
+// Deprecated: use LoadHistory, which also migrates this format.
 func LoadConversation(path string) ([]Message, error) {
 	b, err := os.ReadFile(path)
 	if err != nil {
@@ -28,6 +31,9 @@ func LoadConversation(path string) ([]Message, error) {
 	return msgs, nil
 }
 
+// SaveConversation writes a version 1 text-only conversation.
+//
+// Deprecated: use SaveHistory.
 func SaveConversation(path string, msgs []Message) error {
 	b, err := json.MarshalIndent(msgs, "", " ")
 	if err != nil {
@@ -1,6 +1,9 @@
-// Package memory provides minimal conversation persistence.
+// Package memory provides conversation persistence.
 //
 // Persistence model:
-//   - Only text messages are stored (role + text). Tool blocks are transient.
-//   - Keeping initial storage simple for now; to be extended.
+//   - SaveHistory stores the full conversation (every content block, including
+//     tool_use/tool_result pairs and thinking) in a versioned JSON file.
+//   - LoadHistory also reads the legacy text-only array format and migrates it.
+//   - Restored history is checked against windowing pair invariants so it can be
+//     sent as-is.
 package memory
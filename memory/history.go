@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/windowing"
+)
+
+// HistoryVersion is the on-disk format written by SaveHistory.
+//
+// Versions:
+//   - 1: legacy JSON array of Message (role + text only); read and migrated.
+//   - 2: {"version": 2, "messages": [...]} where each message is an
+//     anthropic.MessageParam in Messages API wire form, so text, tool_use (with
+//     input), tool_result (with is_error), thinking and redacted_thinking blocks
+//     all round-trip.
+//   - 3: adds "turns", one record per user turn carrying the runner turn_id and the
+//     index of the turn's first message. Older files get turns derived on read.
+const HistoryVersion = 3
+
+// ErrBrokenPairs reports a restored history whose tool_use/tool_result pairs do not
+// satisfy windowing.GroupBlocks invariants.
+var ErrBrokenPairs = errors.New("history: broken tool_use/tool_result pairing")
+
+type historyFile struct {
+	Version  int                      `json:"version"`
+	Meta     *SessionMeta             `json:"meta,omitempty"` // set for session files
+	Turns    []TurnRecord             `json:"turns,omitempty"`
+	Messages []anthropic.MessageParam `json:"messages"`
+}
+
+// LoadHistory reads a conversation saved by SaveHistory or a legacy text-only
+// conversation.json. A missing file yields (nil, nil).
+//
+// If the history breaks tool pair invariants (e.g. a tool_use without its results),
+// the valid prefix is returned together with an error wrapping ErrBrokenPairs.
+func LoadHistory(path string) ([]anthropic.MessageParam, error) {
+	f, err := readHistoryFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return checkPairs(f.Messages)
+}
+
+// SaveHistory writes msgs in the current format. The file is replaced atomically
+// so a crash mid-write cannot truncate the existing history.
+func SaveHistory(path string, msgs []anthropic.MessageParam) error {
+	return writeHistoryFile(path, historyFile{Messages: msgs})
+}
+
+// readHistoryFile decodes any supported version, migrating legacy arrays.
+func readHistoryFile(path string) (historyFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return historyFile{}, err
+	}
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		// Version 1: text-only array
+		var legacy []Message
+		if err := json.Unmarshal(b, &legacy); err != nil {
+			return historyFile{}, err
+		}
+		msgs := FromText(legacy)
+		return historyFile{Version: 1, Turns: deriveTurns(msgs), Messages: msgs}, nil
+	}
+	var f historyFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return historyFile{}, err
+	}
+	if f.Version < 2 || f.Version > HistoryVersion {
+		return historyFile{}, fmt.Errorf("history: unsupported version %d (supported: 1-%d)", f.Version, HistoryVersion)
+	}
+	if len(f.Turns) == 0 {
+		f.Turns = deriveTurns(f.Messages)
+	}
+	return f, nil
+}
+
+// writeHistoryFile stamps the current version and replaces path atomically.
+func writeHistoryFile(path string, f historyFile) error {
+	f.Version = HistoryVersion
+	if f.Messages == nil {
+		f.Messages = []anthropic.MessageParam{}
+	}
+	b, err := json.MarshalIndent(f, "", " ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkPairs returns msgs, or its valid prefix and an ErrBrokenPairs error.
+func checkPairs(msgs []anthropic.MessageParam) ([]anthropic.MessageParam, error) {
+	if n := validPairPrefix(msgs); n < len(msgs) {
+		return msgs[:n], fmt.Errorf("%w at message %d; dropped %d trailing messages", ErrBrokenPairs, n, len(msgs)-n)
+	}
+	return msgs, nil
+}
+
+// FromText converts legacy text-only messages to message params.
+func FromText(msgs []Message) []anthropic.MessageParam {
+	out := make([]anthropic.MessageParam, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Role == "user" {
+			out = append(out, anthropic.NewUserMessage(anthropic.NewTextBlock(m.Text)))
+		} else {
+			out = append(out, anthropic.NewAssistantMessage(anthropic.NewTextBlock(m.Text)))
+		}
+	}
+	return out
+}
+
+// validPairPrefix returns the length of the longest prefix in which every tool_use
+// and tool_result belongs to a validated pair group.
+func validPairPrefix(msgs []anthropic.MessageParam) int {
+	for _, g := range windowing.GroupBlocks(msgs) {
+		if g.Kind == windowing.GroupSingleton && hasToolBlocks(msgs[g.Start]) {
+			return g.Start
+		}
+	}
+	return len(msgs)
+}
+
+func hasToolBlocks(m anthropic.MessageParam) bool {
+	for _, b := range m.Content {
+		if b.OfToolUse != nil || b.OfToolResult != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package memory_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/windowing"
+	"github.com/petasbytes/go-agent/memory"
+)
+
+// fullConversation exercises every persisted block kind.
+func fullConversation() []anthropic.MessageParam {
+	return []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("read a.go")),
+		anthropic.NewAssistantMessage(
+			anthropic.NewThinkingBlock("sig-123", "I should read the file."),
+			anthropic.NewRedactedThinkingBlock("opaque"),
+			anthropic.NewTextBlock("Reading."),
+			anthropic.NewToolUseBlock("t1", json.RawMessage(`{"path":"a.go","limit":10}`), "read_file"),
+			anthropic.NewToolUseBlock("t2", json.RawMessage(`{"path":"b.go"}`), "read_file"),
+		),
+		anthropic.NewUserMessage(
+			anthropic.NewToolResultBlock("t1", "package a", false),
+			anthropic.NewToolResultBlock("t2", `{"code":"ERR_NOT_FOUND"}`, true),
+		),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("a.go is package a; b.go is missing.")),
+	}
+}
+
+func TestHistory_RoundTripsAllBlocks(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "conversation.json")
+	in := fullConversation()
+	if err := memory.SaveHistory(p, in); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	out, err := memory.LoadHistory(p)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// Wire form must be equivalent after the round trip (tool inputs decode as maps,
+	// so compare decoded JSON rather than bytes).
+	want, _ := json.Marshal(in)
+	got, _ := json.Marshal(out)
+	var wantV, gotV any
+	_ = json.Unmarshal(want, &wantV)
+	_ = json.Unmarshal(got, &gotV)
+	if !reflect.DeepEqual(gotV, wantV) {
+		t.Fatalf("round trip mismatch:\n got %s\nwant %s", got, want)
+	}
+
+	asst := out[1].Content
+	if asst[0].OfThinking == nil || asst[0].OfThinking.Signature != "sig-123" || asst[1].OfRedactedThinking == nil {
+		t.Errorf("thinking blocks lost: %+v", asst[:2])
+	}
+	if tu := asst[3].OfToolUse; tu == nil || tu.ID != "t1" || tu.Name != "read_file" {
+		t.Errorf("tool_use lost: %+v", asst[3])
+	}
+	res := out[2].Content
+	if tr := res[1].OfToolResult; tr == nil || tr.ToolUseID != "t2" || !tr.IsError.Value {
+		t.Errorf("tool_result is_error lost: %+v", res[1])
+	}
+
+	groups := windowing.GroupBlocks(out)
+	if len(groups) != 3 || groups[1].Kind != windowing.GroupPair {
+		t.Errorf("restored history should keep the tool pair: %+v", groups)
+	}
+}
+
+func TestHistory_WritesVersionedEnvelope(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "conversation.json")
+	if err := memory.SaveHistory(p, fullConversation()); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	b, _ := os.ReadFile(p)
+	var f struct {
+		Version  int               `json:"version"`
+		Messages []json.RawMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(b, &f); err != nil || f.Version != memory.HistoryVersion || len(f.Messages) != 4 {
+		t.Fatalf("unexpected file: version=%d messages=%d err=%v", f.Version, len(f.Messages), err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(p)); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestHistory_MigratesLegacyTextOnly(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "conversation.json")
+	legacy := []memory.Message{{Role: "user", Text: "hi"}, {Role: "assistant", Text: "hello"}}
+	if err := memory.SaveConversation(p, legacy); err != nil {
+		t.Fatalf("prep: %v", err)
+	}
+
+	out, err := memory.LoadHistory(p)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(out) != 2 || out[0].Role != anthropic.MessageParamRoleUser || out[1].Role != anthropic.MessageParamRoleAssistant {
+		t.Fatalf("unexpected migrated roles: %+v", out)
+	}
+	if out[0].Content[0].OfText.Text != "hi" || out[1].Content[0].OfText.Text != "hello" {
+		t.Fatalf("unexpected migrated text: %+v", out)
+	}
+
+	// Saving upgrades the file to the current format.
+	if err := memory.SaveHistory(p, out); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if b, _ := os.ReadFile(p); !strings.Contains(string(b), fmt.Sprintf(`"version": %d`, memory.HistoryVersion)) {
+		t.Fatalf("expected upgraded file, got %s", b)
+	}
+}
+
+func TestHistory_BrokenPairsReturnValidPrefix(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "conversation.json")
+	conv := fullConversation()[:2] // tool_use without its tool_result
+	if err := memory.SaveHistory(p, conv); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	out, err := memory.LoadHistory(p)
+	if !errors.Is(err, memory.ErrBrokenPairs) {
+		t.Fatalf("expected ErrBrokenPairs, got %v", err)
+	}
+	if len(out) != 1 || out[0].Role != anthropic.MessageParamRoleUser {
+		t.Fatalf("expected only the leading user message, got %d messages", len(out))
+	}
+}
+
+func TestHistory_RejectsUnknownVersion(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "conversation.json")
+	if err := os.WriteFile(p, []byte(`{"version":99,"messages":[]}`), 0o644); err != nil {
+		t.Fatalf("prep: %v", err)
+	}
+	if _, err := memory.LoadHistory(p); err == nil || !strings.Contains(err.Error(), "unsupported version") {
+		t.Fatalf("expected unsupported version error, got %v", err)
+	}
+}
+
+func TestHistory_LoadMissing_ReturnsNil(t *testing.T) {
+	out, err := memory.LoadHistory(filepath.Join(t.TempDir(), "none.json"))
+	if err != nil || out != nil {
+		t.Fatalf("want nil, nil; got %v, %v", out, err)
+	}
+}
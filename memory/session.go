@@ -0,0 +1,418 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// SessionMeta describes a named session.
+type SessionMeta struct {
+	Name         string    `json:"name"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Model        string    `json:"model,omitempty"` // model used for the latest turn
+	Turns        int       `json:"turns"`
+	InputTokens  int64     `json:"input_tokens"`  // cumulative across turns
+	OutputTokens int64     `json:"output_tokens"` // cumulative across turns
+}
+
+// Session is a named conversation and its metadata.
+type Session struct {
+	Meta     SessionMeta
+	Turns    []TurnRecord // one per user turn, in order
+	Messages []anthropic.MessageParam
+}
+
+// TurnRecord marks where a user turn starts in the message history.
+type TurnRecord struct {
+	ID           string    `json:"id"`    // runner turn_id; "legacy-N" for turns derived from older files
+	Start        int       `json:"start"` // index of the turn's user message
+	At           time.Time `json:"at,omitzero"`
+	InputTokens  int64     `json:"input_tokens,omitempty"`
+	OutputTokens int64     `json:"output_tokens,omitempty"`
+	Pinned       bool      `json:"pinned,omitempty"` // the opening user message is always sent
+}
+
+// BeginTurn records a new turn starting at the end of the current history; append
+// the user message afterwards.
+func (s *Session) BeginTurn(id string) {
+	s.Turns = append(s.Turns, TurnRecord{ID: id, Start: len(s.Messages), At: time.Now().UTC()})
+	s.Meta.Turns = len(s.Turns)
+}
+
+// AddUsage attributes model usage to the latest turn and the session totals.
+func (s *Session) AddUsage(model string, inputTokens, outputTokens int64) {
+	if model != "" {
+		s.Meta.Model = model
+	}
+	s.Meta.InputTokens += inputTokens
+	s.Meta.OutputTokens += outputTokens
+	if n := len(s.Turns); n > 0 {
+		s.Turns[n-1].InputTokens += inputTokens
+		s.Turns[n-1].OutputTokens += outputTokens
+	}
+}
+
+// Truncate keeps the first n turns (0 clears the history) and recomputes the turn
+// count. Token totals are reduced by the usage recorded on the dropped turns.
+func (s *Session) Truncate(n int) error {
+	if n < 0 || n > len(s.Turns) {
+		return fmt.Errorf("turn %d out of range (session has %d turns)", n, len(s.Turns))
+	}
+	if n == len(s.Turns) {
+		return nil
+	}
+	cut := s.Turns[n].Start
+	msgs := s.Messages[:cut:cut]
+	if k := validPairPrefix(msgs); k < len(msgs) {
+		return fmt.Errorf("%w: turn %d boundary splits a tool pair at message %d", ErrBrokenPairs, n, k)
+	}
+	for _, t := range s.Turns[n:] {
+		s.Meta.InputTokens -= t.InputTokens
+		s.Meta.OutputTokens -= t.OutputTokens
+	}
+	s.Messages = msgs
+	s.Turns = s.Turns[:n:n]
+	s.Meta.Turns = n
+	return nil
+}
+
+// Pin marks turn n (1-based) as pinned, or unpins it, so its opening user message is
+// always sent however old it is.
+func (s *Session) Pin(n int, pinned bool) error {
+	if n < 1 || n > len(s.Turns) {
+		return fmt.Errorf("turn %d out of range (session has %d turns)", n, len(s.Turns))
+	}
+	s.Turns[n-1].Pinned = pinned
+	return nil
+}
+
+// PinnedMessages returns the message indices of pinned turns' opening user messages.
+func (s *Session) PinnedMessages() []int {
+	var out []int
+	for _, t := range s.Turns {
+		if t.Pinned && t.Start < len(s.Messages) {
+			out = append(out, t.Start)
+		}
+	}
+	return out
+}
+
+// Prompt returns the text of turn i's opening user message (0-based).
+func (s *Session) Prompt(i int) string {
+	if i < 0 || i >= len(s.Turns) || s.Turns[i].Start >= len(s.Messages) {
+		return ""
+	}
+	var parts []string
+	for _, b := range s.Messages[s.Turns[i].Start].Content {
+		if b.OfText != nil {
+			parts = append(parts, b.OfText.Text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// deriveTurns reconstructs turn records for histories saved before version 3: each
+// user message with text and no tool_result blocks starts a turn.
+func deriveTurns(msgs []anthropic.MessageParam) []TurnRecord {
+	var turns []TurnRecord
+	for i, m := range msgs {
+		if m.Role == anthropic.MessageParamRoleUser && !hasToolBlocks(m) {
+			turns = append(turns, TurnRecord{ID: fmt.Sprintf("legacy-%d", len(turns)+1), Start: i})
+		}
+	}
+	return turns
+}
+
+var (
+	// ErrSessionNotFound is returned for operations on a missing session.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionExists is returned when creating or renaming onto an existing name.
+	ErrSessionExists = errors.New("session already exists")
+)
+
+var sessionNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidateSessionName reports whether name is usable as a session name
+// (letters, digits, '.', '_', '-'; up to 64 characters; no leading punctuation).
+func ValidateSessionName(name string) error {
+	if !sessionNameRe.MatchString(name) {
+		return fmt.Errorf("invalid session name %q: use letters, digits, '.', '_' or '-' (max 64, starting with a letter or digit)", name)
+	}
+	return nil
+}
+
+// Store keeps sessions as {Dir}/{name}.json (history format with metadata) and
+// remembers the active session in {Dir}/current.
+type Store struct {
+	Dir string
+}
+
+// NewStore returns a store rooted at dir; the directory is created on first write.
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.Dir, name+".json")
+}
+
+// Exists reports whether a session named name is stored.
+func (s *Store) Exists(name string) bool {
+	_, err := os.Stat(s.path(name))
+	return err == nil
+}
+
+// Create saves a new empty session.
+func (s *Store) Create(name string) (*Session, error) {
+	if err := ValidateSessionName(name); err != nil {
+		return nil, err
+	}
+	if s.Exists(name) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionExists, name)
+	}
+	now := time.Now().UTC()
+	sess := &Session{Meta: SessionMeta{Name: name, CreatedAt: now, UpdatedAt: now}}
+	if err := s.write(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Open loads a session. Like LoadHistory, a history that breaks tool pair
+// invariants is truncated to its valid prefix and reported with ErrBrokenPairs.
+func (s *Store) Open(name string) (*Session, error) {
+	if err := ValidateSessionName(name); err != nil {
+		return nil, err
+	}
+	f, err := readHistoryFile(s.path(name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+		}
+		return nil, fmt.Errorf("session %s: %w", name, err)
+	}
+	sess := &Session{Turns: f.Turns, Messages: f.Messages}
+	if f.Meta != nil {
+		sess.Meta = *f.Meta
+	}
+	sess.Meta.Name = name // the file name is authoritative
+	msgs, err := checkPairs(sess.Messages)
+	sess.Messages = msgs
+	// Drop turn records that start beyond a truncated history.
+	for len(sess.Turns) > 0 && sess.Turns[len(sess.Turns)-1].Start >= len(msgs) {
+		sess.Turns = sess.Turns[:len(sess.Turns)-1]
+	}
+	sess.Meta.Turns = len(sess.Turns)
+	if err != nil {
+		return sess, fmt.Errorf("session %s: %w", name, err)
+	}
+	return sess, nil
+}
+
+// Save writes sess, stamping UpdatedAt.
+func (s *Store) Save(sess *Session) error {
+	if err := ValidateSessionName(sess.Meta.Name); err != nil {
+		return err
+	}
+	sess.Meta.UpdatedAt = time.Now().UTC()
+	if sess.Meta.CreatedAt.IsZero() {
+		sess.Meta.CreatedAt = sess.Meta.UpdatedAt
+	}
+	return s.write(sess)
+}
+
+func (s *Store) write(sess *Session) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	meta := sess.Meta
+	return writeHistoryFile(s.path(sess.Meta.Name), historyFile{Meta: &meta, Turns: sess.Turns, Messages: sess.Messages})
+}
+
+// List returns session metadata, most recently updated first. Unreadable files are skipped.
+func (s *Store) List() ([]SessionMeta, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []SessionMeta
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if e.IsDir() || !ok || ValidateSessionName(name) != nil {
+			continue
+		}
+		f, err := readHistoryFile(s.path(name))
+		if err != nil {
+			continue
+		}
+		meta := SessionMeta{Name: name}
+		if f.Meta != nil {
+			meta = *f.Meta
+			meta.Name = name
+		}
+		out = append(out, meta)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].UpdatedAt.Equal(out[j].UpdatedAt) {
+			return out[i].UpdatedAt.After(out[j].UpdatedAt)
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+// Rename moves a session to a new name, keeping the current pointer in step.
+func (s *Store) Rename(oldName, newName string) error {
+	if err := ValidateSessionName(newName); err != nil {
+		return err
+	}
+	sess, err := s.Open(oldName)
+	if err != nil && !errors.Is(err, ErrBrokenPairs) {
+		return err
+	}
+	if s.Exists(newName) {
+		return fmt.Errorf("%w: %s", ErrSessionExists, newName)
+	}
+	// Rewrite rather than rename the file so the embedded name stays consistent.
+	sess.Meta.Name = newName
+	if err := s.write(sess); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(oldName)); err != nil {
+		return err
+	}
+	if cur, _ := s.Current(); cur == oldName {
+		return s.SetCurrent(newName)
+	}
+	return nil
+}
+
+// Delete removes a session and clears the current pointer if it referred to it.
+func (s *Store) Delete(name string) error {
+	if err := ValidateSessionName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(name)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrSessionNotFound, name)
+		}
+		return err
+	}
+	if cur, _ := s.Current(); cur == name {
+		if err := os.Remove(filepath.Join(s.Dir, "current")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Current returns the active session name, or "" when none is set.
+func (s *Store) Current() (string, error) {
+	b, err := os.ReadFile(filepath.Join(s.Dir, "current"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// SetCurrent records name as the active session.
+func (s *Store) SetCurrent(name string) error {
+	if err := ValidateSessionName(name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.Dir, "current"), []byte(name+"\n"), 0o644)
+}
+
+// Import creates a session from a standalone history file such as the legacy
+// .agent/conversation.json. The source file is left untouched.
+func (s *Store) Import(name, path string) (*Session, error) {
+	msgs, err := LoadHistory(path)
+	if err != nil && !errors.Is(err, ErrBrokenPairs) {
+		return nil, err
+	}
+	sess, err := s.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	sess.Messages = msgs
+	sess.Turns = deriveTurns(msgs)
+	sess.Meta.Turns = len(sess.Turns)
+	if err := s.Save(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Fork copies the first turn turns of src into a new session dst; src is not modified.
+func (s *Store) Fork(src string, turn int, dst string) (*Session, error) {
+	if err := ValidateSessionName(dst); err != nil {
+		return nil, err
+	}
+	sess, err := s.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	if s.Exists(dst) {
+		return nil, fmt.Errorf("%w: %s", ErrSessionExists, dst)
+	}
+	if err := sess.Truncate(turn); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	sess.Meta.Name = dst
+	sess.Meta.CreatedAt = now
+	if err := s.Save(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Rewind truncates a session to its first turn turns. The full history is first
+// copied to a backup session, whose name is returned, so nothing is lost.
+func (s *Store) Rewind(name string, turn int) (string, error) {
+	sess, err := s.Open(name)
+	if err != nil {
+		return "", err
+	}
+	if turn < 0 || turn > len(sess.Turns) {
+		return "", fmt.Errorf("turn %d out of range (session has %d turns)", turn, len(sess.Turns))
+	}
+	backup := backupName(name, time.Now())
+	if _, err := s.Fork(name, len(sess.Turns), backup); err != nil {
+		return "", fmt.Errorf("backup before rewind: %w", err)
+	}
+	if err := sess.Truncate(turn); err != nil {
+		return "", err
+	}
+	if err := s.Save(sess); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// backupName derives a valid, timestamped session name from name.
+func backupName(name string, t time.Time) string {
+	suffix := ".bak-" + t.Format("20060102-150405")
+	if max := 64 - len(suffix); len(name) > max {
+		name = name[:max]
+	}
+	return name + suffix
+}
@@ -0,0 +1,313 @@
+package memory_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/windowing"
+	"github.com/petasbytes/go-agent/memory"
+)
+
+func TestStore_CreateSaveOpen_RoundTripsMeta(t *testing.T) {
+	store := memory.NewStore(filepath.Join(t.TempDir(), "sessions"))
+	sess, err := store.Create("work")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	sess.Messages = fullConversation()
+	sess.Meta.Turns = 1
+	sess.Meta.Model = "claude-test"
+	sess.Meta.InputTokens, sess.Meta.OutputTokens = 120, 45
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	got, err := store.Open("work")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	m := got.Meta
+	if m.Name != "work" || m.Turns != 1 || m.Model != "claude-test" || m.InputTokens != 120 || m.OutputTokens != 45 {
+		t.Fatalf("unexpected meta: %+v", m)
+	}
+	if m.CreatedAt.IsZero() || m.UpdatedAt.Before(m.CreatedAt) {
+		t.Errorf("timestamps not maintained: %+v", m)
+	}
+	if len(got.Messages) != 4 || got.Messages[1].Content[3].OfToolUse == nil {
+		t.Fatalf("messages not restored: %d", len(got.Messages))
+	}
+
+	// Session files are history files too.
+	if msgs, err := memory.LoadHistory(filepath.Join(store.Dir, "work.json")); err != nil || len(msgs) != 4 {
+		t.Fatalf("LoadHistory on a session file: %d, %v", len(msgs), err)
+	}
+}
+
+func TestStore_CreateRejectsDuplicatesAndBadNames(t *testing.T) {
+	store := memory.NewStore(t.TempDir())
+	if _, err := store.Create("a"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := store.Create("a"); !errors.Is(err, memory.ErrSessionExists) {
+		t.Fatalf("expected ErrSessionExists, got %v", err)
+	}
+	for _, bad := range []string{"", "../x", ".hidden", "a/b", "has space"} {
+		if _, err := store.Create(bad); err == nil {
+			t.Errorf("expected invalid name error for %q", bad)
+		}
+	}
+	if _, err := store.Open("missing"); !errors.Is(err, memory.ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestStore_ListNewestFirst(t *testing.T) {
+	store := memory.NewStore(t.TempDir())
+	for _, name := range []string{"old", "new"} {
+		if _, err := store.Create(name); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Touch "old" so it becomes the most recent.
+	sess, _ := store.Open("old")
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := store.SetCurrent("old"); err != nil {
+		t.Fatalf("set current: %v", err)
+	}
+
+	metas, err := store.List()
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(metas) != 2 || metas[0].Name != "old" || metas[1].Name != "new" {
+		t.Fatalf("unexpected order: %+v", metas)
+	}
+}
+
+func TestStore_RenameAndDeleteFollowCurrent(t *testing.T) {
+	store := memory.NewStore(t.TempDir())
+	if _, err := store.Create("a"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := store.Create("b"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_ = store.SetCurrent("a")
+
+	if err := store.Rename("a", "b"); !errors.Is(err, memory.ErrSessionExists) {
+		t.Fatalf("rename onto existing: got %v", err)
+	}
+	if err := store.Rename("a", "c"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if cur, _ := store.Current(); cur != "c" {
+		t.Fatalf("current should follow rename, got %q", cur)
+	}
+	if store.Exists("a") || !store.Exists("c") {
+		t.Fatal("rename did not move the session")
+	}
+	if got, _ := store.Open("c"); got.Meta.Name != "c" {
+		t.Fatalf("embedded name not updated: %+v", got.Meta)
+	}
+
+	if err := store.Delete("c"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if cur, _ := store.Current(); cur != "" {
+		t.Fatalf("current should be cleared, got %q", cur)
+	}
+	if err := store.Delete("c"); !errors.Is(err, memory.ErrSessionNotFound) {
+		t.Fatalf("second delete: got %v", err)
+	}
+}
+
+func TestStore_ImportLegacyConversation(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "conversation.json")
+	if err := memory.SaveConversation(legacy, []memory.Message{{Role: "user", Text: "hi"}, {Role: "assistant", Text: "hello"}}); err != nil {
+		t.Fatalf("prep: %v", err)
+	}
+	store := memory.NewStore(filepath.Join(dir, "sessions"))
+	sess, err := store.Import("default", legacy)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if sess.Meta.Turns != 1 || len(sess.Messages) != 2 || sess.Messages[1].Role != anthropic.MessageParamRoleAssistant {
+		t.Fatalf("unexpected imported session: %+v", sess.Meta)
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		t.Fatalf("legacy file should be left in place: %v", err)
+	}
+}
+
+// threeTurnSession records turns as cmd/agent does: the second turn uses a tool pair.
+func threeTurnSession(t *testing.T, store *memory.Store) *memory.Session {
+	t.Helper()
+	sess, err := store.Create("main")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	turn := func(id string, msgs []anthropic.MessageParam, in, out int64) {
+		sess.BeginTurn(id)
+		sess.Messages = append(sess.Messages, msgs...)
+		sess.AddUsage("claude-test", in, out)
+	}
+	turn("turn-1", []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("hello")),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("hi")),
+	}, 10, 1)
+	turn("turn-2", fullConversation(), 100, 20)
+	turn("turn-3", []anthropic.MessageParam{
+		anthropic.NewUserMessage(anthropic.NewTextBlock("thanks")),
+		anthropic.NewAssistantMessage(anthropic.NewTextBlock("welcome")),
+	}, 5, 2)
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	return sess
+}
+
+func TestSession_TurnsPersistWithIDsAndUsage(t *testing.T) {
+	store := memory.NewStore(t.TempDir())
+	threeTurnSession(t, store)
+
+	got, err := store.Open("main")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if len(got.Turns) != 3 || got.Meta.Turns != 3 {
+		t.Fatalf("want 3 turns, got %d (meta %d)", len(got.Turns), got.Meta.Turns)
+	}
+	if got.Turns[1].ID != "turn-2" || got.Turns[1].Start != 2 || got.Turns[1].InputTokens != 100 {
+		t.Errorf("unexpected turn record: %+v", got.Turns[1])
+	}
+	if got.Prompt(2) != "thanks" {
+		t.Errorf("Prompt(2) = %q", got.Prompt(2))
+	}
+	if got.Meta.InputTokens != 115 || got.Meta.OutputTokens != 23 {
+		t.Errorf("unexpected totals: %+v", got.Meta)
+	}
+}
+
+func TestSession_PinnedTurnsPersist(t *testing.T) {
+	store := memory.NewStore(t.TempDir())
+	sess := threeTurnSession(t, store)
+	if err := sess.Pin(3, true); err != nil {
+		t.Fatalf("pin: %v", err)
+	}
+	if err := sess.Pin(4, true); err == nil {
+		t.Fatal("expected out-of-range error")
+	}
+	if err := store.Save(sess); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	got, err := store.Open("main")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	pinned := got.PinnedMessages()
+	if len(pinned) != 1 || pinned[0] != got.Turns[2].Start || !got.Turns[2].Pinned {
+		t.Fatalf("pinned messages = %v, turns %+v", pinned, got.Turns)
+	}
+	if err := got.Pin(3, false); err != nil || len(got.PinnedMessages()) != 0 {
+		t.Fatalf("unpin: %v, %v", err, got.PinnedMessages())
+	}
+}
+
+func TestStore_ForkKeepsSourceIntact(t *testing.T) {
+	store := memory.NewStore(t.TempDir())
+	src := threeTurnSession(t, store)
+
+	fork, err := store.Fork("main", 2, "alt")
+	if err != nil {
+		t.Fatalf("fork: %v", err)
+	}
+	if len(fork.Turns) != 2 || len(fork.Messages) != 6 {
+		t.Fatalf("fork should keep turns 1-2 (6 messages), got %d turns, %d messages", len(fork.Turns), len(fork.Messages))
+	}
+	if groups := windowing.GroupBlocks(fork.Messages); groups[3].Kind != windowing.GroupPair {
+		t.Errorf("tool pair should survive the fork: %+v", groups)
+	}
+	if fork.Meta.InputTokens != 110 || fork.Meta.OutputTokens != 21 {
+		t.Errorf("fork totals should exclude dropped turns: %+v", fork.Meta)
+	}
+
+	orig, err := store.Open("main")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if len(orig.Turns) != 3 || len(orig.Messages) != len(src.Messages) {
+		t.Fatalf("source modified by fork: %d turns, %d messages", len(orig.Turns), len(orig.Messages))
+	}
+	if _, err := store.Fork("main", 4, "bad"); err == nil {
+		t.Fatal("expected out-of-range error")
+	}
+}
+
+func TestStore_RewindBacksUpFullHistory(t *testing.T) {
+	store := memory.NewStore(t.TempDir())
+	threeTurnSession(t, store)
+
+	backup, err := store.Rewind("main", 1)
+	if err != nil {
+		t.Fatalf("rewind: %v", err)
+	}
+	got, _ := store.Open("main")
+	if len(got.Turns) != 1 || len(got.Messages) != 2 || got.Meta.Turns != 1 {
+		t.Fatalf("rewind should keep turn 1 only: %d turns, %d messages", len(got.Turns), len(got.Messages))
+	}
+	saved, err := store.Open(backup)
+	if err != nil {
+		t.Fatalf("open backup %s: %v", backup, err)
+	}
+	if len(saved.Turns) != 3 || len(saved.Messages) != 8 {
+		t.Fatalf("backup incomplete: %d turns, %d messages", len(saved.Turns), len(saved.Messages))
+	}
+
+	// New turns continue after the rewind point.
+	got.BeginTurn("turn-4")
+	if got.Turns[1].Start != 2 {
+		t.Fatalf("new turn should start at message 2, got %d", got.Turns[1].Start)
+	}
+}
+
+func TestSession_TruncateRejectsSplitPair(t *testing.T) {
+	sess := &memory.Session{Messages: fullConversation()}
+	// A bogus turn boundary between tool_use and tool_result.
+	sess.Turns = []memory.TurnRecord{{ID: "a", Start: 0}, {ID: "b", Start: 2}}
+	if err := sess.Truncate(1); !errors.Is(err, memory.ErrBrokenPairs) {
+		t.Fatalf("expected ErrBrokenPairs, got %v", err)
+	}
+	if len(sess.Messages) != 4 {
+		t.Fatal("failed truncate must not modify the session")
+	}
+}
+
+func TestStore_OpenDerivesTurnsForVersion2(t *testing.T) {
+	dir := t.TempDir()
+	v2 := `{"version":2,"meta":{"name":"old","turns":2},"messages":[
+		{"role":"user","content":[{"type":"text","text":"one"}]},
+		{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"list_files","input":{}}]},
+		{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":[{"type":"text","text":"[]"}]}]},
+		{"role":"assistant","content":[{"type":"text","text":"empty"}]},
+		{"role":"user","content":[{"type":"text","text":"two"}]},
+		{"role":"assistant","content":[{"type":"text","text":"ok"}]}]}`
+	if err := os.WriteFile(filepath.Join(dir, "old.json"), []byte(v2), 0o644); err != nil {
+		t.Fatalf("prep: %v", err)
+	}
+	sess, err := memory.NewStore(dir).Open("old")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if len(sess.Turns) != 2 || sess.Turns[0].Start != 0 || sess.Turns[1].Start != 4 || sess.Turns[1].ID != "legacy-2" {
+		t.Fatalf("unexpected derived turns: %+v", sess.Turns)
+	}
+}
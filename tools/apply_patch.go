@@ -0,0 +1,210 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/petasbytes/go-agent/internal/fsops"
+	"github.com/petasbytes/go-agent/internal/patch"
+)
+
+type ApplyPatchInput struct {
+	Patch string `json:"patch" jsonschema:"minLength=1" jsonschema_description:"Unified diff (diff -u or git diff format) with paths relative to the workspace root. May change several files, and create (--- /dev/null) or delete (+++ /dev/null) files."`
+}
+
+var ApplyPatchDefinition = ToolDefinition{
+	Name: "apply_patch",
+	Description: `Apply a unified diff to files within the workspace. Prefer this over edit_file for multi-line or multi-hunk changes.
+
+Each hunk is located by its context and removed lines: at the line in its @@ header, else at the nearest offset, else ignoring up to 2 context lines at each end (fuzz). The patch is all-or-nothing: if any hunk does not apply, no file is changed and a JSON report lists every hunk with the line it was expected at and the first line that did not match. On success, a summary lists each file with any offset or fuzz used.`,
+	InputSchema: ApplyPatchInputSchema,
+	Handler:     ApplyPatch,
+}
+
+var ApplyPatchInputSchema = GenerateSchema[ApplyPatchInput]()
+
+// PatchError is returned when a patch does not apply. It marshals to compact JSON
+// like safety.ToolError, with a result for every hunk (hunk 0 for file-level errors).
+type PatchError struct {
+	Code    string             `json:"code"`
+	Message string             `json:"message"`
+	Hunks   []patch.HunkResult `json:"hunks"`
+}
+
+func (e PatchError) Error() string {
+	b, _ := json.Marshal(e)
+	return string(b)
+}
+
+// patchedFile tracks one path while a patch is applied in memory.
+type patchedFile struct {
+	content, original string
+	exists, existed   bool
+}
+
+// ApplyPatch parses the diff and applies every hunk in memory against the current
+// files read via fsops. Only when all hunks apply, and every path passes the write
+// policy, are the files written through fsops.WriteFile (or removed); if a write
+// still fails, files already written are restored. ctx is checked between files and
+// once more before the first write; after that the writes run to completion.
+func ApplyPatch(ctx context.Context, input json.RawMessage) (string, error) {
+	var in ApplyPatchInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return "", err
+	}
+	files, err := patch.Parse(in.Patch)
+	if err != nil {
+		return "", err
+	}
+
+	state := map[string]*patchedFile{}
+	var order []string // paths in first-seen order
+	load := func(p string) (*patchedFile, error) {
+		if s, ok := state[p]; ok {
+			return s, nil
+		}
+		s := &patchedFile{}
+		content, err := fsops.ReadFile(p)
+		switch {
+		case err == nil:
+			s.content, s.original, s.exists, s.existed = content, content, true, true
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, err
+		}
+		state[p] = s
+		order = append(order, p)
+		return s, nil
+	}
+
+	var report []patch.HunkResult
+	var summary []string
+	failed, total := 0, 0
+	// A file-level error fails all of the file's hunks.
+	fileError := func(f patch.File, msg string) {
+		report = append(report, patch.HunkResult{Path: f.Path(), Status: "failed", Error: msg})
+		failed += len(f.Hunks)
+	}
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		total += len(f.Hunks)
+		var src, dst *patchedFile // nil for /dev/null
+		if f.OldPath != patch.DevNull {
+			if src, err = load(f.OldPath); err != nil {
+				return "", err
+			}
+		}
+		if f.NewPath != patch.DevNull {
+			if dst, err = load(f.NewPath); err != nil {
+				return "", err
+			}
+		}
+		verb := "patched"
+		switch {
+		case src == nil:
+			verb = "created"
+			if dst.exists {
+				fileError(f, "file already exists; diff it against the current content instead of /dev/null")
+				continue
+			}
+		case !src.exists:
+			fileError(f, fmt.Sprintf("%s does not exist", f.OldPath))
+			continue
+		case dst == nil:
+			verb = "deleted"
+		case src != dst:
+			verb = "renamed " + f.OldPath + " ->"
+			if dst.exists {
+				fileError(f, "rename target already exists")
+				continue
+			}
+		}
+
+		var content string
+		if src != nil {
+			content = src.content
+		}
+		out, results, ok := f.Apply(content)
+		report = append(report, results...)
+		if !ok {
+			for _, r := range results {
+				if r.Status != "applied" {
+					failed++
+				}
+			}
+			continue
+		}
+		if dst == nil && out != "" {
+			fileError(f, "file is not empty after the patch; a deletion must remove every line")
+			continue
+		}
+		if src != nil {
+			src.content, src.exists = "", false
+		}
+		if dst != nil {
+			dst.content, dst.exists = out, true
+		}
+		summary = append(summary, summarize(verb, f.Path(), results))
+	}
+	if failed > 0 {
+		return "", PatchError{
+			Code:    "ERR_PATCH_FAILED",
+			Message: fmt.Sprintf("%d of %d hunks did not apply; no files were changed", failed, total),
+			Hunks:   report,
+		}
+	}
+
+	// Refuse up front if any path is outside the write policy, so nothing is half-applied.
+	var changed []string
+	for _, p := range order {
+		if s := state[p]; s.exists != s.existed || s.content != s.original {
+			if err := fsops.CheckWrite(p); err != nil {
+				return "", err
+			}
+			changed = append(changed, p)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	for i, p := range changed {
+		if err := writeState(p, state[p].content, state[p].exists); err != nil {
+			for _, done := range changed[:i] {
+				_ = writeState(done, state[done].original, state[done].existed)
+			}
+			return "", err
+		}
+	}
+	return strings.Join(summary, "\n") + "\n", nil
+}
+
+// writeState writes content to p, or removes p when it should not exist.
+func writeState(p, content string, exists bool) error {
+	if !exists {
+		if err := fsops.RemoveFile(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return fsops.WriteFile(p, content)
+}
+
+// summarize describes one applied file, noting hunks that needed an offset or fuzz.
+func summarize(verb, p string, results []patch.HunkResult) string {
+	noun := "hunks"
+	if len(results) == 1 {
+		noun = "hunk"
+	}
+	s := fmt.Sprintf("%s %s: %d %s applied", verb, p, len(results), noun)
+	for _, r := range results {
+		if r.Offset != 0 || r.Fuzz != 0 {
+			s += fmt.Sprintf("; hunk %d at line %d (offset %+d, fuzz %d)", r.Hunk, r.Line, r.Offset, r.Fuzz)
+		}
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/petasbytes/go-agent/internal/safety"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+func applyPatch(t *testing.T, diff string) (string, error) {
+	t.Helper()
+	b, _ := json.Marshal(tools.ApplyPatchInput{Patch: diff})
+	return tools.ApplyPatchDefinition.Handler(context.Background(), b)
+}
+
+func readTree(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(sharedDir, rel(t, name)))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(b)
+}
+
+func TestApplyPatch_MultiFileAllApplied(t *testing.T) {
+	writeTree(t, map[string]string{
+		"main.go": "package main\n\n// added upstream\n\nfunc a() {\n\treturn\n}\n\nfunc b() {\n\treturn\n}\n",
+		"old.txt": "bye\n",
+	})
+	p := filepath.ToSlash(rel(t))
+	diff := `diff --git a/` + p + `/main.go b/` + p + `/main.go
+--- a/` + p + `/main.go
++++ b/` + p + `/main.go
+@@ -5,3 +5,4 @@
+ func b() {
++	log()
+ 	return
+ }
+--- /dev/null
++++ b/` + p + `/new.txt
+@@ -0,0 +1 @@
++hello
+--- a/` + p + `/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+	out, err := applyPatch(t, diff)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := "patched " + p + "/main.go: 1 hunk applied; hunk 1 at line 9 (offset +4, fuzz 0)\n" +
+		"created " + p + "/new.txt: 1 hunk applied\n" +
+		"deleted " + p + "/old.txt: 1 hunk applied\n"
+	if out != want {
+		t.Fatalf("summary:\n%s\nwant:\n%s", out, want)
+	}
+	// Only the hunk's own occurrence of the repeated snippet changes.
+	if got := readTree(t, "main.go"); strings.Count(got, "\tlog()\n") != 1 || !strings.Contains(got, "func b() {\n\tlog()\n") {
+		t.Fatalf("main.go:\n%s", got)
+	}
+	if readTree(t, "new.txt") != "hello\n" {
+		t.Fatal("new.txt not created")
+	}
+	if _, err := os.Stat(filepath.Join(sharedDir, rel(t, "old.txt"))); !os.IsNotExist(err) {
+		t.Fatalf("old.txt should be deleted, stat err = %v", err)
+	}
+}
+
+func TestApplyPatch_FailedHunkChangesNothing(t *testing.T) {
+	writeTree(t, map[string]string{"a.txt": "one\ntwo\n", "b.txt": "three\nfour\n"})
+	p := filepath.ToSlash(rel(t))
+	diff := "--- a/" + p + "/a.txt\n+++ b/" + p + "/a.txt\n@@ -1,2 +1,2 @@\n-one\n+ONE\n two\n" +
+		"--- a/" + p + "/b.txt\n+++ b/" + p + "/b.txt\n@@ -1,2 +1,2 @@\n three\n-for\n+FOUR\n"
+	_, err := applyPatch(t, diff)
+	var pe tools.PatchError
+	if !errors.As(err, &pe) || pe.Code != "ERR_PATCH_FAILED" || len(pe.Hunks) != 2 {
+		t.Fatalf("want a PatchError reporting both hunks, got %v", err)
+	}
+	if h := pe.Hunks[1]; h.Status != "failed" || h.Path != p+"/b.txt" || h.Want != "for" || h.Got != "four" {
+		t.Fatalf("unexpected report for the failed hunk: %+v", h)
+	}
+	if !strings.Contains(err.Error(), `"message":"1 of 2 hunks did not apply; no files were changed"`) {
+		t.Fatalf("report should be compact JSON, got %s", err.Error())
+	}
+	if readTree(t, "a.txt") != "one\ntwo\n" {
+		t.Fatal("a.txt changed despite the failed patch")
+	}
+}
+
+func TestApplyPatch_WritePolicyCheckedUpFront(t *testing.T) {
+	writeTree(t, map[string]string{"ok.txt": "a\n", "go.mod": "module x\n"})
+	p := filepath.ToSlash(rel(t))
+	diff := "--- a/" + p + "/ok.txt\n+++ b/" + p + "/ok.txt\n@@ -1 +1 @@\n-a\n+b\n" +
+		"--- a/" + p + "/go.mod\n+++ b/" + p + "/go.mod\n@@ -1 +1 @@\n-module x\n+module y\n"
+	_, err := applyPatch(t, diff)
+	var te safety.ToolError
+	if !errors.As(err, &te) || te.Code != "ERR_DENIED_WRITE" {
+		t.Fatalf("want ERR_DENIED_WRITE, got %v", err)
+	}
+	if readTree(t, "ok.txt") != "a\n" {
+		t.Fatal("ok.txt written although the patch was refused")
+	}
+}
@@ -1,19 +1,73 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/invopop/jsonschema"
 )
 
+// DefaultToolTimeout bounds a tool call whose definition sets no Timeout.
+const DefaultToolTimeout = 30 * time.Second
+
+// Handler runs a tool call. ctx carries the turn (see telemetry.TurnIDFromContext)
+// and is cancelled on interrupt or when the tool's timeout expires. The runner waits
+// for the handler to return, so it should return ctx.Err() promptly once ctx is done
+// and must not write after that.
+type Handler func(ctx context.Context, input json.RawMessage) (string, error)
+
 type ToolDefinition struct {
 	Name        string                         `json:"name"`
 	Description string                         `json:"description"`
 	InputSchema anthropic.ToolInputSchemaParam `json:"input_schema"`
-	Function    func(input json.RawMessage) (string, error)
+	// Handler runs the tool; when nil, Function is run through Adapt.
+	Handler Handler `json:"-"`
+	// Function is the older context-free form, kept for third-party tools.
+	Function func(input json.RawMessage) (string, error)
+	// ParallelSafe marks tools without side effects, which may run concurrently with
+	// each other when one message requests several calls.
+	ParallelSafe bool `json:"-"`
+	// Timeout bounds one call of Handler (0: DefaultToolTimeout; negative: none).
+	// Function tools cannot be interrupted and always run to completion.
+	Timeout time.Duration `json:"-"`
+}
+
+// Handle returns the tool's Handler, adapting Function when Handler is unset.
+func (d ToolDefinition) Handle() Handler {
+	if d.Handler != nil {
+		return d.Handler
+	}
+	return Adapt(d.Function)
+}
+
+// CallTimeout returns the effective timeout of one call; 0 means none, as for tools
+// with only a context-free Function.
+func (d ToolDefinition) CallTimeout() time.Duration {
+	switch {
+	case d.Handler == nil, d.Timeout < 0:
+		return 0
+	case d.Timeout == 0:
+		return DefaultToolTimeout
+	}
+	return d.Timeout
+}
+
+// Adapt turns a context-free tool function into a Handler. The function cannot be
+// interrupted, so the handler only declines to start once ctx is done.
+func Adapt(fn func(input json.RawMessage) (string, error)) Handler {
+	return func(ctx context.Context, input json.RawMessage) (string, error) {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return fn(input)
+	}
 }
 
+// GenerateSchema derives a tool input schema from T. Fields without omitempty are
+// required; `jsonschema` tags add enums and bounds (e.g. `jsonschema:"minimum=0"`),
+// and `jsonschema_description` tags describe fields. Unknown properties are rejected.
 func GenerateSchema[T any]() anthropic.ToolInputSchemaParam {
 	reflector := jsonschema.Reflector{
 		AllowAdditionalProperties: false,
@@ -22,6 +76,8 @@ func GenerateSchema[T any]() anthropic.ToolInputSchemaParam {
 	var v T
 	schema := reflector.Reflect(v)
 	return anthropic.ToolInputSchemaParam{
-		Properties: schema.Properties,
+		Properties:  schema.Properties,
+		Required:    schema.Required,
+		ExtraFields: map[string]any{"additionalProperties": false},
 	}
 }
@@ -0,0 +1,57 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/petasbytes/go-agent/tools"
+)
+
+func TestDefinition_HandleAdaptsFunction(t *testing.T) {
+	def := tools.ToolDefinition{Function: func(input json.RawMessage) (string, error) {
+		return "got " + string(input), nil
+	}}
+	out, err := def.Handle()(context.Background(), json.RawMessage(`{}`))
+	if err != nil || out != "got {}" {
+		t.Fatalf("got %q, %v", out, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := def.Handle()(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("adapted function should not start once ctx is done, got %v", err)
+	}
+
+	def.Handler = func(ctx context.Context, input json.RawMessage) (string, error) { return "handler", nil }
+	if out, _ := def.Handle()(context.Background(), nil); out != "handler" {
+		t.Fatalf("Handler should take precedence over Function, got %q", out)
+	}
+}
+
+func TestDefinition_CallTimeout(t *testing.T) {
+	cases := map[time.Duration]time.Duration{
+		0:               tools.DefaultToolTimeout,
+		-1:              0,
+		5 * time.Second: 5 * time.Second,
+	}
+	handler := func(context.Context, json.RawMessage) (string, error) { return "", nil }
+	for set, want := range cases {
+		if got := (tools.ToolDefinition{Timeout: set, Handler: handler}).CallTimeout(); got != want {
+			t.Errorf("Timeout %v: got %v want %v", set, got, want)
+		}
+	}
+	// The built-in file tools are context-aware, so the default timeout applies.
+	for _, def := range []tools.ToolDefinition{tools.ReadFileDefinition, tools.ListFilesDefinition, tools.EditFileDefinition, tools.ApplyPatchDefinition} {
+		if got := def.CallTimeout(); got != tools.DefaultToolTimeout {
+			t.Errorf("%s: got %v want %v", def.Name, got, tools.DefaultToolTimeout)
+		}
+	}
+	// Context-free functions cannot be interrupted, so no timeout applies to them.
+	fn := tools.ToolDefinition{Timeout: time.Second, Function: func(json.RawMessage) (string, error) { return "", nil }}
+	if got := fn.CallTimeout(); got != 0 {
+		t.Errorf("Function tool: got %v want 0", got)
+	}
+}
@@ -1,8 +1,15 @@
 // Package tools defines tool contracts and implementations.
 //
 // Includes:
-//   - ToolDefinition: name, description, JSON input schema, handler.
-//   - GenerateSchema[T](): derive JSON Schema from Go structs.
-//   - File tools: read_file, list_files (non-recursive), edit_file.
+//   - ToolDefinition: name, description, JSON input schema, a context-aware Handler
+//     (or a context-free Function run through Adapt), a per-call Timeout, and whether
+//     it is safe to run in parallel (read-only tools are; writes run serialized).
+//   - GenerateSchema[T](): derive JSON Schema from Go structs (required fields, bounds,
+//     enums, descriptions); ValidateInput checks tool input against it.
+//   - File tools: read_file, list_files (non-recursive), glob_files and tree (recursive),
+//     search_files (grep over the sandbox), edit_file, apply_patch (unified diffs,
+//     all-or-nothing). Listing and search tools skip paths matched by
+//     .gitignore/.agentignore and count what they hid.
+//   - run_command: runs allowed executables in the write root via internal/execops.
 //   - Invariants: tool_use and its corresponding tool_result remain adjacent within a turn
 package tools
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -9,8 +10,8 @@ import (
 )
 
 type EditFileInput struct {
-	Path   string `json:"path" jsonschema_description:"Target relative file path"`
-	OldStr string `json:"old_str" jsonschema_description:"Exact text to replace; must be present once when editing an existing file."`
+	Path   string `json:"path" jsonschema:"minLength=1" jsonschema_description:"Target relative file path"`
+	OldStr string `json:"old_str,omitempty" jsonschema_description:"Exact text to replace; must be present once when editing an existing file. Omit or leave empty to create a new file."`
 	NewStr string `json:"new_str" jsonschema_description:"New text to write or replace old_str with"`
 }
 
@@ -23,12 +24,14 @@ When old_str is empty and the file doesn’t exist, a new file is created.
 When editing an existing file, all occurrences of old_str are replaced with new_str; old_str and new_str must be different.
 `,
 	InputSchema: EditFileInputSchema,
-	Function:    EditFile,
+	Handler:     EditFile,
 }
 
 var EditFileInputSchema = GenerateSchema[EditFileInput]()
 
-func EditFile(input json.RawMessage) (string, error) {
+// EditFile creates or edits one file via fsops. It checks ctx only before writing,
+// so a call that timed out never changes the file afterwards.
+func EditFile(ctx context.Context, input json.RawMessage) (string, error) {
 	editFileInput := EditFileInput{}
 	err := json.Unmarshal(input, &editFileInput)
 	if err != nil {
@@ -44,6 +47,9 @@ func EditFile(input json.RawMessage) (string, error) {
 	if readErr != nil {
 		// If file does not exist and OldStr is empty, create new file with NewStr
 		if editFileInput.OldStr == "" {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
 			if err := fsops.WriteFile(editFileInput.Path, editFileInput.NewStr); err != nil {
 				return "", err
 			}
@@ -64,6 +70,9 @@ func EditFile(input json.RawMessage) (string, error) {
 		return "", fmt.Errorf("old_str not found in file")
 	}
 
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	if err := fsops.WriteFile(editFileInput.Path, newContent); err != nil {
 		return "", err
 	}
@@ -1,7 +1,9 @@
 package tools_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -17,7 +19,7 @@ func TestEditFile_CreateNew(t *testing.T) {
 	}
 	in := tools.EditFileInput{Path: rel(t, "new.txt"), OldStr: "", NewStr: "hello"}
 	b, _ := json.Marshal(in)
-	out, err := tools.EditFileDefinition.Function(b)
+	out, err := tools.EditFileDefinition.Handler(context.Background(), b)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -40,7 +42,7 @@ func TestEditFile_ReplaceOK(t *testing.T) {
 	}
 	in := tools.EditFileInput{Path: rel(t, "a.txt"), OldStr: "abc", NewStr: "XYZ"}
 	b, _ := json.Marshal(in)
-	out, err := tools.EditFileDefinition.Function(b)
+	out, err := tools.EditFileDefinition.Handler(context.Background(), b)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -53,13 +55,40 @@ func TestEditFile_ReplaceOK(t *testing.T) {
 	}
 }
 
+func TestEditFile_CanceledDoesNotWrite(t *testing.T) {
+	dir := filepath.Join(sharedDir, rel(t))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("abc"), 0o644); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, in := range []tools.EditFileInput{
+		{Path: rel(t, "a.txt"), OldStr: "abc", NewStr: "XYZ"},
+		{Path: rel(t, "new.txt"), NewStr: "hello"},
+	} {
+		b, _ := json.Marshal(in)
+		if _, err := tools.EditFileDefinition.Handler(ctx, b); !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s: want context.Canceled, got %v", in.Path, err)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "abc" {
+		t.Fatalf("file changed after cancel: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("file created after cancel: %v", err)
+	}
+}
+
 func TestEditFile_OldNotFound_Error(t *testing.T) {
 	dir := t.TempDir()
 	p := filepath.Join(dir, "a.txt")
 	_ = os.WriteFile(p, []byte("abc"), 0o644)
 	in := tools.EditFileInput{Path: p, OldStr: "nope", NewStr: "x"}
 	b, _ := json.Marshal(in)
-	_, err := tools.EditFileDefinition.Function(b)
+	_, err := tools.EditFileDefinition.Handler(context.Background(), b)
 	if err == nil {
 		t.Fatal("expected error when old_str not found")
 	}
@@ -70,7 +99,7 @@ func TestEditFile_InvalidParams_Error(t *testing.T) {
 	{
 		in := tools.EditFileInput{Path: "", OldStr: "a", NewStr: "b"}
 		b, _ := json.Marshal(in)
-		if _, err := tools.EditFileDefinition.Function(b); err == nil {
+		if _, err := tools.EditFileDefinition.Handler(context.Background(), b); err == nil {
 			t.Fatal("expected error for empty path")
 		}
 	}
@@ -78,7 +107,7 @@ func TestEditFile_InvalidParams_Error(t *testing.T) {
 	{
 		in := tools.EditFileInput{Path: "some.txt", OldStr: "x", NewStr: "x"}
 		b, _ := json.Marshal(in)
-		if _, err := tools.EditFileDefinition.Function(b); err == nil {
+		if _, err := tools.EditFileDefinition.Handler(context.Background(), b); err == nil {
 			t.Fatal("expected error when OldStr == NewStr")
 		}
 	}
@@ -91,7 +120,7 @@ func TestEditFile_DenyWriteGit(t *testing.T) {
 	}
 	in := tools.EditFileInput{Path: ".git/HEAD", OldStr: "", NewStr: "ref: refs/heads/main\n"}
 	b, _ := json.Marshal(in)
-	_, err := tools.EditFileDefinition.Function(b)
+	_, err := tools.EditFileDefinition.Handler(context.Background(), b)
 	if err == nil {
 		t.Fatal("expected deny for writes under .git/")
 	}
@@ -106,7 +135,7 @@ func TestEditFile_DenyWriteAgentConversation(t *testing.T) {
 	}
 	in := tools.EditFileInput{Path: ".agent/conversation.json", OldStr: "", NewStr: "{}"}
 	b, _ := json.Marshal(in)
-	_, err := tools.EditFileDefinition.Function(b)
+	_, err := tools.EditFileDefinition.Handler(context.Background(), b)
 	if err == nil {
 		t.Fatal("expected deny for writes under .agent/")
 	}
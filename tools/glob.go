@@ -0,0 +1,71 @@
+package tools
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// matchGlob reports whether the slash-separated relative path p matches pattern.
+// Patterns use path.Match syntax plus "**", which matches any number of path
+// segments. A pattern without "/" matches the base name at any depth, so "*.go"
+// selects every Go file.
+func matchGlob(pattern, p string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+// matchAny reports whether p matches any of patterns.
+func matchAny(patterns []string, p string) bool {
+	for _, g := range patterns {
+		if matchGlob(g, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// selected applies include and exclude globs to relPath (relative to the read root).
+// Globs match either that path or the path relative to dir, the directory searched.
+func selected(include, exclude []string, dir, relPath string) bool {
+	paths := []string{relPath}
+	if d := path.Clean(filepath.ToSlash(dir)); d != "." && d != "" {
+		if r, ok := strings.CutPrefix(relPath, d+"/"); ok {
+			paths = append(paths, r)
+		}
+	}
+	matches := func(globs []string) bool {
+		for _, p := range paths {
+			if matchAny(globs, p) {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(include) == 0 || matches(include)) && !matches(exclude)
+}
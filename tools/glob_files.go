@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+type GlobFilesInput struct {
+	Pattern        string `json:"pattern" jsonschema:"minLength=1" jsonschema_description:"Glob relative to path; ** matches any number of directories (e.g. **/*_test.go). A pattern without / matches file names at any depth."`
+	Path           string `json:"path,omitempty" jsonschema_description:"Optional relative directory to search from (defaults to current directory)."`
+	IncludeIgnored bool   `json:"include_ignored,omitempty" jsonschema_description:"Also list files excluded by .gitignore or .agentignore."`
+	Page           int    `json:"page,omitempty" jsonschema:"minimum=0" jsonschema_description:"1-based page number (default 1)."`
+	PageSize       int    `json:"page_size,omitempty" jsonschema:"minimum=0" jsonschema_description:"Page size (default 200)."`
+}
+
+type TreeInput struct {
+	Path           string `json:"path,omitempty" jsonschema_description:"Optional relative directory to show (defaults to current directory)."`
+	Depth          int    `json:"depth,omitempty" jsonschema:"minimum=0,maximum=10" jsonschema_description:"Directory levels to descend (default 2)."`
+	IncludeIgnored bool   `json:"include_ignored,omitempty" jsonschema_description:"Also list entries excluded by .gitignore or .agentignore."`
+	Page           int    `json:"page,omitempty" jsonschema:"minimum=0" jsonschema_description:"1-based page number (default 1)."`
+	PageSize       int    `json:"page_size,omitempty" jsonschema:"minimum=0" jsonschema_description:"Page size (default 200)."`
+}
+
+const defaultTreeDepth = 2 // fallback depth when depth <= 0
+
+var GlobFilesDefinition = ToolDefinition{
+	Name:        "glob_files",
+	Description: "Find files within the workspace whose paths match a glob, recursively. Returns a JSON-encoded list of paths relative to the workspace root, sorted and paged. Files under .git/ and .agent/ are skipped, as are paths matched by .gitignore or .agentignore; a final entry counts the ignored entries hidden.",
+	InputSchema: GlobFilesInputSchema,
+	Handler:     GlobFiles,
+
+	ParallelSafe: true,
+}
+
+var TreeDefinition = ToolDefinition{
+	Name:        "tree",
+	Description: "Show the directory tree under a path within the workspace, down to a depth limit. Returns a JSON-encoded list of paths relative to the workspace root in tree order; directories are suffixed with /. Paged; .git/, .agent/ and entries matched by .gitignore or .agentignore are skipped, and a final entry counts the ignored entries hidden.",
+	InputSchema: TreeInputSchema,
+	Handler:     Tree,
+
+	ParallelSafe: true,
+}
+
+var GlobFilesInputSchema = GenerateSchema[GlobFilesInput]()
+var TreeInputSchema = GenerateSchema[TreeInput]()
+
+// GlobFiles walks the sandbox via fsops and returns the files matching the pattern,
+// sorted and paged like list_files (page 1 and page_size 200 by default; an
+// out-of-range page returns an empty list).
+func GlobFiles(ctx context.Context, input json.RawMessage) (string, error) {
+	var in GlobFilesInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return "", err
+	}
+	filter, err := newIgnoreFilter(in.Path, in.IncludeIgnored)
+	if err != nil {
+		return "", err
+	}
+	var paths []string
+	err = filter.walk(in.Path, func(relPath string, isDir bool) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !isDir && selected([]string{in.Pattern}, nil, in.Path, relPath) {
+			paths = append(paths, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+	return pageJSON(paths, in.Page, in.PageSize, filter.note())
+}
+
+// Tree walks the sandbox via fsops and returns entries below the path, directories
+// suffixed with "/", down to depth levels (2 by default), paged like list_files.
+func Tree(ctx context.Context, input json.RawMessage) (string, error) {
+	var in TreeInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return "", err
+	}
+	depth := in.Depth
+	if depth <= 0 {
+		depth = defaultTreeDepth
+	}
+	filter, err := newIgnoreFilter(in.Path, in.IncludeIgnored)
+	if err != nil {
+		return "", err
+	}
+	base := cleanRel(in.Path)
+	var entries []string
+	err = filter.walk(in.Path, func(relPath string, isDir bool) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		below := relPath
+		if base != "." {
+			below = strings.TrimPrefix(relPath, base+"/")
+		}
+		level := strings.Count(below, "/") + 1
+		if !isDir {
+			entries = append(entries, relPath)
+			return nil
+		}
+		entries = append(entries, relPath+"/")
+		if level >= depth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return pageJSON(entries, in.Page, in.PageSize, filter.note())
+}
+
+// pageJSON returns one page of items as a JSON-encoded []string, with the list_files
+// defaults: page 1 and page_size 200 when <= 0; an out-of-range page is "[]". A
+// non-empty note is appended to the page as a final entry.
+func pageJSON(items []string, page, pageSize int, note string) (string, error) {
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = defaultListFilesPageSize
+	}
+	start := (page - 1) * pageSize
+	if start >= len(items) {
+		return "[]", nil
+	}
+	end := min(start+pageSize, len(items))
+	paged := items[start:end:end]
+	if note != "" {
+		paged = append(paged, note)
+	}
+	b, err := json.Marshal(paged)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,91 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/petasbytes/go-agent/tools"
+)
+
+func runListing(t *testing.T, def tools.ToolDefinition, in any) []string {
+	t.Helper()
+	b, _ := json.Marshal(in)
+	out, err := def.Handle()(context.Background(), b)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	var got []string
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("invalid JSON output: %v; raw=%q", err, out)
+	}
+	return got
+}
+
+func TestGlobFiles_DoubleStarSortedAndPaged(t *testing.T) {
+	writeTree(t, map[string]string{
+		"a.go": "", "cmd/main.go": "", "internal/x/x.go": "", "internal/x/x_test.go": "", "README.md": "",
+	})
+	base := filepath.ToSlash(rel(t))
+	got := runListing(t, tools.GlobFilesDefinition, tools.GlobFilesInput{Pattern: "**/*.go", Path: rel(t)})
+	want := []string{base + "/a.go", base + "/cmd/main.go", base + "/internal/x/x.go", base + "/internal/x/x_test.go"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+
+	got = runListing(t, tools.GlobFilesDefinition, tools.GlobFilesInput{Pattern: "internal/**/*_test.go", Path: rel(t)})
+	if !slices.Equal(got, []string{base + "/internal/x/x_test.go"}) {
+		t.Fatalf("anchored ** pattern: got %v", got)
+	}
+
+	got = runListing(t, tools.GlobFilesDefinition, tools.GlobFilesInput{Pattern: "*.go", Path: rel(t), Page: 2, PageSize: 3})
+	if !slices.Equal(got, want[3:]) {
+		t.Fatalf("page 2: got %v", got)
+	}
+}
+
+func TestTree_DepthLimitAndDirectoryMarks(t *testing.T) {
+	writeTree(t, map[string]string{"top.txt": "", "a/one.txt": "", "a/b/two.txt": "", "a/b/c/three.txt": ""})
+	base := filepath.ToSlash(rel(t))
+	got := runListing(t, tools.TreeDefinition, tools.TreeInput{Path: rel(t)})
+	want := []string{base + "/a/", base + "/a/b/", base + "/a/one.txt", base + "/top.txt"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("depth 2: got %v want %v", got, want)
+	}
+	got = runListing(t, tools.TreeDefinition, tools.TreeInput{Path: rel(t), Depth: 5})
+	if len(got) != 7 {
+		t.Fatalf("depth 5 should list every entry, got %v", got)
+	}
+}
+
+func TestGlobFiles_HonoursIgnoreFiles(t *testing.T) {
+	writeTree(t, map[string]string{
+		".gitignore":    "vendor/\n*.pb.go\n",
+		".agentignore":  "!keep.pb.go\n",
+		"keep.go":       "",
+		"keep.pb.go":    "",
+		"gen.pb.go":     "",
+		"vendor/dep.go": "",
+	})
+	base := filepath.ToSlash(rel(t))
+	hidden := "-- 2 ignored entries hidden (.gitignore/.agentignore); set include_ignored to include them --"
+
+	got := runListing(t, tools.GlobFilesDefinition, tools.GlobFilesInput{Pattern: "*.go", Path: rel(t)})
+	if !slices.Equal(got, []string{base + "/keep.go", base + "/keep.pb.go", hidden}) {
+		t.Fatalf("ignored files listed: %v", got)
+	}
+	got = runListing(t, tools.TreeDefinition, tools.TreeInput{Path: rel(t)})
+	if slices.Contains(got, base+"/vendor/") || got[len(got)-1] != hidden {
+		t.Fatalf("ignored directory in tree: %v", got)
+	}
+	got = runListing(t, tools.GlobFilesDefinition, tools.GlobFilesInput{Pattern: "*.go", Path: rel(t), IncludeIgnored: true})
+	if len(got) != 4 {
+		t.Fatalf("include_ignored should list every file, got %v", got)
+	}
+	got = runListing(t, tools.GlobFilesDefinition, tools.GlobFilesInput{Pattern: "*.go", Path: rel(t, "vendor")})
+	if !slices.Equal(got, []string{base + "/vendor/dep.go"}) {
+		t.Fatalf("naming an ignored directory should list it, got %v", got)
+	}
+}
@@ -0,0 +1,81 @@
+package tools
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+
+	"github.com/petasbytes/go-agent/internal/fsops"
+	"github.com/petasbytes/go-agent/internal/ignore"
+)
+
+const ignoredNote = "-- %d ignored %s hidden (.gitignore/.agentignore); set include_ignored to include them --"
+
+// ignoreFilter hides paths matched by .gitignore and .agentignore files from a tool's
+// results and counts what it hid, so the model knows they exist. A filter without a
+// matcher hides nothing.
+type ignoreFilter struct {
+	m      *ignore.Matcher
+	hidden int
+}
+
+// newIgnoreFilter returns the filter for a tool call listing dir. It hides nothing
+// when includeIgnored is set or when dir is itself ignored: naming an ignored
+// directory is asking for its contents.
+func newIgnoreFilter(dir string, includeIgnored bool) (*ignoreFilter, error) {
+	if includeIgnored {
+		return &ignoreFilter{}, nil
+	}
+	m, err := fsops.Ignores()
+	if err != nil {
+		return nil, err
+	}
+	if m.Ignored(cleanRel(dir), true) {
+		return &ignoreFilter{}, nil
+	}
+	return &ignoreFilter{m: m}, nil
+}
+
+// skip reports whether relPath (relative to the read root) is ignored, counting it if so.
+func (f *ignoreFilter) skip(relPath string, isDir bool) bool {
+	if f.m == nil || !f.m.Ignored(relPath, isDir) {
+		return false
+	}
+	f.hidden++
+	return true
+}
+
+// walk is fsops.WalkDir with ignored entries left out; an ignored directory is
+// pruned and counted once.
+func (f *ignoreFilter) walk(relDir string, fn func(relPath string, isDir bool) error) error {
+	return fsops.WalkDir(relDir, func(relPath string, isDir bool) error {
+		if f.skip(relPath, isDir) {
+			if isDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		return fn(relPath, isDir)
+	})
+}
+
+// note returns the trailing notice for hidden entries, or "" when none were hidden.
+func (f *ignoreFilter) note() string {
+	switch f.hidden {
+	case 0:
+		return ""
+	case 1:
+		return fmt.Sprintf(ignoredNote, 1, "entry")
+	}
+	return fmt.Sprintf(ignoredNote, f.hidden, "entries")
+}
+
+// cleanRel returns a tool's relative path argument as a clean slash-separated path,
+// "." for the read root.
+func cleanRel(p string) string {
+	if p == "" {
+		return "."
+	}
+	return path.Clean(filepath.ToSlash(p))
+}
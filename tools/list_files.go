@@ -1,17 +1,21 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"path"
 	"sort"
+	"strings"
 
 	"github.com/petasbytes/go-agent/internal/fsops"
 )
 
 type ListFilesInput struct {
-	Path     string `json:"path,omitempty" jsonschema_description:"Optional relative path to list files from (defaults to current directory)."`
-	Page     int    `json:"page,omitempty" jsonschema_description:"1-based page number (default 1)."`
-	PageSize int    `json:"page_size,omitempty" jsonschema_description:"Page size (default 200)."`
+	Path           string `json:"path,omitempty" jsonschema_description:"Optional relative path to list files from (defaults to current directory)."`
+	IncludeIgnored bool   `json:"include_ignored,omitempty" jsonschema_description:"Also list entries excluded by .gitignore or .agentignore."`
+	Page           int    `json:"page,omitempty" jsonschema:"minimum=0" jsonschema_description:"1-based page number (default 1)."`
+	PageSize       int    `json:"page_size,omitempty" jsonschema:"minimum=0" jsonschema_description:"Page size (default 200)."`
 }
 
 // defaultListFilesPageSize is the fallback page size when page_size <= 0.
@@ -19,21 +23,25 @@ const defaultListFilesPageSize = 200
 
 var ListFilesDefinition = ToolDefinition{
 	Name:        "list_files",
-	Description: "List names of files in a directory within the workspace (non-recursive).",
+	Description: "List names of files in a directory within the workspace (non-recursive). Entries matched by .gitignore or .agentignore are left out; a final entry counts them.",
 	InputSchema: ListFilesInputSchema,
-	Function:    ListFiles,
+	Handler:     ListFiles,
+
+	ParallelSafe: true,
 }
 
 var ListFilesInputSchema = GenerateSchema[ListFilesInput]()
 
 // ListFiles lists non-recursive directory entries under the sandbox via fsops,
-// then applies deterministic sorting and simple paging at the tool layer.
+// then drops ignored entries and applies deterministic sorting and simple paging at
+// the tool layer.
 // Defaults:
 //   - page: 1 when <= 0
 //   - page_size: 200 when <= 0
 //
-// Contract: returns a JSON-encoded []string to preserve existing tool behaviour.
-func ListFiles(input json.RawMessage) (string, error) {
+// Contract: returns a JSON-encoded []string to preserve existing tool behaviour; when
+// entries were ignored, a final note says how many.
+func ListFiles(ctx context.Context, input json.RawMessage) (string, error) {
 	var in ListFilesInput
 	if err := json.Unmarshal(input, &in); err != nil {
 		return "", err
@@ -48,14 +56,32 @@ func ListFiles(input json.RawMessage) (string, error) {
 		pageSize = defaultListFilesPageSize
 	}
 
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	namesJSON, err := fsops.ListFiles(in.Path)
 	if err != nil {
 		return "", err
 	}
-	var names []string
-	if err := json.Unmarshal([]byte(namesJSON), &names); err != nil {
+	var all []string
+	if err := json.Unmarshal([]byte(namesJSON), &all); err != nil {
 		return "", fmt.Errorf("invalid list_files payload: %w", err)
 	}
+	filter, err := newIgnoreFilter(in.Path, in.IncludeIgnored)
+	if err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	dir := cleanRel(in.Path)
+	names := all[:0]
+	for _, name := range all {
+		base, isDir := strings.CutSuffix(name, "/")
+		if !filter.skip(path.Join(dir, base), isDir) {
+			names = append(names, name)
+		}
+	}
 	// Standardise order so paging is deterministic across filesystems.
 	sort.Strings(names)
 
@@ -68,7 +94,10 @@ func ListFiles(input json.RawMessage) (string, error) {
 	if end > len(names) {
 		end = len(names)
 	}
-	paged := names[start:end]
+	paged := names[start:end:end]
+	if note := filter.note(); note != "" {
+		paged = append(paged, note)
+	}
 
 	b, err := json.Marshal(paged)
 	if err != nil {
@@ -1,6 +1,7 @@
 package tools_test
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -27,7 +28,7 @@ func TestListFiles_NonRecursive_Basic(t *testing.T) {
 	// List the per-test dir via relative path
 	in := tools.ListFilesInput{Path: rel(t)}
 	b, _ := json.Marshal(in)
-	out, err := tools.ListFilesDefinition.Function(b)
+	out, err := tools.ListFilesDefinition.Handler(context.Background(), b)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -55,7 +56,7 @@ func TestListFiles_NonRecursive_Basic(t *testing.T) {
 func TestListFiles_InvalidPath_Error(t *testing.T) {
 	in := tools.ListFilesInput{Path: rel(t, "does", "not", "exist")}
 	b, _ := json.Marshal(in)
-	_, err := tools.ListFilesDefinition.Function(b)
+	_, err := tools.ListFilesDefinition.Handler(context.Background(), b)
 	if err == nil {
 		t.Fatal("expected error for invalid path")
 	}
@@ -78,7 +79,7 @@ func TestListFiles_SortingAndPaging(t *testing.T) {
 	// Page 1 size 2 => ["a.txt", "b.txt"]
 	in := tools.ListFilesInput{Path: rel(t), Page: 1, PageSize: 2}
 	raw, _ := json.Marshal(in)
-	out, err := tools.ListFilesDefinition.Function(raw)
+	out, err := tools.ListFilesDefinition.Handler(context.Background(), raw)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -94,7 +95,7 @@ func TestListFiles_SortingAndPaging(t *testing.T) {
 	// Page 3 size 2 => ["z.txt"] (since sorted: a,b,c,m,z, pages are [a,b], [c,m], [z])
 	in.Page = 3
 	raw, _ = json.Marshal(in)
-	out, err = tools.ListFilesDefinition.Function(raw)
+	out, err = tools.ListFilesDefinition.Handler(context.Background(), raw)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -110,7 +111,7 @@ func TestListFiles_SortingAndPaging(t *testing.T) {
 	// Out-of-range page => []
 	in.Page = 4
 	raw, _ = json.Marshal(in)
-	out, err = tools.ListFilesDefinition.Function(raw)
+	out, err = tools.ListFilesDefinition.Handler(context.Background(), raw)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -118,3 +119,28 @@ func TestListFiles_SortingAndPaging(t *testing.T) {
 		t.Fatalf("want empty page: %q", out)
 	}
 }
+
+func TestListFiles_HidesIgnoredEntriesAndCountsThem(t *testing.T) {
+	writeTree(t, map[string]string{".gitignore": "bin/\n*.out\n", "main.go": "", "bin/app": "", "cover.out": ""})
+
+	in := tools.ListFilesInput{Path: rel(t)}
+	b, _ := json.Marshal(in)
+	out, err := tools.ListFilesDefinition.Handler(context.Background(), b)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := `[".gitignore","main.go","-- 2 ignored entries hidden (.gitignore/.agentignore); set include_ignored to include them --"]`
+	if out != want {
+		t.Fatalf("got %s want %s", out, want)
+	}
+
+	in.IncludeIgnored = true
+	b, _ = json.Marshal(in)
+	out, err = tools.ListFilesDefinition.Handler(context.Background(), b)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if out != `[".gitignore","bin/","cover.out","main.go"]` {
+		t.Fatalf("include_ignored should list every entry, got %s", out)
+	}
+}
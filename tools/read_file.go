@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"strings"
 
@@ -8,9 +9,9 @@ import (
 )
 
 type ReadFileInput struct {
-	Path   string `json:"path" jsonschema_description:"Relative file path."`
-	Offset int    `json:"offset,omitempty" jsonschema_description:"Line offset (0-based) to start reading from."`
-	Limit  int    `json:"limit,omitempty" jsonschema_description:"Maximum lines to return from offset (default 200)."`
+	Path   string `json:"path" jsonschema:"minLength=1" jsonschema_description:"Relative file path."`
+	Offset int    `json:"offset,omitempty" jsonschema:"minimum=0" jsonschema_description:"Line offset (0-based) to start reading from."`
+	Limit  int    `json:"limit,omitempty" jsonschema:"minimum=0" jsonschema_description:"Maximum lines to return from offset (default 200)."`
 }
 
 const defaultReadFileLimit = 200 // fallback page size when limit <= 0
@@ -22,7 +23,9 @@ var ReadFileDefinition = ToolDefinition{
 	Name:        "read_file",
 	Description: "Read the contents of a file addressed by a relative file path within the workspace. Directory paths and unsafe paths are rejected.",
 	InputSchema: ReadFileInputSchema,
-	Function:    ReadFile,
+	Handler:     ReadFile,
+
+	ParallelSafe: true,
 }
 
 var ReadFileInputSchema = GenerateSchema[ReadFileInput]()
@@ -46,11 +49,14 @@ func clampRunes(s string, n int) (string, bool) {
 //
 // If not all lines are returned, it appends a trailing sentinel to signal pagination.
 // Rationale: keep tool results predictably small for windowing/token heuristics.
-func ReadFile(input json.RawMessage) (string, error) {
+func ReadFile(ctx context.Context, input json.RawMessage) (string, error) {
 	var in ReadFileInput
 	if err := json.Unmarshal(input, &in); err != nil {
 		return "", err
 	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 
 	content, err := fsops.ReadFile(in.Path)
 	if err != nil {
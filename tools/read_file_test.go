@@ -1,6 +1,7 @@
 package tools_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -23,7 +24,7 @@ func TestReadFile_Happy(t *testing.T) {
 
 	in := tools.ReadFileInput{Path: rel(t, "a.txt")}
 	b, _ := json.Marshal(in)
-	out, err := tools.ReadFileDefinition.Function(b)
+	out, err := tools.ReadFileDefinition.Handler(context.Background(), b)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -35,7 +36,7 @@ func TestReadFile_Happy(t *testing.T) {
 func TestReadFile_NotFound(t *testing.T) {
 	in := tools.ReadFileInput{Path: rel(t, "does-not-exist.txt")}
 	b, _ := json.Marshal(in)
-	_, err := tools.ReadFileDefinition.Function(b)
+	_, err := tools.ReadFileDefinition.Handler(context.Background(), b)
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -49,7 +50,7 @@ func TestReadFile_DirectoryPath_Error(t *testing.T) {
 
 	in := tools.ReadFileInput{Path: rel(t, "sub")}
 	b, _ := json.Marshal(in)
-	_, err := tools.ReadFileDefinition.Function(b)
+	_, err := tools.ReadFileDefinition.Handler(context.Background(), b)
 	if err == nil {
 		t.Fatal("expected error for directory path")
 	}
@@ -68,7 +69,7 @@ func TestReadFile_DenylistReadsAgent(t *testing.T) {
 
 	in := tools.ReadFileInput{Path: ".agent/conv.json"}
 	b, _ := json.Marshal(in)
-	_, err := tools.ReadFileDefinition.Function(b)
+	_, err := tools.ReadFileDefinition.Handler(context.Background(), b)
 	if err == nil {
 		t.Fatal("expected deny for .agent/")
 	}
@@ -95,7 +96,7 @@ func TestReadFile_DefaultLimitAndSentinel(t *testing.T) {
 
 	in := tools.ReadFileInput{Path: rel(t, "big.txt")}
 	raw, _ := json.Marshal(in)
-	out, err := tools.ReadFileDefinition.Function(raw)
+	out, err := tools.ReadFileDefinition.Handler(context.Background(), raw)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -126,7 +127,7 @@ func TestReadFile_SentinelWhenLastChunkHasNoNewLine(t *testing.T) {
 	// limit=1 includes only "A" (with its newline), not the "B" line
 	in := tools.ReadFileInput{Path: rel(t, "tiny.txt"), Limit: 1}
 	raw, _ := json.Marshal(in)
-	out, err := tools.ReadFileDefinition.Function(raw)
+	out, err := tools.ReadFileDefinition.Handler(context.Background(), raw)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -158,7 +159,7 @@ func TestReadFile_OffsetLimit_NoTrucation(t *testing.T) {
 	// Choose an offset/limit that reads to the end so there is no truncation
 	in := tools.ReadFileInput{Path: rel(t, "a.txt"), Offset: 2, Limit: 10}
 	raw, _ := json.Marshal(in)
-	out, err := tools.ReadFileDefinition.Function(raw)
+	out, err := tools.ReadFileDefinition.Handler(context.Background(), raw)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -181,7 +182,7 @@ func TestReadFile_NegativeAndBeyondEnd(t *testing.T) {
 	// Negative offset/limit clamps to defaults and 0; for a small file this reads all content with NO truncation
 	in := tools.ReadFileInput{Path: rel(t, "a.txt"), Offset: -10, Limit: -1}
 	raw, _ := json.Marshal(in)
-	out, err := tools.ReadFileDefinition.Function(raw)
+	out, err := tools.ReadFileDefinition.Handler(context.Background(), raw)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -192,7 +193,7 @@ func TestReadFile_NegativeAndBeyondEnd(t *testing.T) {
 	// Offset beyond end => empty string (no sentinel)
 	in2 := tools.ReadFileInput{Path: rel(t, "a.txt"), Offset: 999, Limit: 10}
 	raw2, _ := json.Marshal(in2)
-	out2, err := tools.ReadFileDefinition.Function(raw2)
+	out2, err := tools.ReadFileDefinition.Handler(context.Background(), raw2)
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
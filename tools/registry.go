@@ -2,5 +2,5 @@ package tools
 
 // Registry returns all tool definitions wired for the agent
 func Registry() []ToolDefinition {
-	return []ToolDefinition{ReadFileDefinition, ListFilesDefinition, EditFileDefinition}
+	return []ToolDefinition{ReadFileDefinition, ListFilesDefinition, GlobFilesDefinition, TreeDefinition, SearchFilesDefinition, EditFileDefinition, ApplyPatchDefinition, RunCommandDefinition}
 }
@@ -8,7 +8,7 @@ import (
 
 func TestRegistry_ToolCount(t *testing.T) {
 	defs := tools.Registry()
-	wantCount := 3 // read_file, list_files, edit_file
+	wantCount := 8 // read_file, list_files, glob_files, tree, search_files, edit_file, apply_patch, run_command
 	if len(defs) != wantCount {
 		t.Fatalf("unexpected number of tools: got %d want %d", len(defs), wantCount)
 	}
@@ -17,9 +17,14 @@ func TestRegistry_ToolCount(t *testing.T) {
 func TestRegistry_ToolNames(t *testing.T) {
 	defs := tools.Registry()
 	want := map[string]struct{}{
-		"read_file":  {},
-		"list_files": {},
-		"edit_file":  {},
+		"read_file":    {},
+		"list_files":   {},
+		"glob_files":   {},
+		"tree":         {},
+		"run_command":  {},
+		"search_files": {},
+		"edit_file":    {},
+		"apply_patch":  {},
 	}
 
 	// Unexpected names detected
@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/petasbytes/go-agent/internal/execops"
+	"github.com/petasbytes/go-agent/internal/fsops"
+	"github.com/petasbytes/go-agent/internal/safety"
+)
+
+type RunCommandInput struct {
+	Command        string   `json:"command" jsonschema:"minLength=1" jsonschema_description:"Executable name looked up on PATH, e.g. go. It runs directly, not through a shell."`
+	Args           []string `json:"args,omitempty" jsonschema_description:"Arguments, e.g. [\"test\", \"./...\"]. Shell syntax (pipes, redirection, globs, $VARS) is passed through literally."`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty" jsonschema:"minimum=0,maximum=600" jsonschema_description:"Wall-clock limit in seconds (default 120), capped at the time left in the current turn."`
+}
+
+const defaultCommandTimeout = 120 * time.Second // fallback when timeout_seconds <= 0
+const maxCommandOutputBytes = 8000              // kept per stream; the rest is dropped
+const commandTruncatedSentinel = "-- truncated; narrow the command or its output to see more --\n"
+
+// commandDeadlineMargin is kept back from the turn's deadline, so a command cut short
+// by it still reports its timeout result instead of the turn being cancelled.
+const commandDeadlineMargin = time.Second
+
+var RunCommandDefinition = ToolDefinition{
+	Name: "run_command",
+	Description: `Run a command in the workspace root, such as go build ./..., go test ./... or a linter, and return its exit code, stdout and stderr.
+
+The command is an executable name plus arguments, run without a shell. Only allowed executables run (by default the Go toolchain and common Go linters). Output is truncated per stream with a trailing sentinel; commands are killed when they exceed their time limit.`,
+	InputSchema: RunCommandInputSchema,
+	Handler:     RunCommand,
+	Timeout:     -1, // the command's own wall-clock limit applies; see timeout_seconds
+}
+
+var RunCommandInputSchema = GenerateSchema[RunCommandInput]()
+
+// RunCommand runs the command via execops with the working directory pinned to the
+// sandbox write root, the AGT_RUN_ALLOW/AGT_RUN_DENY policy and a scrubbed environment.
+// Defaults:
+//   - timeout_seconds: 120 when <= 0 (the schema caps it at 600); either way it is
+//     capped at the time left before ctx's deadline, less commandDeadlineMargin
+//
+// Returns the exit code, then stdout and stderr, each cut to 8000 bytes and per-line
+// clamped like read_file, with the read_file-style sentinel when anything was cut.
+// A non-zero exit is a normal result; denied or unknown commands are ToolErrors.
+func RunCommand(ctx context.Context, input json.RawMessage) (string, error) {
+	var in RunCommandInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return "", err
+	}
+	dir, err := fsops.WriteRoot()
+	if err != nil {
+		return "", err
+	}
+	timeout := time.Duration(in.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	capped := false
+	if dl, ok := ctx.Deadline(); ok {
+		left := time.Until(dl) - commandDeadlineMargin
+		if left <= 0 {
+			return "", safety.ToolError{Code: "ERR_TURN_DEADLINE", Message: "no time left in this turn to run a command; answer with what you have"}
+		}
+		if left < timeout {
+			timeout, capped = left, true
+		}
+	}
+	res, err := execops.Run(ctx, execops.PolicyFromEnv(), execops.Command{
+		Name:      in.Command,
+		Args:      in.Args,
+		Dir:       dir,
+		Timeout:   timeout,
+		MaxOutput: maxCommandOutputBytes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "exit_code: %d", res.ExitCode)
+	if res.TimedOut {
+		limit := "timed out"
+		if capped {
+			limit = "reached the end of the turn"
+		}
+		fmt.Fprintf(&b, " (%s after %s; killed)", limit, timeout.Round(time.Millisecond))
+	}
+	b.WriteString("\n--- stdout ---\n")
+	b.WriteString(formatStream(res.Stdout, res.StdoutTruncated))
+	b.WriteString("--- stderr ---\n")
+	b.WriteString(formatStream(res.Stderr, res.StderrTruncated))
+	return b.String(), nil
+}
+
+// formatStream clamps each line to maxLineRunes and ends the output with a newline,
+// adding the truncation sentinel when the stream or any line was cut.
+func formatStream(out string, truncated bool) string {
+	if out == "" && !truncated {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	for i, l := range lines {
+		if clamped, did := clampRunes(l, maxLineRunes); did {
+			lines[i], truncated = clamped, true
+		}
+	}
+	s := strings.Join(lines, "\n") + "\n"
+	if truncated {
+		s += commandTruncatedSentinel
+	}
+	return s
+}
@@ -0,0 +1,88 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/petasbytes/go-agent/internal/safety"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+func runCommand(t *testing.T, in tools.RunCommandInput) (string, error) {
+	t.Helper()
+	b, _ := json.Marshal(in)
+	return tools.RunCommandDefinition.Handle()(context.Background(), b)
+}
+
+func TestRunCommand_ReportsExitCodeAndStreams(t *testing.T) {
+	out, err := runCommand(t, tools.RunCommandInput{Command: "go", Args: []string{"env", "GOVERSION"}})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !strings.HasPrefix(out, "exit_code: 0\n--- stdout ---\ngo") || !strings.HasSuffix(out, "--- stderr ---\n") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+
+	out, err = runCommand(t, tools.RunCommandInput{Command: "go", Args: []string{"no-such-subcommand"}})
+	if err != nil {
+		t.Fatalf("a failing command is a result, not an error: %v", err)
+	}
+	if strings.HasPrefix(out, "exit_code: 0") || !strings.Contains(out, "--- stderr ---\ngo no-such-subcommand") {
+		t.Fatalf("want a non-zero exit and stderr, got %q", out)
+	}
+}
+
+func TestRunCommand_TruncatesLongOutput(t *testing.T) {
+	if _, err := exec.LookPath("seq"); err != nil {
+		t.Skip("seq unavailable")
+	}
+	t.Setenv("AGT_RUN_ALLOW", "seq")
+	out, err := runCommand(t, tools.RunCommandInput{Command: "seq", Args: []string{"100000"}})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	stdout, _, _ := strings.Cut(out, "--- stderr ---")
+	if len(stdout) > 8200 || !strings.HasSuffix(stdout, "\n-- truncated; narrow the command or its output to see more --\n") {
+		t.Fatalf("want stdout cut to 8000 bytes with a sentinel, got %d bytes ending %q", len(stdout), stdout[len(stdout)-80:])
+	}
+}
+
+func TestRunCommand_DeniedCommands(t *testing.T) {
+	for _, name := range []string{"bash", "/usr/bin/go", "rm"} {
+		_, err := runCommand(t, tools.RunCommandInput{Command: name, Args: []string{"-c", "true"}})
+		var te safety.ToolError
+		if !errors.As(err, &te) || te.Code != "ERR_COMMAND_DENIED" {
+			t.Errorf("%s: want ERR_COMMAND_DENIED, got %v", name, err)
+		}
+	}
+}
+
+func TestRunCommand_CappedAtContextDeadline(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep unavailable")
+	}
+	t.Setenv("AGT_RUN_ALLOW", "sleep")
+	b, _ := json.Marshal(tools.RunCommandInput{Command: "sleep", Args: []string{"30"}})
+
+	// The command's own (capped) timeout fires before the turn is cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	out, err := tools.RunCommandDefinition.Handle()(ctx, b)
+	if err != nil || !strings.HasPrefix(out, "exit_code: -1 (reached the end of the turn after") {
+		t.Fatalf("want a capped timeout result, got %q, %v", out, err)
+	}
+
+	// With no time left, the command does not start.
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err = tools.RunCommandDefinition.Handle()(ctx, b)
+	var te safety.ToolError
+	if !errors.As(err, &te) || te.Code != "ERR_TURN_DEADLINE" {
+		t.Fatalf("want ERR_TURN_DEADLINE, got %v", err)
+	}
+}
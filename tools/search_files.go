@@ -0,0 +1,200 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+
+	"github.com/petasbytes/go-agent/internal/fsops"
+	"github.com/petasbytes/go-agent/internal/safety"
+)
+
+type SearchFilesInput struct {
+	Pattern        string   `json:"pattern" jsonschema:"minLength=1" jsonschema_description:"Regular expression (RE2 syntax) to search for; plain text when literal is true."`
+	Path           string   `json:"path,omitempty" jsonschema_description:"Optional relative directory or file to search (defaults to current directory)."`
+	Literal        bool     `json:"literal,omitempty" jsonschema_description:"Treat pattern as plain text rather than a regular expression."`
+	IgnoreCase     bool     `json:"ignore_case,omitempty" jsonschema_description:"Match case-insensitively."`
+	Include        []string `json:"include,omitempty" jsonschema_description:"Only search files matching one of these globs, relative to path, e.g. *.go or internal/**/*_test.go."`
+	Exclude        []string `json:"exclude,omitempty" jsonschema_description:"Skip files matching any of these globs."`
+	IncludeIgnored bool     `json:"include_ignored,omitempty" jsonschema_description:"Also search files excluded by .gitignore or .agentignore."`
+	Context        int      `json:"context,omitempty" jsonschema:"minimum=0,maximum=10" jsonschema_description:"Lines of context to show around each match (default 0)."`
+	Page           int      `json:"page,omitempty" jsonschema:"minimum=0" jsonschema_description:"1-based page of matches (default 1)."`
+	PageSize       int      `json:"page_size,omitempty" jsonschema:"minimum=0,maximum=500" jsonschema_description:"Matches per page (default 50)."`
+}
+
+const defaultSearchPageSize = 50 // fallback page size when page_size <= 0
+const maxSearchContext = 10
+const maxMatchLineRunes = 500 // per-line clamp; long minified lines would swamp the page
+const searchMoreSentinel = "-- more matches; use page=%d to fetch more --\n"
+const searchTruncatedSentinel = "-- truncated; use a smaller page_size or context to fetch the rest --\n"
+
+// binarySniffLen is how much of a file is checked for NUL bytes to skip binaries.
+const binarySniffLen = 8000
+
+var SearchFilesDefinition = ToolDefinition{
+	Name: "search_files",
+	Description: `Search file contents within the workspace for a regular expression or literal text, like grep -rn.
+
+Matches are listed as path:line:text in path and line order, with context lines as path-line-text and "--" between separate hunks. Results are paged; a trailing sentinel gives the next page. Binary files, files under .git/ or .agent/ and paths matched by .gitignore or .agentignore are skipped; a final line counts the ignored entries.`,
+	InputSchema: SearchFilesInputSchema,
+	Handler:     SearchFiles,
+
+	ParallelSafe: true,
+}
+
+var SearchFilesInputSchema = GenerateSchema[SearchFilesInput]()
+
+// searchMatch is one matching line with its context.
+type searchMatch struct {
+	path  string
+	line  int      // 1-based
+	lines []string // the file's lines, shared by matches in the same file
+}
+
+// SearchFiles walks the sandbox via fsops, greps each text file and returns one
+// page of matches. Defaults:
+//   - page: 1 when <= 0
+//   - page_size: 50 when <= 0
+//   - context: clamped to 0..10
+//
+// Lines are clamped to 500 runes and a page to the read_file overall cap; a trailing
+// sentinel signals further pages or truncation, followed by a count of ignored
+// entries that were not searched.
+func SearchFiles(ctx context.Context, input json.RawMessage) (string, error) {
+	var in SearchFilesInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return "", err
+	}
+	expr := in.Pattern
+	if in.Literal {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if in.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", safety.ToolError{Code: "ERR_INVALID_PATTERN", Message: err.Error(), Fields: []string{"pattern"}}
+	}
+	page := max(in.Page, 1)
+	pageSize := in.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultSearchPageSize
+	}
+	contextLines := min(max(in.Context, 0), maxSearchContext)
+
+	// Collect matches up to the end of the requested page, plus one to know whether more follow.
+	want := page*pageSize + 1
+	filter, err := newIgnoreFilter(in.Path, in.IncludeIgnored)
+	if err != nil {
+		return "", err
+	}
+	var matches []searchMatch
+	err = filter.walk(in.Path, func(relPath string, isDir bool) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if isDir {
+			return nil
+		}
+		if !selected(in.Include, in.Exclude, in.Path, relPath) {
+			return nil
+		}
+		content, err := fsops.ReadFile(relPath)
+		if err != nil || strings.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0 {
+			return nil // unreadable, too large or binary
+		}
+		lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+		for i, l := range lines {
+			if !re.MatchString(l) {
+				continue
+			}
+			matches = append(matches, searchMatch{path: relPath, line: i + 1, lines: lines})
+			if len(matches) >= want {
+				return fs.SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	out := formatPage(matches, page, pageSize, contextLines)
+	if note := filter.note(); note != "" {
+		out += note + "\n"
+	}
+	return out, nil
+}
+
+// formatPage renders one page of matches with its trailing sentinel, if any.
+func formatPage(matches []searchMatch, page, pageSize, contextLines int) string {
+	start := (page - 1) * pageSize
+	if start >= len(matches) {
+		if page == 1 {
+			return "no matches\n"
+		}
+		return "no more matches\n"
+	}
+	end := min(start+pageSize, len(matches))
+	out := formatMatches(matches[start:end], contextLines)
+	if clamped, did := clampRunes(out, overallRuneCap); did {
+		// Cut back to a whole line so the sentinel starts its own line.
+		if i := strings.LastIndexByte(clamped, '\n'); i >= 0 {
+			clamped = clamped[:i+1]
+		}
+		return clamped + searchTruncatedSentinel
+	}
+	if len(matches) > end {
+		out += fmt.Sprintf(searchMoreSentinel, page+1)
+	}
+	return out
+}
+
+// formatMatches renders matches grep-style, merging overlapping context in a file.
+func formatMatches(matches []searchMatch, contextLines int) string {
+	var b strings.Builder
+	lastPath, lastLine := "", 0
+	for _, m := range matches {
+		from := max(m.line-contextLines, 1)
+		to := min(m.line+contextLines, len(m.lines))
+		if m.path == lastPath {
+			if to <= lastLine {
+				continue // already shown as context of the previous match
+			}
+			if from <= lastLine+1 {
+				from = lastLine + 1
+			} else {
+				b.WriteString("--\n")
+			}
+		} else if lastPath != "" {
+			b.WriteString("--\n")
+		}
+		for n := from; n <= to; n++ {
+			sep := "-"
+			if isMatchLine(matches, m.path, n) {
+				sep = ":"
+			}
+			text, did := clampRunes(strings.TrimSuffix(m.lines[n-1], "\r"), maxMatchLineRunes)
+			if did {
+				text += "…"
+			}
+			fmt.Fprintf(&b, "%s%s%d%s%s\n", m.path, sep, n, sep, text)
+		}
+		lastPath, lastLine = m.path, to
+	}
+	return b.String()
+}
+
+// isMatchLine reports whether line n of path is itself a match on this page.
+func isMatchLine(matches []searchMatch, path string, n int) bool {
+	for _, m := range matches {
+		if m.path == path && m.line == n {
+			return true
+		}
+	}
+	return false
+}
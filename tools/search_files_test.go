@@ -0,0 +1,138 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/petasbytes/go-agent/internal/safety"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+// writeTree creates files (relative to the per-test dir) with the given contents.
+func writeTree(t *testing.T, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(sharedDir, rel(t, name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+	}
+}
+
+func search(t *testing.T, in tools.SearchFilesInput) (string, error) {
+	t.Helper()
+	b, _ := json.Marshal(in)
+	return tools.SearchFilesDefinition.Handle()(context.Background(), b)
+}
+
+func TestSearchFiles_RegexWithContextAndGlobs(t *testing.T) {
+	writeTree(t, map[string]string{
+		"main.go":      "package main\n\nfunc main() {\n\trun()\n}\n",
+		"util/run.go":  "package util\n\nfunc run() {}\n",
+		"util/run.txt": "func run() in prose\n",
+		"bin.dat":      "func run()\x00\x01",
+	})
+	p := filepath.ToSlash(rel(t))
+	out, err := search(t, tools.SearchFilesInput{Pattern: `func \w+\(`, Path: rel(t), Include: []string{"*.go"}, Context: 1})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := p + "/main.go-2-\n" +
+		p + "/main.go:3:func main() {\n" +
+		p + "/main.go-4-\trun()\n" +
+		"--\n" +
+		p + "/util/run.go-2-\n" +
+		p + "/util/run.go:3:func run() {}\n"
+	if out != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", out, want)
+	}
+
+	out, err = search(t, tools.SearchFilesInput{Pattern: "FUNC RUN()", Literal: true, IgnoreCase: true, Path: rel(t), Exclude: []string{"util/**"}})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if out != "no matches\n" {
+		t.Fatalf("excluded and binary files should not match, got %q", out)
+	}
+}
+
+func TestSearchFiles_PagingAndLineClamp(t *testing.T) {
+	var b strings.Builder
+	for range 5 {
+		b.WriteString("hit " + strings.Repeat("x", 600) + "\n")
+	}
+	writeTree(t, map[string]string{"many.txt": b.String()})
+
+	out, err := search(t, tools.SearchFilesInput{Pattern: "hit", Path: rel(t), PageSize: 2})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 3 || lines[2] != "-- more matches; use page=2 to fetch more --" {
+		t.Fatalf("want 2 matches and a next-page sentinel, got %q", lines)
+	}
+	if !strings.HasSuffix(lines[0], "…") || len([]rune(lines[0])) > 600 {
+		t.Fatalf("long line should be clamped: %d runes", len([]rune(lines[0])))
+	}
+
+	out, _ = search(t, tools.SearchFilesInput{Pattern: "hit", Path: rel(t), PageSize: 2, Page: 3})
+	if strings.Count(out, ":5:") != 1 || strings.Contains(out, "more matches") {
+		t.Fatalf("last page should hold the fifth match only, got %q", out)
+	}
+}
+
+func TestSearchFiles_DeniedAndEscapingPathsSkipped(t *testing.T) {
+	writeTree(t, map[string]string{".git/config": "secret token", "ok.txt": "token"})
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "leak.txt"), []byte("token"), 0o644); err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "leak.txt"), filepath.Join(sharedDir, rel(t, "leak.txt"))); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	out, err := search(t, tools.SearchFilesInput{Pattern: "token", Path: rel(t)})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if out != filepath.ToSlash(rel(t, "ok.txt"))+":1:token\n" {
+		t.Fatalf("only ok.txt should match, got %q", out)
+	}
+
+	_, err = search(t, tools.SearchFilesInput{Pattern: "x", Path: ".git"})
+	var te safety.ToolError
+	if !errors.As(err, &te) || te.Code != "ERR_DENIED_READ" {
+		t.Fatalf("want ERR_DENIED_READ for .git, got %v", err)
+	}
+	_, err = search(t, tools.SearchFilesInput{Pattern: "(", Path: rel(t)})
+	if !errors.As(err, &te) || te.Code != "ERR_INVALID_PATTERN" {
+		t.Fatalf("want ERR_INVALID_PATTERN, got %v", err)
+	}
+}
+
+func TestSearchFiles_SkipsIgnoredFiles(t *testing.T) {
+	writeTree(t, map[string]string{".agentignore": "dist/\n", "src.js": "needle", "dist/bundle.js": "needle"})
+
+	out, err := search(t, tools.SearchFilesInput{Pattern: "needle", Path: rel(t)})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	want := filepath.ToSlash(rel(t, "src.js")) + ":1:needle\n" +
+		"-- 1 ignored entry hidden (.gitignore/.agentignore); set include_ignored to include them --\n"
+	if out != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", out, want)
+	}
+
+	out, _ = search(t, tools.SearchFilesInput{Pattern: "needle", Path: rel(t), IncludeIgnored: true})
+	if strings.Count(out, ":1:needle") != 2 {
+		t.Fatalf("include_ignored should search every file, got %q", out)
+	}
+}
@@ -0,0 +1,206 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/safety"
+)
+
+// schemaNode is the subset of JSON Schema that ValidateInput enforces.
+type schemaNode struct {
+	Type                 json.RawMessage        `json:"type"` // a type name or a list of them
+	Properties           map[string]*schemaNode `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                *schemaNode            `json:"items"`
+	Enum                 []any                  `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+}
+
+// ValidateInput checks input against a tool's input schema: types, required and
+// unknown properties, enums, numeric bounds and string and array lengths. Every
+// problem is reported in one ERR_INVALID_INPUT ToolError whose Fields name the
+// offending inputs. A schema without properties accepts any input.
+func ValidateInput(schema anthropic.ToolInputSchemaParam, input json.RawMessage) error {
+	if schema.Properties == nil {
+		return nil
+	}
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return fmt.Errorf("tool input schema: %w", err)
+	}
+	var root schemaNode
+	if err := json.Unmarshal(b, &root); err != nil {
+		return fmt.Errorf("tool input schema: %w", err)
+	}
+	if len(bytes.TrimSpace(input)) == 0 {
+		input = json.RawMessage("{}")
+	}
+	d := json.NewDecoder(bytes.NewReader(input))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return safety.ToolError{Code: "ERR_INVALID_INPUT", Message: "input is not valid JSON: " + err.Error()}
+	}
+
+	var problems []string
+	var fields []string
+	root.check("", v, func(path, msg string) {
+		name := path
+		if name == "" {
+			name = "input"
+		}
+		problems = append(problems, name+": "+msg)
+		if !slices.Contains(fields, name) {
+			fields = append(fields, name)
+		}
+	})
+	if len(problems) == 0 {
+		return nil
+	}
+	return safety.ToolError{Code: "ERR_INVALID_INPUT", Message: strings.Join(problems, "; "), Fields: fields}
+}
+
+func (s *schemaNode) check(path string, v any, report func(path, msg string)) {
+	if types := s.types(); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(v, t) }) {
+		report(path, fmt.Sprintf("must be %s, got %s", strings.Join(types, " or "), typeName(v)))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return equalJSON(e, v) }) {
+		opts := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			b, _ := json.Marshal(e)
+			opts[i] = string(b)
+		}
+		report(path, "must be one of "+strings.Join(opts, ", "))
+	}
+	switch x := v.(type) {
+	case json.Number:
+		f, _ := x.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			report(path, fmt.Sprintf("must be ≥ %v", *s.Minimum))
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			report(path, fmt.Sprintf("must be ≤ %v", *s.Maximum))
+		}
+	case string:
+		n := utf8.RuneCountInString(x)
+		if s.MinLength != nil && n < *s.MinLength {
+			if *s.MinLength == 1 {
+				report(path, "must not be empty")
+			} else {
+				report(path, fmt.Sprintf("must be at least %d characters", *s.MinLength))
+			}
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			report(path, fmt.Sprintf("must be at most %d characters", *s.MaxLength))
+		}
+	case []any:
+		if s.MinItems != nil && len(x) < *s.MinItems {
+			report(path, fmt.Sprintf("must have at least %d items", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(x) > *s.MaxItems {
+			report(path, fmt.Sprintf("must have at most %d items", *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range x {
+				s.Items.check(fmt.Sprintf("%s[%d]", path, i), item, report)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := x[name]; !ok {
+				report(join(path, name), "required")
+			}
+		}
+		names := make([]string, 0, len(x))
+		for name := range x {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		closed := string(bytes.TrimSpace(s.AdditionalProperties)) == "false"
+		for _, name := range names {
+			if p, ok := s.Properties[name]; ok {
+				p.check(join(path, name), x[name], report)
+			} else if closed {
+				report(join(path, name), "unknown property")
+			}
+		}
+	}
+}
+
+func (s *schemaNode) types() []string {
+	var one string
+	if json.Unmarshal(s.Type, &one) == nil && one != "" {
+		return []string{one}
+	}
+	var many []string
+	_ = json.Unmarshal(s.Type, &many)
+	return many
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func hasType(v any, t string) bool {
+	switch x := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case string:
+		return t == "string"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		f, err := x.Float64()
+		return t == "integer" && err == nil && f == math.Trunc(f)
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	}
+	return false
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// equalJSON compares an enum value from the schema with a decoded input value.
+func equalJSON(a, b any) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
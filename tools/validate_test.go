@@ -0,0 +1,76 @@
+package tools_test
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/petasbytes/go-agent/internal/safety"
+	"github.com/petasbytes/go-agent/tools"
+)
+
+func TestGenerateSchema_RequiredAndBounds(t *testing.T) {
+	b, err := json.Marshal(tools.ReadFileInputSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"required":["path"]`, `"minimum":0`, `"minLength":1`, `"additionalProperties":false`, `"description":"Relative file path."`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("schema missing %s: %s", want, b)
+		}
+	}
+}
+
+func TestValidateInput_ReportsOffendingFields(t *testing.T) {
+	err := tools.ValidateInput(tools.ReadFileInputSchema, json.RawMessage(`{"offset":-1,"limit":"ten","extra":true}`))
+	var te safety.ToolError
+	if !errors.As(err, &te) || te.Code != "ERR_INVALID_INPUT" {
+		t.Fatalf("want ERR_INVALID_INPUT, got %v", err)
+	}
+	want := []string{"path", "extra", "limit", "offset"}
+	if !slices.Equal(te.Fields, want) {
+		t.Fatalf("fields: got %v want %v", te.Fields, want)
+	}
+	for _, msg := range []string{"path: required", "extra: unknown property", "limit: must be integer, got string", "offset: must be ≥ 0"} {
+		if !strings.Contains(te.Message, msg) {
+			t.Errorf("message missing %q: %s", msg, te.Message)
+		}
+	}
+}
+
+func TestValidateInput_AcceptsValidInput(t *testing.T) {
+	cases := []struct {
+		schema anthropic.ToolInputSchemaParam
+		input  string
+	}{
+		{tools.ReadFileInputSchema, `{"path":"a.txt","offset":3}`},
+		{tools.ListFilesInputSchema, ``},
+		{tools.EditFileInputSchema, `{"path":"new.txt","new_str":"hi"}`},
+	}
+	for _, c := range cases {
+		if err := tools.ValidateInput(c.schema, json.RawMessage(c.input)); err != nil {
+			t.Errorf("%s: unexpected error %v", c.input, err)
+		}
+	}
+}
+
+func TestValidateInput_EnumsAndNesting(t *testing.T) {
+	type item struct {
+		Mode string `json:"mode" jsonschema:"enum=fast,enum=slow"`
+	}
+	type input struct {
+		Items []item `json:"items" jsonschema:"minItems=1"`
+	}
+	schema := tools.GenerateSchema[input]()
+	err := tools.ValidateInput(schema, json.RawMessage(`{"items":[{"mode":"fast"},{"mode":"warp"}]}`))
+	var te safety.ToolError
+	if !errors.As(err, &te) || !slices.Equal(te.Fields, []string{"items[1].mode"}) || !strings.Contains(te.Message, `must be one of "fast", "slow"`) {
+		t.Fatalf("unexpected result: %v", err)
+	}
+	if err := tools.ValidateInput(schema, json.RawMessage(`{"items":[]}`)); err == nil || !strings.Contains(err.Error(), "at least 1 items") {
+		t.Fatalf("want minItems error, got %v", err)
+	}
+}